@@ -2,28 +2,54 @@ package client
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	jwt "github.com/dgrijalva/jwt-go"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+// refreshRetryDelay is the first delay before retrying a failed token refresh, it doubles up to the refresh duration
+const refreshRetryDelay = time.Second
+
 // AuthInterceptor client interceptor for authentication
 type AuthInterceptor struct {
-	authClient  *AuthClient
-	authMethods map[string]bool
+	authClient      *AuthClient
+	authMethods     map[string]bool
+	refreshDuration time.Duration
+
+	mutex       sync.RWMutex
 	accessToken string
+	expiresAt   time.Time
+
+	// refreshMutex serializes the logins, so concurrent rpcs failing together refresh the token once
+	refreshMutex sync.Mutex
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-// NewAuthInterceptor create a new auth interceptor for client
+// NewAuthInterceptor create a new auth interceptor for client, it logs in and refreshes the token in background
+// every refreshDuration, or earlier when the token expires sooner, until Close is called
 func NewAuthInterceptor(authClient *AuthClient, authMethods map[string]bool, refreshDuration time.Duration) (*AuthInterceptor, error) {
+	if refreshDuration <= 0 {
+		return nil, fmt.Errorf("refresh duration must be positive, got %v", refreshDuration)
+	}
+
 	interceptor := &AuthInterceptor{
-		authClient:  authClient,
-		authMethods: authMethods,
+		authClient:      authClient,
+		authMethods:     authMethods,
+		refreshDuration: refreshDuration,
+		done:            make(chan struct{}),
 	}
 
-	err := interceptor.scheduleRefreshToken(refreshDuration)
+	err := interceptor.scheduleRefreshToken()
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +57,16 @@ func NewAuthInterceptor(authClient *AuthClient, authMethods map[string]bool, ref
 	return interceptor, nil
 }
 
-// Unary returns a client interceptor to authenticate unary rpcs
+// Close stops refreshing the token in background
+func (interceptor *AuthInterceptor) Close() {
+	interceptor.closeOnce.Do(func() {
+		interceptor.cancel()
+		<-interceptor.done
+	})
+}
+
+// Unary returns a client interceptor to authenticate unary rpcs,
+// a call rejected as unauthenticated is retried once with a new token
 func (interceptor *AuthInterceptor) Unary() grpc.UnaryClientInterceptor {
 	return func(
 		ctx context.Context,
@@ -44,15 +79,31 @@ func (interceptor *AuthInterceptor) Unary() grpc.UnaryClientInterceptor {
 	) error {
 		log.Printf("--> unary client interceptor: %s", method)
 
-		if interceptor.authMethods[method] {
-			return invoker(interceptor.attachToken(ctx), method, req, reply, cc, opts...)
+		if !interceptor.authMethods[method] {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		accessToken, err := interceptor.token()
+		if err != nil {
+			return err
 		}
 
-		return invoker(ctx, method, req, reply, cc, opts...)
+		err = invoker(attachToken(ctx, accessToken), method, req, reply, cc, opts...)
+		if status.Code(err) != codes.Unauthenticated {
+			return err
+		}
+
+		accessToken, refreshErr := interceptor.refreshToken(accessToken)
+		if refreshErr != nil {
+			return err
+		}
+		return invoker(attachToken(ctx, accessToken), method, req, reply, cc, opts...)
 	}
 }
 
-// Stream returns a client interceptor to authenticate stream rpcs
+// Stream returns a client interceptor to authenticate stream rpcs with a token that has not expired.
+// A stream rejected as unauthenticated is not retried: the rejection is only received once messages
+// may have been sent, and they cannot all be sent again
 func (interceptor *AuthInterceptor) Stream() grpc.StreamClientInterceptor {
 	return func(
 		ctx context.Context,
@@ -64,49 +115,153 @@ func (interceptor *AuthInterceptor) Stream() grpc.StreamClientInterceptor {
 	) (grpc.ClientStream, error) {
 		log.Printf("--> stream client interceptor: %s", method)
 
-		if interceptor.authMethods[method] {
-			return streamer(interceptor.attachToken(ctx), desc, cc, method, opts...)
+		if !interceptor.authMethods[method] {
+			return streamer(ctx, desc, cc, method, opts...)
 		}
 
-		return streamer(ctx, desc, cc, method, opts...)
+		accessToken, err := interceptor.token()
+		if err != nil {
+			return nil, err
+		}
+
+		return streamer(attachToken(ctx, accessToken), desc, cc, method, opts...)
 	}
 }
 
 // attachToken attach token to the context
-func (interceptor *AuthInterceptor) attachToken(ctx context.Context) context.Context {
-	return metadata.AppendToOutgoingContext(ctx, "authorization", interceptor.accessToken)
+func attachToken(ctx context.Context, accessToken string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", accessToken)
+}
+
+// token returns the current access token, logging in again first if it has expired
+func (interceptor *AuthInterceptor) token() (string, error) {
+	interceptor.mutex.RLock()
+	accessToken, expiresAt := interceptor.accessToken, interceptor.expiresAt
+	interceptor.mutex.RUnlock()
+
+	if isTokenValid(accessToken, expiresAt) {
+		return accessToken, nil
+	}
+
+	return interceptor.refreshToken(accessToken)
 }
 
 // scheduleRefreshToken schedule a routine to refresh access token
-func (interceptor *AuthInterceptor) scheduleRefreshToken(refreshDuration time.Duration) error {
-	err := interceptor.refreshToken()
+func (interceptor *AuthInterceptor) scheduleRefreshToken() error {
+	_, err := interceptor.refreshToken("")
 	if err != nil {
 		return err
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	interceptor.cancel = cancel
+
 	go func() {
-		wait := refreshDuration
+		defer close(interceptor.done)
+
+		retryDelay := refreshRetryDelay
+		wait := interceptor.nextRefresh()
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
 		for {
-			time.Sleep(wait)
-			err := interceptor.refreshToken()
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			interceptor.mutex.RLock()
+			staleToken := interceptor.accessToken
+			interceptor.mutex.RUnlock()
+
+			_, err := interceptor.refreshToken(staleToken)
 			if err != nil {
-				wait = time.Second
+				log.Printf("cannot refresh token: %v", err)
+				wait = retryDelay
+				retryDelay *= 2
+				if retryDelay > interceptor.refreshDuration {
+					retryDelay = interceptor.refreshDuration
+				}
 			} else {
-				wait = refreshDuration
+				wait = interceptor.nextRefresh()
+				retryDelay = refreshRetryDelay
 			}
+			timer.Reset(wait)
 		}
 	}()
 
 	return nil
 }
 
-func (interceptor *AuthInterceptor) refreshToken() error {
+// nextRefresh returns how long to wait before refreshing the token,
+// the refresh duration unless the token expires sooner, then when 80% of its remaining lifetime has passed,
+// but no sooner than the retry delay
+func (interceptor *AuthInterceptor) nextRefresh() time.Duration {
+	interceptor.mutex.RLock()
+	expiresAt := interceptor.expiresAt
+	interceptor.mutex.RUnlock()
+
+	wait := interceptor.refreshDuration
+	if !expiresAt.IsZero() {
+		untilExpiry := time.Until(expiresAt) * 4 / 5
+		if untilExpiry < wait {
+			wait = untilExpiry
+		}
+	}
+	if wait < refreshRetryDelay {
+		wait = refreshRetryDelay
+	}
+	return wait
+}
+
+// refreshToken logs in again unless staleToken has already been replaced by a valid token, and returns the current token
+func (interceptor *AuthInterceptor) refreshToken(staleToken string) (string, error) {
+	interceptor.refreshMutex.Lock()
+	defer interceptor.refreshMutex.Unlock()
+
+	interceptor.mutex.RLock()
+	accessToken, expiresAt := interceptor.accessToken, interceptor.expiresAt
+	interceptor.mutex.RUnlock()
+
+	if accessToken != staleToken && isTokenValid(accessToken, expiresAt) {
+		return accessToken, nil
+	}
+
 	accessToken, err := interceptor.authClient.Login()
 	if err != nil {
-		return err
+		return "", status.Errorf(codes.Unauthenticated, "cannot refresh access token: %v", err)
 	}
 
+	expiresAt, err = tokenExpiry(accessToken)
+	if err != nil {
+		return "", status.Errorf(codes.Unauthenticated, "cannot refresh access token: %v", err)
+	}
+
+	interceptor.mutex.Lock()
 	interceptor.accessToken = accessToken
-	log.Printf("token refreshed: %v", accessToken)
-	return nil
+	interceptor.expiresAt = expiresAt
+	interceptor.mutex.Unlock()
+
+	log.Printf("token refreshed, expires at %v", expiresAt)
+	return accessToken, nil
+}
+
+func isTokenValid(accessToken string, expiresAt time.Time) bool {
+	return len(accessToken) > 0 && (expiresAt.IsZero() || time.Now().Before(expiresAt))
+}
+
+// tokenExpiry reads the exp claim of a token, the zero time if it has none,
+// the token is not verified since only the server knows its key
+func tokenExpiry(accessToken string) (time.Time, error) {
+	claims := &jwt.StandardClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(accessToken, claims)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse access token: %w", err)
+	}
+
+	if claims.ExpiresAt == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(claims.ExpiresAt, 0), nil
 }
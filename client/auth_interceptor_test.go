@@ -0,0 +1,139 @@
+package client_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/mikhail-bigun/grpc-app-pcbook/client"
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testAuthMethod = "/pcbook.LaptopService/CreateLaptop"
+
+func TestAuthInterceptorRetryUnauthenticated(t *testing.T) {
+	t.Parallel()
+
+	authServer := &fakeAuthServer{tokenDuration: time.Minute}
+	interceptor := newTestAuthInterceptor(t, authServer, time.Minute)
+
+	tokens := []string{}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		tokens = append(tokens, md["authorization"][0])
+		if len(tokens) == 1 {
+			return status.Error(codes.Unauthenticated, "access token is invalid")
+		}
+		return nil
+	}
+
+	err := interceptor.Unary()(context.Background(), testAuthMethod, nil, nil, nil, invoker)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	require.NotEqual(t, tokens[0], tokens[1])
+	require.Equal(t, 2, authServer.loginCount())
+}
+
+func TestAuthInterceptorRefreshExpiredToken(t *testing.T) {
+	t.Parallel()
+
+	authServer := &fakeAuthServer{tokenDuration: time.Second}
+	interceptor := newTestAuthInterceptor(t, authServer, time.Minute)
+
+	var mutex sync.Mutex
+	tokens := map[string]bool{}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		mutex.Lock()
+		tokens[md["authorization"][0]] = true
+		mutex.Unlock()
+		return nil
+	}
+
+	// concurrent rpcs while the token is refreshed in background
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for deadline := time.Now().Add(1500 * time.Millisecond); time.Now().Before(deadline); {
+				err := interceptor.Unary()(context.Background(), testAuthMethod, nil, nil, nil, invoker)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.GreaterOrEqual(t, len(tokens), 2)
+
+	interceptor.Close()
+	interceptor.Close()
+	count := authServer.loginCount()
+	time.Sleep(1200 * time.Millisecond)
+	require.Equal(t, count, authServer.loginCount())
+}
+
+// fakeAuthServer issues a different unsigned token with an exp claim on every login
+type fakeAuthServer struct {
+	tokenDuration time.Duration
+
+	mutex  sync.Mutex
+	logins int
+}
+
+func (server *fakeAuthServer) Login(ctx context.Context, req *pcbook.LoginRequest) (*pcbook.LoginResponse, error) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.logins++
+	claims := jwt.StandardClaims{
+		Id:        string(rune('a' + server.logins)),
+		ExpiresAt: time.Now().Add(server.tokenDuration).Unix(),
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate access token: %v", err)
+	}
+
+	return &pcbook.LoginResponse{AccessToken: accessToken}, nil
+}
+
+func (server *fakeAuthServer) loginCount() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.logins
+}
+
+func newTestAuthInterceptor(t *testing.T, authServer pcbook.AuthServiceServer, refreshDuration time.Duration) *client.AuthInterceptor {
+	grpcServer := grpc.NewServer()
+	pcbook.RegisterAuthServiceServer(grpcServer, authServer)
+
+	listener, err := net.Listen("tcp", ":0") // any random available port
+	require.NoError(t, err)
+
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	authClient := client.NewAuthClient(conn, "admin", "secret")
+	interceptor, err := client.NewAuthInterceptor(authClient, map[string]bool{testAuthMethod: true}, refreshDuration)
+	require.NoError(t, err)
+	t.Cleanup(interceptor.Close)
+
+	return interceptor
+}
@@ -0,0 +1,274 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUploadWorkers is the number of images uploaded concurrently unless WithUploadWorkers is used
+const DefaultUploadWorkers = 4
+
+// ImageUpload is an image file to upload for a laptop
+type ImageUpload struct {
+	LaptopID string `json:"laptop_id"`
+	Path     string `json:"path"`
+}
+
+// ImageUploadResult is the outcome of an image upload, Error is empty if it succeeded
+type ImageUploadResult struct {
+	ImageUpload
+	ImageID string `json:"image_id,omitempty"`
+	Size    uint32 `json:"size,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkUploadProgress is reported after each upload
+type BulkUploadProgress struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	Bytes     int64
+	Elapsed   time.Duration
+}
+
+// Throughput returns the uploaded bytes per second
+func (progress BulkUploadProgress) Throughput() float64 {
+	if progress.Elapsed <= 0 {
+		return 0
+	}
+	return float64(progress.Bytes) / progress.Elapsed.Seconds()
+}
+
+// BulkUploadSummary is the outcome of a bulk upload, it is written as JSON to retry the failed uploads later
+type BulkUploadSummary struct {
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	Bytes     int64               `json:"bytes"`
+	Elapsed   string              `json:"elapsed"`
+	Results   []ImageUploadResult `json:"results"`
+}
+
+// Failures returns the uploads that failed
+func (summary *BulkUploadSummary) Failures() []ImageUpload {
+	failures := []ImageUpload{}
+	for _, result := range summary.Results {
+		if len(result.Error) > 0 {
+			failures = append(failures, result.ImageUpload)
+		}
+	}
+	return failures
+}
+
+// bulkUploadConfig is built by the bulk upload options
+type bulkUploadConfig struct {
+	workers  int
+	progress func(BulkUploadProgress)
+}
+
+// BulkUploadOption configures a bulk upload
+type BulkUploadOption func(config *bulkUploadConfig)
+
+// WithUploadWorkers sets the number of images uploaded concurrently
+func WithUploadWorkers(workers int) BulkUploadOption {
+	return func(config *bulkUploadConfig) {
+		if workers > 0 {
+			config.workers = workers
+		}
+	}
+}
+
+// WithUploadProgress sets a function called after each upload, one call at a time
+func WithUploadProgress(progress func(BulkUploadProgress)) BulkUploadOption {
+	return func(config *bulkUploadConfig) {
+		config.progress = progress
+	}
+}
+
+// UploadImages uploads images with a bounded pool of workers, a failed upload does not stop the others,
+// the results are in the order of the uploads
+func (laptopClient *LaptopClient) UploadImages(ctx context.Context, uploads []ImageUpload, opts ...BulkUploadOption) *BulkUploadSummary {
+	config := &bulkUploadConfig{
+		workers: DefaultUploadWorkers,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	start := time.Now()
+	results := make([]ImageUploadResult, len(uploads))
+	progress := BulkUploadProgress{Total: len(uploads)}
+	var mutex sync.Mutex
+
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < config.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				result := laptopClient.uploadImage(ctx, uploads[index])
+
+				mutex.Lock()
+				results[index] = result
+				if len(result.Error) > 0 {
+					progress.Failed++
+				} else {
+					progress.Succeeded++
+					progress.Bytes += int64(result.Size)
+				}
+				progress.Elapsed = time.Since(start)
+				if config.progress != nil {
+					config.progress(progress)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for index := range uploads {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	return &BulkUploadSummary{
+		Succeeded: progress.Succeeded,
+		Failed:    progress.Failed,
+		Bytes:     progress.Bytes,
+		Elapsed:   time.Since(start).String(),
+		Results:   results,
+	}
+}
+
+func (laptopClient *LaptopClient) uploadImage(ctx context.Context, upload ImageUpload) ImageUploadResult {
+	result := ImageUploadResult{ImageUpload: upload}
+
+	if err := ctx.Err(); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	res, err := laptopClient.UploadImage(ctx, upload.LaptopID, upload.Path)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.ImageID = res.GetId()
+	result.Size = res.GetSize()
+	return result
+}
+
+// imageExtensions are the lower case file extensions of the images found in directories
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+}
+
+// ImageUploadsFromDir lists the images of a directory holding a sub directory per laptop named by the laptop ID
+func ImageUploadsFromDir(dir string) ([]ImageUpload, error) {
+	laptopDirs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image directory: %w", err)
+	}
+
+	uploads := []ImageUpload{}
+	for _, laptopDir := range laptopDirs {
+		if !laptopDir.IsDir() {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(dir, laptopDir.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read image directory: %w", err)
+		}
+
+		for _, file := range files {
+			if file.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(file.Name()))] {
+				continue
+			}
+			uploads = append(uploads, ImageUpload{
+				LaptopID: laptopDir.Name(),
+				Path:     filepath.Join(dir, laptopDir.Name(), file.Name()),
+			})
+		}
+	}
+
+	return uploads, nil
+}
+
+// ReadImageManifest reads a JSON manifest mapping laptop IDs to image files,
+// relative paths are relative to the manifest directory
+//
+//	{"<laptop-id>": ["front.jpg", "back.jpg"]}
+func ReadImageManifest(path string) ([]ImageUpload, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest: %w", err)
+	}
+
+	manifest := map[string][]string{}
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse manifest %s: %w", path, err)
+	}
+
+	laptopIDs := make([]string, 0, len(manifest))
+	for laptopID := range manifest {
+		laptopIDs = append(laptopIDs, laptopID)
+	}
+	sort.Strings(laptopIDs)
+
+	uploads := []ImageUpload{}
+	for _, laptopID := range laptopIDs {
+		for _, imagePath := range manifest[laptopID] {
+			if !filepath.IsAbs(imagePath) {
+				imagePath = filepath.Join(filepath.Dir(path), imagePath)
+			}
+			uploads = append(uploads, ImageUpload{LaptopID: laptopID, Path: imagePath})
+		}
+	}
+
+	return uploads, nil
+}
+
+// ReadBulkUploadSummary reads a summary written as JSON, to retry its failures
+func ReadBulkUploadSummary(path string) (*BulkUploadSummary, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read summary: %w", err)
+	}
+
+	summary := &BulkUploadSummary{}
+	err = json.Unmarshal(data, summary)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse summary %s: %w", path, err)
+	}
+
+	return summary, nil
+}
+
+// WriteBulkUploadSummary writes a summary as JSON
+func WriteBulkUploadSummary(path string, summary *BulkUploadSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot marshal summary: %w", err)
+	}
+
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot write summary: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package client_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/client"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLaptopClientUploadImages(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+
+	laptop1 := sample.NewLaptop()
+	laptop2 := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop1))
+	require.NoError(t, laptopStore.Save(laptop2))
+
+	laptopClient := newTestLaptopClient(t, laptopStore, imageStore, nil)
+
+	// a directory of images per laptop, plus a laptop that does not exist
+	dir := t.TempDir()
+	data, err := ioutil.ReadFile("../tmp/laptop.jpg")
+	require.NoError(t, err)
+	unknownID := sample.NewLaptop().GetId()
+	for _, laptopID := range []string{laptop1.GetId(), laptop2.GetId(), unknownID} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, laptopID), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, laptopID, "front.jpg"), data, 0644))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, laptopID, "notes.txt"), []byte("not an image"), 0644))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, laptop1.GetId(), "BACK.JPG"), data, 0644))
+
+	uploads, err := client.ImageUploadsFromDir(dir)
+	require.NoError(t, err)
+	require.Len(t, uploads, 4)
+
+	// the progress is reported by the workers, it is checked once the upload is done
+	progresses := []client.BulkUploadProgress{}
+	summary := laptopClient.UploadImages(context.Background(), uploads,
+		client.WithUploadWorkers(2),
+		client.WithUploadProgress(func(progress client.BulkUploadProgress) {
+			progresses = append(progresses, progress)
+		}),
+	)
+	require.Len(t, progresses, 4)
+	for i, progress := range progresses {
+		require.Equal(t, 4, progress.Total)
+		require.Equal(t, i+1, progress.Succeeded+progress.Failed)
+	}
+	require.Equal(t, 3, summary.Succeeded)
+	require.Equal(t, 1, summary.Failed)
+	require.EqualValues(t, 3*len(data), summary.Bytes)
+
+	for i, result := range summary.Results {
+		require.Equal(t, uploads[i], result.ImageUpload)
+	}
+
+	failures := summary.Failures()
+	require.Len(t, failures, 1)
+	require.Equal(t, unknownID, failures[0].LaptopID)
+
+	// the summary is written to retry the failures only
+	summaryPath := filepath.Join(t.TempDir(), "summary.json")
+	require.NoError(t, client.WriteBulkUploadSummary(summaryPath, summary))
+	previous, err := client.ReadBulkUploadSummary(summaryPath)
+	require.NoError(t, err)
+	require.Equal(t, failures, previous.Failures())
+}
+
+func TestReadImageManifest(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manifest := `{"laptop-2": ["front.jpg"], "laptop-1": ["images/front.jpg", "/srv/images/back.jpg"]}`
+	path := filepath.Join(dir, "manifest.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(manifest), 0644))
+
+	uploads, err := client.ReadImageManifest(path)
+	require.NoError(t, err)
+	require.Equal(t, []client.ImageUpload{
+		{LaptopID: "laptop-1", Path: filepath.Join(dir, "images/front.jpg")},
+		{LaptopID: "laptop-1", Path: "/srv/images/back.jpg"},
+		{LaptopID: "laptop-2", Path: filepath.Join(dir, "front.jpg")},
+	}, uploads)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`["front.jpg"]`), 0644))
+	_, err = client.ReadImageManifest(path)
+	require.Error(t, err)
+}
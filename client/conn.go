@@ -0,0 +1,382 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy tells which calls are retried and how long to wait between attempts
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one, 1 disables retries
+	MaxAttempts       int
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	// Codes are the status codes that are retried
+	Codes []codes.Code
+	// Methods are the full names of the idempotent methods that may be retried,
+	// the messages sent on a client stream are kept until its response to be sent again
+	Methods map[string]bool
+}
+
+// WithMethods returns a copy of the policy also retrying the given full method names
+func (policy RetryPolicy) WithMethods(methods ...string) RetryPolicy {
+	retried := make(map[string]bool, len(policy.Methods)+len(methods))
+	for method, ok := range policy.Methods {
+		retried[method] = ok
+	}
+	for _, method := range methods {
+		retried[method] = true
+	}
+	policy.Methods = retried
+	return policy
+}
+
+// DefaultRetryPolicy retries the idempotent methods on Unavailable.
+// CreateLaptop and BatchCreateLaptops may be added for laptops created with an ID: if a failed attempt had in fact
+// saved the laptop, the retry fails with ErrAlreadyExists instead of creating it twice.
+// UpdateLaptop is left out: a retry of an applied update fails with ErrAborted when it had an etag,
+// and reports the laptop as not created when it allowed a missing one.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:       4,
+	InitialBackoff:    100 * time.Millisecond,
+	MaxBackoff:        2 * time.Second,
+	BackoffMultiplier: 2,
+	Codes:             []codes.Code{codes.Unavailable},
+	Methods: map[string]bool{
+		"/pcbook.AuthService/Login":                    true,
+		"/pcbook.LaptopService/GetLaptop":              true,
+		"/pcbook.LaptopService/GetRating":              true,
+		"/pcbook.LaptopService/AggregateLaptops":       true,
+		"/pcbook.LaptopService/CompareLaptops":         true,
+		"/pcbook.LaptopService/RecommendSimilar":       true,
+		"/pcbook.LaptopService/TopRatedLaptops":        true,
+		"/pcbook.ReviewService/ListReviews":            true,
+		"/pcbook.ReviewService/HideReview":             true,
+		"/pcbook.SavedSearchService/ListSavedSearches": true,
+		"/pcbook.WebhookService/ListWebhooks":          true,
+		"/pcbook.WebhookService/ListWebhookDeliveries": true,
+	},
+}
+
+// DefaultKeepalive pings the server after 30 seconds without activity, the server must permit it
+var DefaultKeepalive = keepalive.ClientParameters{
+	Time:    30 * time.Second,
+	Timeout: 10 * time.Second,
+}
+
+// connConfig is built by the conn options
+type connConfig struct {
+	retry       RetryPolicy
+	deadlines   map[string]time.Duration
+	keepalive   keepalive.ClientParameters
+	dialOptions []grpc.DialOption
+}
+
+// ConnOption configures a connection made by Dial
+type ConnOption func(config *connConfig)
+
+// WithRetryPolicy sets the retry policy of the connection
+func WithRetryPolicy(policy RetryPolicy) ConnOption {
+	return func(config *connConfig) {
+		config.retry = policy
+	}
+}
+
+// WithDeadlines bounds each attempt of the calls to a method, or each stream, by a deadline, keyed by full method name,
+// e.g. "/pcbook.LaptopService/GetLaptop", or by service name for all its methods, e.g. "/pcbook.LaptopService/",
+// an earlier deadline of the call context still applies
+func WithDeadlines(deadlines map[string]time.Duration) ConnOption {
+	return func(config *connConfig) {
+		config.deadlines = deadlines
+	}
+}
+
+// WithKeepalive sets the keepalive parameters of the connection
+func WithKeepalive(params keepalive.ClientParameters) ConnOption {
+	return func(config *connConfig) {
+		config.keepalive = params
+	}
+}
+
+// WithDialOptions adds dial options, such as transport credentials and interceptors,
+// an interceptor set with grpc.WithUnaryInterceptor or grpc.WithStreamInterceptor runs once around all the attempts of a call
+func WithDialOptions(opts ...grpc.DialOption) ConnOption {
+	return func(config *connConfig) {
+		config.dialOptions = append(config.dialOptions, opts...)
+	}
+}
+
+// Dial connects to the servers, balancing the calls in round-robin when there are several addresses
+func Dial(addresses []string, opts ...ConnOption) (*grpc.ClientConn, error) {
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no server address")
+	}
+
+	config := &connConfig{
+		retry:     DefaultRetryPolicy,
+		keepalive: DefaultKeepalive,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	serviceConfig, err := buildServiceConfig(config.deadlines, len(addresses) > 1)
+	if err != nil {
+		return nil, err
+	}
+
+	dialOptions := []grpc.DialOption{
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithKeepaliveParams(config.keepalive),
+		grpc.WithChainUnaryInterceptor(retryUnaryInterceptor(config.retry)),
+		grpc.WithChainStreamInterceptor(retryStreamInterceptor(config.retry)),
+	}
+	dialOptions = append(dialOptions, config.dialOptions...)
+
+	target := addresses[0]
+	if len(addresses) > 1 {
+		builder := manual.NewBuilderWithScheme(fmt.Sprintf("pcbook-%d", rand.Int63()))
+		state := resolver.State{}
+		for _, address := range addresses {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: address})
+		}
+		builder.InitialState(state)
+
+		// the first address is the authority, so TLS verifies the server name against its host
+		target = builder.Scheme() + ":///" + addresses[0]
+		dialOptions = append(dialOptions, grpc.WithResolvers(builder))
+	}
+
+	return grpc.Dial(target, dialOptions...)
+}
+
+type serviceConfigJSON struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig,omitempty"`
+	MethodConfig        []methodConfigJSON    `json:"methodConfig,omitempty"`
+}
+
+type methodConfigJSON struct {
+	Name    []methodNameJSON `json:"name"`
+	Timeout string           `json:"timeout"`
+}
+
+type methodNameJSON struct {
+	Service string `json:"service"`
+	Method  string `json:"method,omitempty"`
+}
+
+// buildServiceConfig returns the service config setting the load balancing policy and the default deadlines,
+// retries are made by an interceptor since grpc-go only applies the retry policies of service configs
+// when GRPC_GO_RETRY=on is set
+func buildServiceConfig(deadlines map[string]time.Duration, roundRobin bool) (string, error) {
+	config := serviceConfigJSON{}
+	if roundRobin {
+		config.LoadBalancingConfig = []map[string]struct{}{{"round_robin": {}}}
+	}
+
+	for name, deadline := range deadlines {
+		parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return "", fmt.Errorf("invalid method name %q, expected /<service>/<method> or /<service>/", name)
+		}
+		if deadline <= 0 {
+			return "", fmt.Errorf("invalid deadline %v for %s", deadline, name)
+		}
+
+		config.MethodConfig = append(config.MethodConfig, methodConfigJSON{
+			Name:    []methodNameJSON{{Service: parts[0], Method: parts[1]}},
+			Timeout: fmt.Sprintf("%.9fs", deadline.Seconds()),
+		})
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal service config: %w", err)
+	}
+	return string(data), nil
+}
+
+// retrier counts the attempts of a call and waits an exponential backoff with jitter between them
+type retrier struct {
+	policy    RetryPolicy
+	retryable map[codes.Code]bool
+	backoff   time.Duration
+	attempt   int
+}
+
+func newRetrier(policy RetryPolicy, retryable map[codes.Code]bool) *retrier {
+	return &retrier{policy: policy, retryable: retryable, backoff: policy.InitialBackoff, attempt: 1}
+}
+
+// retry tells if the attempt that failed with err is made again, after waiting the backoff,
+// false if err is nil, not retryable, the last attempt failed or ctx is done while waiting
+func (r *retrier) retry(ctx context.Context, err error) bool {
+	if err == nil || r.attempt >= r.policy.MaxAttempts || !r.retryable[status.Code(err)] {
+		return false
+	}
+
+	// full jitter, so that clients failing together do not retry together,
+	// unless the server asked for a delay
+	wait := time.Duration(rand.Int63n(int64(r.backoff) + 1))
+	if details, ok := DecodeErrorDetails(err); ok && details.RetryDelay > 0 {
+		wait = details.RetryDelay
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(wait):
+	}
+
+	r.attempt++
+	r.backoff = time.Duration(float64(r.backoff) * r.policy.BackoffMultiplier)
+	if r.backoff > r.policy.MaxBackoff {
+		r.backoff = r.policy.MaxBackoff
+	}
+	return true
+}
+
+func retryableCodes(policy RetryPolicy) map[codes.Code]bool {
+	retryable := make(map[codes.Code]bool)
+	for _, code := range policy.Codes {
+		retryable[code] = true
+	}
+	return retryable
+}
+
+// retryUnaryInterceptor retries the calls of the policy methods failing with one of its codes
+func retryUnaryInterceptor(policy RetryPolicy) grpc.UnaryClientInterceptor {
+	retryable := retryableCodes(policy)
+
+	return func(
+		ctx context.Context,
+		method string,
+		req,
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if !policy.Methods[method] {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		r := newRetrier(policy, retryable)
+		for {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if !r.retry(ctx, err) {
+				return err
+			}
+		}
+	}
+}
+
+// retryStreamInterceptor retries the client streams of the policy methods failing with one of its codes,
+// the streams receiving several responses are not retried
+func retryStreamInterceptor(policy RetryPolicy) grpc.StreamClientInterceptor {
+	retryable := retryableCodes(policy)
+
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		if !policy.Methods[method] || desc.ServerStreams {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		stream := &retryClientStream{
+			ctx:     ctx,
+			retrier: newRetrier(policy, retryable),
+			open: func() (grpc.ClientStream, error) {
+				return streamer(ctx, desc, cc, method, opts...)
+			},
+		}
+		for {
+			var err error
+			stream.ClientStream, err = stream.open()
+			if err == nil {
+				return stream, nil
+			}
+			if !stream.retrier.retry(ctx, err) {
+				return nil, err
+			}
+		}
+	}
+}
+
+// retryClientStream keeps the messages sent on a client stream,
+// so that they are sent again on a new stream when the response fails with a retryable code
+type retryClientStream struct {
+	grpc.ClientStream
+	ctx     context.Context
+	retrier *retrier
+	open    func() (grpc.ClientStream, error)
+	sent    []interface{}
+	closed  bool
+}
+
+// SendMsg sends a message and keeps it, io.EOF is not returned since the failure is reported, and retried, by RecvMsg
+func (stream *retryClientStream) SendMsg(m interface{}) error {
+	stream.sent = append(stream.sent, m)
+	err := stream.ClientStream.SendMsg(m)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func (stream *retryClientStream) CloseSend() error {
+	stream.closed = true
+	return stream.ClientStream.CloseSend()
+}
+
+// RecvMsg receives the response, sending the kept messages on a new stream while it fails with a retryable code
+func (stream *retryClientStream) RecvMsg(m interface{}) error {
+	err := stream.ClientStream.RecvMsg(m)
+	for stream.retrier.retry(stream.ctx, err) {
+		err = stream.reopen()
+		if err == nil {
+			err = stream.ClientStream.RecvMsg(m)
+		}
+	}
+	return err
+}
+
+// reopen opens a new stream and sends it the kept messages
+func (stream *retryClientStream) reopen() error {
+	clientStream, err := stream.open()
+	if err != nil {
+		return err
+	}
+	stream.ClientStream = clientStream
+
+	for _, m := range stream.sent {
+		err := clientStream.SendMsg(m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if stream.closed {
+		return clientStream.CloseSend()
+	}
+	return nil
+}
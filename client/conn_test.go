@@ -0,0 +1,188 @@
+package client_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/client"
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDialRetryIdempotentMethods(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	server := &flakyLaptopServer{LaptopServiceServer: service.NewLaptopServer(laptopStore, nil, nil), failures: 2}
+	address := startFlakyLaptopServer(t, server)
+
+	policy := client.DefaultRetryPolicy
+	policy.InitialBackoff = time.Millisecond
+	conn, err := client.Dial([]string{address}, client.WithRetryPolicy(policy), client.WithDialOptions(grpc.WithInsecure()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	laptopClient := client.NewLaptopClient(conn)
+
+	other, err := laptopClient.GetLaptop(context.Background(), laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, laptop.GetId(), other.GetId())
+	require.EqualValues(t, 3, atomic.LoadInt32(&server.calls))
+
+	// CreateLaptop is not idempotent, so it is not retried
+	atomic.StoreInt32(&server.failures, 1)
+	_, err = laptopClient.CreateLaptop(context.Background(), sample.NewLaptop())
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.EqualValues(t, 4, atomic.LoadInt32(&server.calls))
+}
+
+func TestDialRetryClientStream(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	server := &flakyLaptopServer{LaptopServiceServer: service.NewLaptopServer(laptopStore, nil, nil), failures: 2}
+	address := startFlakyLaptopServer(t, server)
+
+	policy := client.DefaultRetryPolicy.WithMethods("/pcbook.LaptopService/BatchCreateLaptops")
+	policy.InitialBackoff = time.Millisecond
+	require.False(t, client.DefaultRetryPolicy.Methods["/pcbook.LaptopService/BatchCreateLaptops"])
+	require.False(t, client.DefaultRetryPolicy.Methods["/pcbook.LaptopService/UpdateLaptop"])
+
+	conn, err := client.Dial([]string{address}, client.WithRetryPolicy(policy), client.WithDialOptions(grpc.WithInsecure()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	laptops := []*pcbook.Laptop{sample.NewLaptop(), sample.NewLaptop(), sample.NewLaptop()}
+	results, err := client.NewLaptopClient(conn).BatchCreateLaptops(context.Background(), laptops, false)
+	require.NoError(t, err)
+	require.Len(t, results, len(laptops))
+	for i, result := range results {
+		require.NoError(t, result.Err)
+		require.Equal(t, laptops[i].GetId(), result.ID)
+	}
+	require.EqualValues(t, 3, atomic.LoadInt32(&server.calls))
+
+	// without the method in the policy, the stream is not retried
+	conn, err = client.Dial([]string{address}, client.WithDialOptions(grpc.WithInsecure()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	atomic.StoreInt32(&server.failures, 1)
+	_, err = client.NewLaptopClient(conn).BatchCreateLaptops(context.Background(), []*pcbook.Laptop{sample.NewLaptop()}, false)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.EqualValues(t, 4, atomic.LoadInt32(&server.calls))
+}
+
+func TestDialDeadlines(t *testing.T) {
+	t.Parallel()
+
+	server := &flakyLaptopServer{LaptopServiceServer: service.NewLaptopServer(service.NewInMemoryLaptopStore(), nil, nil), delay: time.Second}
+	address := startFlakyLaptopServer(t, server)
+
+	conn, err := client.Dial(
+		[]string{address},
+		client.WithDeadlines(map[string]time.Duration{"/pcbook.LaptopService/GetLaptop": 50 * time.Millisecond}),
+		client.WithDialOptions(grpc.WithInsecure()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = client.NewLaptopClient(conn, client.WithTimeout(0)).GetLaptop(context.Background(), sample.NewLaptop().GetId())
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	_, err = client.Dial([]string{address}, client.WithDeadlines(map[string]time.Duration{"GetLaptop": time.Second}))
+	require.Error(t, err)
+}
+
+func TestDialRoundRobin(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	server1 := &flakyLaptopServer{LaptopServiceServer: service.NewLaptopServer(laptopStore, nil, nil)}
+	server2 := &flakyLaptopServer{LaptopServiceServer: service.NewLaptopServer(laptopStore, nil, nil)}
+	addresses := []string{startFlakyLaptopServer(t, server1), startFlakyLaptopServer(t, server2)}
+
+	conn, err := client.Dial(addresses, client.WithDialOptions(grpc.WithInsecure(), grpc.WithBlock()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	laptopClient := client.NewLaptopClient(conn)
+	for i := 0; i < 10; i++ {
+		_, err := laptopClient.GetLaptop(context.Background(), laptop.GetId())
+		require.NoError(t, err)
+	}
+
+	require.NotZero(t, atomic.LoadInt32(&server1.calls))
+	require.NotZero(t, atomic.LoadInt32(&server2.calls))
+	require.EqualValues(t, 10, atomic.LoadInt32(&server1.calls)+atomic.LoadInt32(&server2.calls))
+}
+
+// flakyLaptopServer fails its first calls with Unavailable and may answer slowly
+type flakyLaptopServer struct {
+	*service.LaptopServiceServer
+	failures int32
+	delay    time.Duration
+	calls    int32
+}
+
+func (server *flakyLaptopServer) fail(ctx context.Context) error {
+	atomic.AddInt32(&server.calls, 1)
+	if atomic.AddInt32(&server.failures, -1) >= 0 {
+		return status.Error(codes.Unavailable, "server is restarting")
+	}
+
+	select {
+	case <-ctx.Done():
+		return status.Error(codes.DeadlineExceeded, ctx.Err().Error())
+	case <-time.After(server.delay):
+		return nil
+	}
+}
+
+func (server *flakyLaptopServer) GetLaptop(ctx context.Context, req *pcbook.GetLaptopRequest) (*pcbook.GetLaptopResponse, error) {
+	if err := server.fail(ctx); err != nil {
+		return nil, err
+	}
+	return server.LaptopServiceServer.GetLaptop(ctx, req)
+}
+
+func (server *flakyLaptopServer) CreateLaptop(ctx context.Context, req *pcbook.CreateLaptopRequest) (*pcbook.CreateLaptopResponse, error) {
+	if err := server.fail(ctx); err != nil {
+		return nil, err
+	}
+	return server.LaptopServiceServer.CreateLaptop(ctx, req)
+}
+
+func (server *flakyLaptopServer) BatchCreateLaptops(stream pcbook.LaptopService_BatchCreateLaptopsServer) error {
+	if err := server.fail(stream.Context()); err != nil {
+		return err
+	}
+	return server.LaptopServiceServer.BatchCreateLaptops(stream)
+}
+
+func startFlakyLaptopServer(t *testing.T, server pcbook.LaptopServiceServer) string {
+	grpcServer := grpc.NewServer()
+	pcbook.RegisterLaptopServiceServer(grpcServer, server)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0") // any random available port
+	require.NoError(t, err)
+
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	return listener.Addr().String()
+}
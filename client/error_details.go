@@ -0,0 +1,77 @@
+package client
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDetails are the details the server attached to an error
+type ErrorDetails struct {
+	// Reason identifies the error within Domain, see the Reason constants of the service package
+	Reason   string
+	Domain   string
+	Metadata map[string]string
+	// ResourceType and ResourceName name the missing or conflicting resource, e.g. pcbook.Laptop and its ID
+	ResourceType string
+	ResourceName string
+	// FieldViolations are the invalid fields of the request
+	FieldViolations []FieldViolation
+	// RetryDelay is how long to wait before retrying, 0 if the server did not ask for a delay
+	RetryDelay time.Duration
+}
+
+// FieldViolation is an invalid field of a request, Field is its path, e.g. laptop.cpu.max_ghz
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// DecodeErrorDetails returns the details of an error returned by a call, ok is false if err has no gRPC status
+//
+//	laptop, err := laptopClient.GetLaptop(ctx, id)
+//	if details, ok := client.DecodeErrorDetails(err); ok && details.Reason == service.ReasonLaptopNotFound {
+//	...
+func DecodeErrorDetails(err error) (details *ErrorDetails, ok bool) {
+	st, ok := errorStatus(err)
+	if !ok {
+		return nil, false
+	}
+
+	details = &ErrorDetails{}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			details.Reason = detail.GetReason()
+			details.Domain = detail.GetDomain()
+			details.Metadata = detail.GetMetadata()
+		case *errdetails.ResourceInfo:
+			details.ResourceType = detail.GetResourceType()
+			details.ResourceName = detail.GetResourceName()
+		case *errdetails.BadRequest:
+			for _, violation := range detail.GetFieldViolations() {
+				details.FieldViolations = append(details.FieldViolations, FieldViolation{
+					Field:       violation.GetField(),
+					Description: violation.GetDescription(),
+				})
+			}
+		case *errdetails.RetryInfo:
+			details.RetryDelay = detail.GetRetryDelay().AsDuration()
+		}
+	}
+
+	return details, true
+}
+
+// errorStatus returns the gRPC status of err, looking through the errors it wraps
+func errorStatus(err error) (*status.Status, bool) {
+	var withStatus interface {
+		GRPCStatus() *status.Status
+	}
+	if err == nil || !errors.As(err, &withStatus) {
+		return nil, false
+	}
+	return withStatus.GRPCStatus(), true
+}
@@ -3,9 +3,9 @@ package client
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"time"
@@ -16,112 +16,416 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+const (
+	// DefaultTimeout bounds every call made by a laptop client unless WithTimeout is used
+	DefaultTimeout = 5 * time.Second
+	// DefaultChunkSize is the size of the data chunks sent when uploading an image
+	DefaultChunkSize = 64 << 10
+)
+
+var (
+	// ErrAlreadyExists is returned when a laptop with the same ID already exists
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrNotFound is returned when a laptop or an image does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidArgument is returned when the server rejects the request content
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrAborted is returned when a change was not made because of another one: the laptop changed since
+	// its etag was read, or another laptop of an atomic batch failed
+	ErrAborted = errors.New("aborted")
+	// ErrPermissionDenied is returned when the user is not authenticated or not allowed to call the method
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
 // LaptopClient is a client to call laptop service rpcs
 type LaptopClient struct {
-	service pcbook.LaptopServiceClient
+	service   pcbook.LaptopServiceClient
+	timeout   time.Duration
+	chunkSize int
+}
+
+// LaptopClientOption configures a laptop client
+type LaptopClientOption func(client *LaptopClient)
+
+// WithTimeout sets the timeout of every call, including whole streams, 0 relies on the caller's context only
+func WithTimeout(timeout time.Duration) LaptopClientOption {
+	return func(client *LaptopClient) {
+		client.timeout = timeout
+	}
+}
+
+// WithChunkSize sets the size of the data chunks sent when uploading an image
+func WithChunkSize(chunkSize int) LaptopClientOption {
+	return func(client *LaptopClient) {
+		if chunkSize > 0 {
+			client.chunkSize = chunkSize
+		}
+	}
 }
 
 // NewLaptopClient returns a new laptop client
-func NewLaptopClient(cc *grpc.ClientConn) *LaptopClient {
-	service := pcbook.NewLaptopServiceClient(cc)
-	return &LaptopClient{
-		service: service,
+func NewLaptopClient(cc grpc.ClientConnInterface, opts ...LaptopClientOption) *LaptopClient {
+	client := &LaptopClient{
+		service:   pcbook.NewLaptopServiceClient(cc),
+		timeout:   DefaultTimeout,
+		chunkSize: DefaultChunkSize,
+	}
+
+	for _, opt := range opts {
+		opt(client)
 	}
+
+	return client
 }
 
-// RateLaptop rate a stream of laptops
-func (laptopClient *LaptopClient) RateLaptop(laptopIDs []string, scores []float64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// CreateLaptop creates a laptop and returns its ID
+func (laptopClient *LaptopClient) CreateLaptop(ctx context.Context, laptop *pcbook.Laptop) (string, error) {
+	ctx, cancel := laptopClient.withTimeout(ctx)
 	defer cancel()
 
-	stream, err := laptopClient.service.RateLaptop(ctx)
+	req := &pcbook.CreateLaptopRequest{
+		Laptop: laptop,
+	}
+
+	res, err := laptopClient.service.CreateLaptop(ctx, req)
 	if err != nil {
-		return fmt.Errorf("cannot rate laptop: %v", err)
+		return "", statusErrorf(err, "cannot create laptop")
 	}
 
-	// go routine to receive responses
-	waitResponse := make(chan error)
-	go func() {
-		for {
-			res, err := stream.Recv()
-			if err == io.EOF {
-				log.Print("no more response")
-				waitResponse <- nil
-				return
-			}
-			if err != nil {
-				waitResponse <- fmt.Errorf("cannot receive stream: %v", err)
-			}
+	return res.GetId(), nil
+}
 
-			log.Printf("received response: %v", res)
-		}
-	}()
+// BatchCreateResult is the outcome of creating one laptop of a batch
+type BatchCreateResult struct {
+	ID string
+	// Err is nil if the laptop was created, it matches the sentinel errors with errors.Is
+	Err error
+}
 
-	// send requests
-	for i, laptopID := range laptopIDs {
-		req := &pcbook.RateLaptopRequest{
-			LaptopId: laptopID,
-			Score:    scores[i],
+// BatchCreateLaptops creates many laptops in one stream and returns a result per laptop, in order.
+// If atomic, either every laptop is created or none of them
+func (laptopClient *LaptopClient) BatchCreateLaptops(ctx context.Context, laptops []*pcbook.Laptop, atomic bool) ([]BatchCreateResult, error) {
+	ctx, cancel := laptopClient.withTimeout(ctx)
+	defer cancel()
+
+	stream, err := laptopClient.service.BatchCreateLaptops(ctx)
+	if err != nil {
+		return nil, statusErrorf(err, "cannot create laptops")
+	}
+
+	// io.EOF means the server ended the stream, its status is returned by CloseAndRecv
+	for _, laptop := range laptops {
+		req := &pcbook.BatchCreateLaptopsRequest{
+			Laptop: laptop,
+			Atomic: atomic,
 		}
 
 		err := stream.Send(req)
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return fmt.Errorf("cannot send stream request: %v - %v", err, stream.RecvMsg(nil))
+			return nil, statusErrorf(err, "cannot send laptop")
 		}
+	}
 
-		log.Print("request sent: ", req)
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, statusErrorf(err, "cannot create laptops")
+	}
+	if len(res.GetResults()) != len(laptops) {
+		return nil, fmt.Errorf("cannot create laptops: %d results for %d laptops", len(res.GetResults()), len(laptops))
 	}
 
-	err = stream.CloseSend()
+	results := make([]BatchCreateResult, len(laptops))
+	for _, result := range res.GetResults() {
+		i := result.GetIndex()
+		if int(i) >= len(results) {
+			return nil, fmt.Errorf("cannot create laptops: result for laptop %d of %d", i, len(laptops))
+		}
+
+		results[i].ID = result.GetId()
+		if codes.Code(result.GetCode()) != codes.OK {
+			results[i].Err = statusErrorf(status.Error(codes.Code(result.GetCode()), result.GetMessage()), "cannot create laptop")
+		}
+	}
+
+	return results, nil
+}
+
+// GetLaptop returns a laptop by ID
+func (laptopClient *LaptopClient) GetLaptop(ctx context.Context, id string) (*pcbook.Laptop, error) {
+	laptop, _, err := laptopClient.GetLaptopWithEtag(ctx, id)
+	return laptop, err
+}
+
+// GetLaptopWithEtag returns a laptop by ID and its etag, to update it with IfEtag
+func (laptopClient *LaptopClient) GetLaptopWithEtag(ctx context.Context, id string) (*pcbook.Laptop, string, error) {
+	ctx, cancel := laptopClient.withTimeout(ctx)
+	defer cancel()
+
+	res, err := laptopClient.service.GetLaptop(ctx, &pcbook.GetLaptopRequest{Id: id})
+	if err != nil {
+		return nil, "", statusErrorf(err, "cannot get laptop")
+	}
+
+	return res.GetLaptop(), res.GetEtag(), nil
+}
+
+// AggregateLaptops counts the laptops matching the filter, all of them if nil, per value of their fields.
+// The prices are counted in buckets below each of the ascending priceBounds, the server's defaults if none
+func (laptopClient *LaptopClient) AggregateLaptops(ctx context.Context, filter *pcbook.Filter, priceBounds ...float64) (*pcbook.AggregateLaptopsResponse, error) {
+	ctx, cancel := laptopClient.withTimeout(ctx)
+	defer cancel()
+
+	req := &pcbook.AggregateLaptopsRequest{
+		Filter:         filter,
+		PriceBoundsUsd: priceBounds,
+	}
+	res, err := laptopClient.service.AggregateLaptops(ctx, req)
+	if err != nil {
+		return nil, statusErrorf(err, "cannot aggregate laptops")
+	}
+
+	return res, nil
+}
+
+// CompareLaptops compares the normalized specs of 2 to 5 laptops, the best value of each row is flagged
+func (laptopClient *LaptopClient) CompareLaptops(ctx context.Context, ids ...string) (*pcbook.CompareLaptopsResponse, error) {
+	ctx, cancel := laptopClient.withTimeout(ctx)
+	defer cancel()
+
+	res, err := laptopClient.service.CompareLaptops(ctx, &pcbook.CompareLaptopsRequest{LaptopIds: ids})
+	if err != nil {
+		return nil, statusErrorf(err, "cannot compare laptops")
+	}
+
+	return res, nil
+}
+
+// RecommendOption sets an option of a similar laptops recommendation
+type RecommendOption func(req *pcbook.RecommendSimilarRequest)
+
+// WithConstraints only recommends the laptops matching the filter
+func WithConstraints(filter *pcbook.Filter) RecommendOption {
+	return func(req *pcbook.RecommendSimilarRequest) {
+		req.Filter = filter
+	}
+}
+
+// WithWeights sets the weights of the specs in the similarity, a weight of 0 ignores the spec
+func WithWeights(weights *pcbook.SimilarityWeights) RecommendOption {
+	return func(req *pcbook.RecommendSimilarRequest) {
+		req.Weights = weights
+	}
+}
+
+// RecommendSimilar returns at most limit laptops, the server's default if 0, by decreasing similarity to a laptop
+func (laptopClient *LaptopClient) RecommendSimilar(ctx context.Context, laptopID string, limit uint32, opts ...RecommendOption) ([]*pcbook.Recommendation, error) {
+	ctx, cancel := laptopClient.withTimeout(ctx)
+	defer cancel()
+
+	req := &pcbook.RecommendSimilarRequest{
+		LaptopId: laptopID,
+		Limit:    limit,
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	res, err := laptopClient.service.RecommendSimilar(ctx, req)
+	if err != nil {
+		return nil, statusErrorf(err, "cannot recommend similar laptops")
+	}
+
+	return res.GetRecommendations(), nil
+}
+
+// UpdateOption sets a condition of a laptop update
+type UpdateOption func(req *pcbook.UpdateLaptopRequest)
+
+// IfEtag makes the update fail with ErrAborted if the laptop changed since its etag was read
+func IfEtag(etag string) UpdateOption {
+	return func(req *pcbook.UpdateLaptopRequest) {
+		req.Etag = etag
+	}
+}
+
+// AllowMissing creates the laptop if there is none with its ID
+func AllowMissing() UpdateOption {
+	return func(req *pcbook.UpdateLaptopRequest) {
+		req.AllowMissing = true
+	}
+}
+
+// UpdateLaptop replaces a laptop, the response has its new etag and whether it was created
+func (laptopClient *LaptopClient) UpdateLaptop(ctx context.Context, laptop *pcbook.Laptop, opts ...UpdateOption) (*pcbook.UpdateLaptopResponse, error) {
+	ctx, cancel := laptopClient.withTimeout(ctx)
+	defer cancel()
+
+	req := &pcbook.UpdateLaptopRequest{
+		Laptop: laptop,
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	res, err := laptopClient.service.UpdateLaptop(ctx, req)
+	if err != nil {
+		return nil, statusErrorf(err, "cannot update laptop")
+	}
+
+	return res, nil
+}
+
+// SearchOption sets a criterion of a laptop search
+type SearchOption func(req *pcbook.SearchLaptopRequest)
+
+// WithQuery searches for the laptops matching a free text query, e.g. "thinkpad i7 nvidia", from the most
+// relevant. The filter of the search may then be nil
+func WithQuery(query string) SearchOption {
+	return func(req *pcbook.SearchLaptopRequest) {
+		req.Query = query
+	}
+}
+
+// WithExpression searches for the laptops satisfying a condition on their fields, e.g.
+// cpu.cores >= 8 && (brand == "Dell" || gpus.exists(g, g.memory >= 6GB)). An invalid expression fails
+// with ErrInvalidArgument and a field violation giving the position of the error. The filter may then be nil
+func WithExpression(expression string) SearchOption {
+	return func(req *pcbook.SearchLaptopRequest) {
+		req.Expression = expression
+	}
+}
+
+// SearchLaptop search for a laptops by fiters, the results are read from the returned iterator
+func (laptopClient *LaptopClient) SearchLaptop(ctx context.Context, filter *pcbook.Filter, opts ...SearchOption) (*LaptopIterator, error) {
+	ctx, cancel := laptopClient.withTimeout(ctx)
+
+	req := &pcbook.SearchLaptopRequest{
+		Filter: filter,
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	stream, err := laptopClient.service.SearchLaptop(ctx, req)
 	if err != nil {
-		return fmt.Errorf("cannot close stream send: %v", err)
+		cancel()
+		return nil, statusErrorf(err, "cannot search laptop")
 	}
 
-	err = <-waitResponse
-	return err
+	return &LaptopIterator{
+		stream: stream,
+		cancel: cancel,
+	}, nil
+}
+
+// LaptopIterator iterates over the laptops found by a search
+//
+//	it, err := laptopClient.SearchLaptop(ctx, filter)
+//	...
+//	defer it.Close()
+//	for it.Next() {
+//		laptop := it.Laptop()
+//	}
+//	if err := it.Err(); err != nil {
+//	...
+type LaptopIterator struct {
+	stream pcbook.LaptopService_SearchLaptopClient
+	cancel context.CancelFunc
+	laptop *pcbook.Laptop
+	score  float64
+	err    error
 }
 
-// UploadImage upload an image for an existing laptop
-func (laptopClient *LaptopClient) UploadImage(laptopID string, imagePath string) {
+// Next receives the next laptop, returns false when there are no more laptops or an error happened
+func (it *LaptopIterator) Next() bool {
+	if it.err != nil || it.stream == nil {
+		return false
+	}
+
+	res, err := it.stream.Recv()
+	if err != nil {
+		if err != io.EOF {
+			it.err = statusErrorf(err, "cannot receive search result")
+		}
+		it.Close()
+		return false
+	}
+
+	it.laptop = res.GetLaptop()
+	it.score = res.GetScore()
+	return true
+}
+
+// Laptop returns the laptop received by the last call to Next
+func (it *LaptopIterator) Laptop() *pcbook.Laptop {
+	return it.laptop
+}
+
+// Score returns the relevance of the last laptop for the query of the search, 0 without a query
+func (it *LaptopIterator) Score() float64 {
+	return it.score
+}
+
+// Err returns the error that stopped the iteration, nil if all the laptops were received
+func (it *LaptopIterator) Err() error {
+	return it.err
+}
+
+// Close stops the search, it is safe to call it several times
+func (it *LaptopIterator) Close() {
+	if it.stream != nil {
+		it.cancel()
+		it.stream = nil
+	}
+}
+
+// UploadImage upload an image file for an existing laptop
+func (laptopClient *LaptopClient) UploadImage(ctx context.Context, laptopID string, imagePath string) (*pcbook.UploadImageResponse, error) {
 	file, err := os.Open(imagePath)
 	if err != nil {
-		log.Fatal("cannot open file: ", err)
+		return nil, fmt.Errorf("cannot open image file: %w", err)
 	}
 	defer file.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	return laptopClient.UploadImageFrom(ctx, laptopID, filepath.Ext(imagePath), file)
+}
+
+// UploadImageFrom upload an image read from reader for an existing laptop, imageType is the file extension, e.g. ".jpg"
+func (laptopClient *LaptopClient) UploadImageFrom(ctx context.Context, laptopID string, imageType string, reader io.Reader) (*pcbook.UploadImageResponse, error) {
+	ctx, cancel := laptopClient.withTimeout(ctx)
 	defer cancel()
 
 	stream, err := laptopClient.service.UploadImage(ctx)
 	if err != nil {
-		log.Fatal("cannot upload image: ", err)
-
+		return nil, statusErrorf(err, "cannot upload image")
 	}
 
 	req := &pcbook.UploadImageRequest{
 		Data: &pcbook.UploadImageRequest_Info{
 			Info: &pcbook.ImageInfo{
 				LaptopId:  laptopID,
-				ImageType: filepath.Ext(imagePath),
+				ImageType: imageType,
 			},
 		},
 	}
 
 	err = stream.Send(req)
-	if err != nil {
-		log.Fatal("cannot send image info: ", err, stream.RecvMsg(nil))
+	if err != nil && err != io.EOF {
+		return nil, statusErrorf(err, "cannot send image info")
 	}
 
-	reader := bufio.NewReader(file)
-	buffer := make([]byte, 1024)
+	bufferedReader := bufio.NewReader(reader)
+	buffer := make([]byte, laptopClient.chunkSize)
 
-	for {
-		n, err := reader.Read(buffer)
-		if err == io.EOF {
+	for err == nil {
+		n, readErr := bufferedReader.Read(buffer)
+		if readErr == io.EOF {
 			break
 		}
-		if err != nil {
-			log.Fatal("cannot read chunk into buffer: ", err)
+		if readErr != nil {
+			return nil, fmt.Errorf("cannot read image: %w", readErr)
 		}
 
 		req := &pcbook.UploadImageRequest{
@@ -130,76 +434,168 @@ func (laptopClient *LaptopClient) UploadImage(laptopID string, imagePath string)
 			},
 		}
 
+		// io.EOF means the server ended the stream, its status is returned by CloseAndRecv
 		err = stream.Send(req)
-		if err != nil {
-			log.Fatal("cannot send chunk to server: ", err, stream.RecvMsg(nil))
+		if err != nil && err != io.EOF {
+			return nil, statusErrorf(err, "cannot send image chunk")
 		}
 	}
 
 	res, err := stream.CloseAndRecv()
 	if err != nil {
-		log.Fatal("cannot receive response from server: ", err)
+		return nil, statusErrorf(err, "cannot upload image")
 	}
 
-	log.Printf("image uploaded with id: %s, size: %d", res.GetId(), res.GetSize())
+	return res, nil
 }
 
-// SearchLaptop search for a laptops by fiters
-func (laptopClient *LaptopClient) SearchLaptop(filter *pcbook.Filter) {
-	log.Print("search filter: ", filter)
-	// set timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// DownloadImage writes an image to writer and returns its info
+func (laptopClient *LaptopClient) DownloadImage(ctx context.Context, imageID string, writer io.Writer) (*pcbook.ImageInfo, error) {
+	ctx, cancel := laptopClient.withTimeout(ctx)
 	defer cancel()
 
-	req := &pcbook.SearchLaptopRequest{
-		Filter: filter,
+	stream, err := laptopClient.service.DownloadImage(ctx, &pcbook.DownloadImageRequest{ImageId: imageID})
+	if err != nil {
+		return nil, statusErrorf(err, "cannot download image")
 	}
-	stream, err := laptopClient.service.SearchLaptop(ctx, req)
+
+	res, err := stream.Recv()
 	if err != nil {
-		log.Fatal("cannot search laptop: ", err)
+		return nil, statusErrorf(err, "cannot download image")
 	}
+	info := res.GetInfo()
 
 	for {
 		res, err := stream.Recv()
 		if err == io.EOF {
-			return
+			break
 		}
 		if err != nil {
-			log.Fatal("cannot recieve response: ", err)
+			return nil, statusErrorf(err, "cannot receive image chunk")
 		}
 
-		laptop := res.GetLaptop()
-		log.Print("- found: ", laptop.GetId())
-		log.Print("		+ brand: ", laptop.GetBrand())
-		log.Print("		+ name: ", laptop.GetName())
-		log.Print("		+ cpu cores: ", laptop.Cpu.GetNumberOfCores())
-		log.Print("		+ cpu min ghz: ", laptop.Cpu.GetMinGhz())
-		log.Print("		+ ram: ", laptop.GetRam())
-		log.Print("		+ price: ", laptop.GetPriceUsd())
+		_, err = writer.Write(res.GetDataChunk())
+		if err != nil {
+			return nil, fmt.Errorf("cannot write image: %w", err)
+		}
 	}
-}
 
-// CreateLaptop create a laptop
-func (laptopClient *LaptopClient) CreateLaptop(laptop *pcbook.Laptop) {
+	return info, nil
+}
 
-	req := &pcbook.CreateLaptopRequest{
-		Laptop: laptop,
+// RateLaptop rate a stream of laptops and returns the new rating of each of them
+func (laptopClient *LaptopClient) RateLaptop(ctx context.Context, laptopIDs []string, scores []float64) ([]*pcbook.RateLaptopResponse, error) {
+	if len(laptopIDs) != len(scores) {
+		return nil, fmt.Errorf("%w: %d laptop IDs for %d scores", ErrInvalidArgument, len(laptopIDs), len(scores))
 	}
 
-	// set timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := laptopClient.withTimeout(ctx)
 	defer cancel()
 
-	res, err := laptopClient.service.CreateLaptop(ctx, req)
+	stream, err := laptopClient.service.RateLaptop(ctx)
 	if err != nil {
-		st, ok := status.FromError(err)
-		if ok && st.Code() == codes.AlreadyExists {
-			log.Print("laptop already exists")
-		} else {
-			log.Fatal("cannot create a laptop: ", err)
+		return nil, statusErrorf(err, "cannot rate laptop")
+	}
+
+	// go routine to receive responses
+	type result struct {
+		responses []*pcbook.RateLaptopResponse
+		err       error
+	}
+	waitResponse := make(chan result, 1)
+	go func() {
+		responses := []*pcbook.RateLaptopResponse{}
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				waitResponse <- result{responses: responses}
+				return
+			}
+			if err != nil {
+				waitResponse <- result{err: statusErrorf(err, "cannot receive rating")}
+				return
+			}
+			responses = append(responses, res)
+		}
+	}()
+
+	// send requests, io.EOF means the server ended the stream and its status is received above
+	for i, laptopID := range laptopIDs {
+		req := &pcbook.RateLaptopRequest{
+			LaptopId: laptopID,
+			Score:    scores[i],
 		}
-		return
+
+		err := stream.Send(req)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, statusErrorf(err, "cannot send rating")
+		}
+	}
+
+	err = stream.CloseSend()
+	if err != nil {
+		return nil, statusErrorf(err, "cannot close stream send")
 	}
 
-	log.Printf("created laptop with id: %s", res.Id)
+	res := <-waitResponse
+	return res.responses, res.err
+}
+
+func (laptopClient *LaptopClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if laptopClient.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, laptopClient.timeout)
+}
+
+// statusError is an error returned by the server, it matches the sentinel errors of its code with errors.Is
+// and keeps its gRPC status for status.FromError
+type statusError struct {
+	message string
+	kind    error
+	status  *status.Status
+}
+
+func (err *statusError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", err.message, err.status.Code(), err.status.Message())
+}
+
+func (err *statusError) Unwrap() error {
+	return err.kind
+}
+
+// GRPCStatus returns the status returned by the server
+func (err *statusError) GRPCStatus() *status.Status {
+	return err.status
+}
+
+// statusErrorf describes an error returned by a call, mapping its status code to the sentinel errors
+func statusErrorf(err error, message string) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("%s: %w", message, err)
+	}
+
+	var kind error
+	switch st.Code() {
+	case codes.AlreadyExists:
+		kind = ErrAlreadyExists
+	case codes.NotFound:
+		kind = ErrNotFound
+	case codes.InvalidArgument, codes.OutOfRange:
+		kind = ErrInvalidArgument
+	case codes.Aborted:
+		kind = ErrAborted
+	case codes.Unauthenticated, codes.PermissionDenied:
+		kind = ErrPermissionDenied
+	}
+
+	return &statusError{
+		message: message,
+		kind:    kind,
+		status:  st,
+	}
 }
@@ -0,0 +1,344 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/client"
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLaptopClientCreateAndGetLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptopClient := newTestLaptopClient(t, laptopStore, nil, nil)
+
+	laptop := sample.NewLaptop()
+	id, err := laptopClient.CreateLaptop(context.Background(), laptop)
+	require.NoError(t, err)
+	require.Equal(t, laptop.GetId(), id)
+
+	_, err = laptopClient.CreateLaptop(context.Background(), laptop)
+	require.True(t, errors.Is(err, client.ErrAlreadyExists))
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	other, err := laptopClient.GetLaptop(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, id, other.GetId())
+
+	_, err = laptopClient.GetLaptop(context.Background(), "5ba09e1d-4f3a-4b1a-8d3c-8c0b1d3f7e21")
+	require.True(t, errors.Is(err, client.ErrNotFound))
+}
+
+func TestLaptopClientUpdateLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptopClient := newTestLaptopClient(t, laptopStore, nil, nil)
+
+	laptop := sample.NewLaptop()
+	_, err := laptopClient.UpdateLaptop(context.Background(), laptop)
+	require.True(t, errors.Is(err, client.ErrNotFound))
+
+	res, err := laptopClient.UpdateLaptop(context.Background(), laptop, client.AllowMissing())
+	require.NoError(t, err)
+	require.True(t, res.GetCreated())
+
+	other, etag, err := laptopClient.GetLaptopWithEtag(context.Background(), laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, res.GetEtag(), etag)
+
+	// the second admin editing the same version loses
+	other.PriceUsd = 1000
+	res, err = laptopClient.UpdateLaptop(context.Background(), other, client.IfEtag(etag))
+	require.NoError(t, err)
+	require.False(t, res.GetCreated())
+	require.NotEqual(t, etag, res.GetEtag())
+
+	laptop.PriceUsd = 2000
+	_, err = laptopClient.UpdateLaptop(context.Background(), laptop, client.IfEtag(etag))
+	require.True(t, errors.Is(err, client.ErrAborted))
+	require.Equal(t, codes.Aborted, status.Code(err))
+
+	found, err := laptopClient.GetLaptop(context.Background(), laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, 1000.0, found.GetPriceUsd())
+}
+
+func TestLaptopClientSearchLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	expectedIDs := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = 1000
+		if i%2 == 0 {
+			laptop.PriceUsd = 3000
+		} else {
+			expectedIDs[laptop.GetId()] = true
+		}
+		require.NoError(t, laptopStore.Save(laptop))
+	}
+
+	laptopClient := newTestLaptopClient(t, laptopStore, nil, nil)
+
+	it, err := laptopClient.SearchLaptop(context.Background(), &pcbook.Filter{MaxPriceUsd: 2000})
+	require.NoError(t, err)
+	defer it.Close()
+
+	found := 0
+	for it.Next() {
+		require.True(t, expectedIDs[it.Laptop().GetId()])
+		found++
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, len(expectedIDs), found)
+	require.False(t, it.Next())
+}
+
+func TestLaptopClientSearchLaptopQuery(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	for _, name := range []string{"Thinkpad X1", "Thinkpad P1", "Yoga 9"} {
+		laptop := sample.NewLaptop()
+		laptop.Brand = "Lenovo"
+		laptop.Name = name
+		laptop.PriceUsd = 1000
+		require.NoError(t, laptopStore.Save(laptop))
+	}
+
+	laptopClient := newTestLaptopClient(t, laptopStore, nil, nil)
+
+	it, err := laptopClient.SearchLaptop(context.Background(), nil, client.WithQuery("lenovo thinkp"))
+	require.NoError(t, err)
+	defer it.Close()
+
+	names := []string{}
+	for it.Next() {
+		require.Positive(t, it.Score())
+		names = append(names, it.Laptop().GetName())
+	}
+	require.NoError(t, it.Err())
+	require.ElementsMatch(t, []string{"Thinkpad X1", "Thinkpad P1"}, names)
+}
+
+func TestLaptopClientAggregateLaptops(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	for _, price := range []float64{400, 1200, 1300, 3500} {
+		laptop := sample.NewLaptop()
+		laptop.Brand = "Dell"
+		laptop.Ram = &pcbook.Memory{Value: 16, Unit: pcbook.Memory_GIGABYTE}
+		laptop.PriceUsd = price
+		require.NoError(t, laptopStore.Save(laptop))
+	}
+
+	laptopClient := newTestLaptopClient(t, laptopStore, nil, nil)
+
+	res, err := laptopClient.AggregateLaptops(context.Background(), nil, 1000, 2000)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, res.GetTotal())
+	require.Len(t, res.GetBrands(), 1)
+	require.Equal(t, "Dell", res.GetBrands()[0].GetValue())
+	require.EqualValues(t, 4, res.GetBrands()[0].GetCount())
+	require.Len(t, res.GetRamSizes(), 1)
+	require.Equal(t, "16GB", res.GetRamSizes()[0].GetValue())
+
+	buckets := res.GetPriceBuckets()
+	require.Len(t, buckets, 3)
+	require.Equal(t, []float64{0, 1000}, []float64{buckets[0].GetMinPriceUsd(), buckets[0].GetMaxPriceUsd()})
+	require.Equal(t, []float64{2000, 0}, []float64{buckets[2].GetMinPriceUsd(), buckets[2].GetMaxPriceUsd()})
+	require.Equal(t, []uint32{1, 2, 1}, []uint32{buckets[0].GetCount(), buckets[1].GetCount(), buckets[2].GetCount()})
+
+	res, err = laptopClient.AggregateLaptops(context.Background(), &pcbook.Filter{MaxPriceUsd: 1000})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, res.GetTotal())
+	require.Len(t, res.GetPriceBuckets(), len(service.DefaultPriceBounds)+1)
+
+	_, err = laptopClient.AggregateLaptops(context.Background(), nil, 2000, 1000)
+	require.True(t, errors.Is(err, client.ErrInvalidArgument))
+	details, ok := client.DecodeErrorDetails(err)
+	require.True(t, ok)
+	require.Equal(t, service.ReasonInvalidPriceBounds, details.Reason)
+	require.Equal(t, "price_bounds_usd[1]", details.FieldViolations[0].Field)
+
+	for _, bound := range []float64{math.NaN(), math.Inf(1)} {
+		_, err = laptopClient.AggregateLaptops(context.Background(), nil, 1000, bound)
+		require.True(t, errors.Is(err, client.ErrInvalidArgument), "bound %v", bound)
+		details, ok := client.DecodeErrorDetails(err)
+		require.True(t, ok)
+		require.Equal(t, service.ReasonInvalidPriceBounds, details.Reason)
+		require.Equal(t, "price_bounds_usd[1]", details.FieldViolations[0].Field)
+	}
+}
+
+func TestLaptopClientUploadAndDownloadImage(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopClient := newTestLaptopClient(t, laptopStore, imageStore, nil, client.WithChunkSize(1024))
+
+	imagePath := "../tmp/laptop.jpg"
+	data, err := ioutil.ReadFile(imagePath)
+	require.NoError(t, err)
+
+	res, err := laptopClient.UploadImage(context.Background(), laptop.GetId(), imagePath)
+	require.NoError(t, err)
+	require.NotZero(t, res.GetId())
+	require.EqualValues(t, len(data), res.GetSize())
+
+	var downloaded bytes.Buffer
+	info, err := laptopClient.DownloadImage(context.Background(), res.GetId(), &downloaded)
+	require.NoError(t, err)
+	require.Equal(t, laptop.GetId(), info.GetLaptopId())
+	require.Equal(t, ".jpg", info.GetImageType())
+	require.Equal(t, data, downloaded.Bytes())
+
+	res, err = laptopClient.UploadImageFrom(context.Background(), laptop.GetId(), ".jpg", bytes.NewReader(data))
+	require.NoError(t, err)
+	require.EqualValues(t, len(data), res.GetSize())
+
+	_, err = laptopClient.DownloadImage(context.Background(), "5ba09e1d-4f3a-4b1a-8d3c-8c0b1d3f7e21", ioutil.Discard)
+	require.True(t, errors.Is(err, client.ErrNotFound))
+
+	_, err = laptopClient.UploadImageFrom(context.Background(), "5ba09e1d-4f3a-4b1a-8d3c-8c0b1d3f7e21", ".jpg", bytes.NewReader(data))
+	require.True(t, errors.Is(err, client.ErrNotFound))
+}
+
+func TestDecodeErrorDetails(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptopClient := newTestLaptopClient(t, laptopStore, nil, nil)
+
+	id := "5ba09e1d-4f3a-4b1a-8d3c-8c0b1d3f7e21"
+	_, err := laptopClient.GetLaptop(context.Background(), id)
+	details, ok := client.DecodeErrorDetails(fmt.Errorf("wrapped: %w", err))
+	require.True(t, ok)
+	require.Equal(t, service.ReasonLaptopNotFound, details.Reason)
+	require.Equal(t, service.ErrorDomain, details.Domain)
+	require.Equal(t, "pcbook.Laptop", details.ResourceType)
+	require.Equal(t, id, details.ResourceName)
+
+	laptop := sample.NewLaptop()
+	laptop.PriceUsd = -1
+	_, err = laptopClient.CreateLaptop(context.Background(), laptop)
+	details, ok = client.DecodeErrorDetails(err)
+	require.True(t, ok)
+	require.Equal(t, service.ReasonInvalidLaptop, details.Reason)
+	require.Equal(t, []client.FieldViolation{{Field: "laptop.price_usd", Description: "must not be negative"}}, details.FieldViolations)
+
+	_, ok = client.DecodeErrorDetails(errors.New("not a status"))
+	require.False(t, ok)
+	_, ok = client.DecodeErrorDetails(nil)
+	require.False(t, ok)
+}
+
+func TestLaptopClientRateLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopClient := newTestLaptopClient(t, laptopStore, nil, ratingStore)
+
+	responses, err := laptopClient.RateLaptop(context.Background(), []string{laptop.GetId(), laptop.GetId()}, []float64{8, 10})
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	require.EqualValues(t, 2, responses[1].GetTimesRated())
+	require.Equal(t, 9.0, responses[1].GetAverageScore())
+
+	_, err = laptopClient.RateLaptop(context.Background(), []string{laptop.GetId()}, []float64{42})
+	require.True(t, errors.Is(err, client.ErrInvalidArgument))
+}
+
+func TestLaptopClientBatchCreateLaptops(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	existing := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(existing))
+
+	laptopClient := newTestLaptopClient(t, laptopStore, nil, nil)
+
+	noID := sample.NewLaptop()
+	noID.Id = ""
+	invalidID := sample.NewLaptop()
+	invalidID.Id = "invalid-uuid"
+	laptops := []*pcbook.Laptop{sample.NewLaptop(), existing, invalidID, noID}
+
+	results, err := laptopClient.BatchCreateLaptops(context.Background(), laptops, false)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, laptops[0].GetId(), results[0].ID)
+	require.True(t, errors.Is(results[1].Err, client.ErrAlreadyExists))
+	require.True(t, errors.Is(results[2].Err, client.ErrInvalidArgument))
+	require.NoError(t, results[3].Err)
+	require.NotEmpty(t, results[3].ID)
+
+	found, err := laptopStore.Find(results[3].ID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	// updated_at is set by the server
+	require.True(t, found.GetUpdatedAt().AsTime().After(noID.GetUpdatedAt().AsTime()))
+
+	// an atomic batch with an invalid laptop creates nothing
+	laptops = []*pcbook.Laptop{sample.NewLaptop(), invalidID}
+	results, err = laptopClient.BatchCreateLaptops(context.Background(), laptops, true)
+	require.NoError(t, err)
+	require.True(t, errors.Is(results[0].Err, client.ErrAborted))
+	require.Equal(t, codes.Aborted, status.Code(results[0].Err))
+	require.True(t, errors.Is(results[1].Err, client.ErrInvalidArgument))
+
+	found, err = laptopStore.Find(laptops[0].GetId())
+	require.NoError(t, err)
+	require.Nil(t, found)
+}
+
+func newTestLaptopClient(
+	t *testing.T,
+	laptopStore service.LaptopStore,
+	imageStore service.ImageStore,
+	ratingStore service.RatingStore,
+	opts ...client.LaptopClientOption,
+) *client.LaptopClient {
+	grpcServer := grpc.NewServer()
+	pcbook.RegisterLaptopServiceServer(grpcServer, service.NewLaptopServer(laptopStore, imageStore, ratingStore))
+
+	listener, err := net.Listen("tcp", ":0") // any random available port
+	require.NoError(t, err)
+
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return client.NewLaptopClient(conn, opts...)
+}
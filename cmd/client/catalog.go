@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mikhail-bigun/grpc-app-pcbook/client"
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/serializer"
+)
+
+// defaultImportBatchSize is the number of laptops created per call by an import
+const defaultImportBatchSize = 100
+
+// maxImportBatchSize is the largest batch the server creates, so the largest file an atomic import can create
+const maxImportBatchSize = 1000
+
+// transferResult is the outcome of an export or an import
+type transferResult struct {
+	File     string `json:"file"`
+	Exported int    `json:"exported,omitempty"`
+	Created  int    `json:"created,omitempty"`
+	Skipped  int    `json:"skipped,omitempty"`
+}
+
+func runExport(app *app, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	file := flags.String("f", "", "file to write the laptops to: .ndjson, .jsonl, .ldpb, .bin or .csv, optionally followed by .gz")
+	columns := flags.String("columns", "", "JSON file mapping CSV headers to field paths, e.g. {\"Price\": \"price_usd\"}")
+	repeated := flags.String("repeated", "", fmt.Sprintf("comma separated numbers of CSV columns of the GPUs and storages, %d if not set, e.g. gpus=4,storages=3", serializer.DefaultCSVRepeated))
+	flags.Parse(args)
+
+	if len(*file) == 0 {
+		return fmt.Errorf("export: -f is required")
+	}
+
+	csvOptions, err := loadCSVOptions(*columns)
+	if err != nil {
+		return err
+	}
+	csvOptions.Repeated, err = parseCSVRepeated(*repeated)
+	if err != nil {
+		return err
+	}
+
+	writer, err := serializer.CreateMessageFile(*file, serializer.WithCSVOptions(csvOptions))
+	if err != nil {
+		return err
+	}
+
+	result := transferResult{File: *file}
+	result.Exported, err = exportLaptops(app, writer)
+	closeErr := writer.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// a failed export leaves no truncated file behind
+		os.Remove(*file)
+		return err
+	}
+
+	return app.printer.printValue(table{
+		header: []string{"FILE", "EXPORTED"},
+		rows:   [][]string{{result.File, strconv.Itoa(result.Exported)}},
+	}, result)
+}
+
+// exportLaptops writes every laptop and returns their number. The search stream is not bounded by the
+// command timeout, since a large catalog takes longer to export
+func exportLaptops(app *app, writer *serializer.MessageWriter) (int, error) {
+	conn, err := app.dial()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	laptopClient := client.NewLaptopClient(conn, client.WithTimeout(0))
+
+	// a filter matching every laptop
+	it, err := laptopClient.SearchLaptop(context.Background(), &pcbook.Filter{MaxPriceUsd: math.MaxFloat64})
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+
+	exported := 0
+	for it.Next() {
+		err := writer.Write(it.Laptop())
+		if err != nil {
+			return exported, err
+		}
+		exported++
+	}
+	return exported, it.Err()
+}
+
+func runImport(app *app, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	file := flags.String("f", "", "file to read the laptops from: .ndjson, .jsonl, .ldpb, .bin or .csv, optionally followed by .gz")
+	columns := flags.String("columns", "", "JSON file mapping CSV headers to field paths, e.g. {\"Price\": \"price_usd\"}")
+	batchSize := flags.Int("batch", defaultImportBatchSize, fmt.Sprintf("number of laptops created per call, at most %d", maxImportBatchSize))
+	atomic := flags.Bool("atomic", false, fmt.Sprintf("create every laptop of the file in one batch or none of them, for files of at most %d laptops", maxImportBatchSize))
+	flags.Parse(args)
+
+	if len(*file) == 0 {
+		return fmt.Errorf("import: -f is required")
+	}
+	if *batchSize <= 0 || *batchSize > maxImportBatchSize {
+		return fmt.Errorf("import: -batch must be between 1 and %d", maxImportBatchSize)
+	}
+
+	csvOptions, err := loadCSVOptions(*columns)
+	if err != nil {
+		return err
+	}
+
+	reader, err := serializer.OpenMessageFile(*file, serializer.WithCSVOptions(csvOptions))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// a create failing with Unavailable is retried, if the failed attempt had in fact saved a laptop,
+	// the retry fails with ErrAlreadyExists and the laptop is skipped
+	retryPolicy := client.DefaultRetryPolicy.WithMethods(
+		"/pcbook.LaptopService/CreateLaptop",
+		"/pcbook.LaptopService/BatchCreateLaptops",
+	)
+	laptopClient, conn, err := app.laptopClient(client.WithRetryPolicy(retryPolicy))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// laptops already in the catalog are skipped, so an interrupted import can be run again
+	result := transferResult{File: *file}
+	create := func(laptops []*pcbook.Laptop) error {
+		results, err := laptopClient.BatchCreateLaptops(context.Background(), laptops, *atomic)
+		if err != nil {
+			return err
+		}
+
+		// the laptops aborted by an atomic batch are not the cause of its failure
+		offset := result.Created + result.Skipped
+		var failure error
+		for i, created := range results {
+			switch {
+			case created.Err == nil:
+				result.Created++
+			case errors.Is(created.Err, client.ErrAlreadyExists) && !*atomic:
+				result.Skipped++
+			case failure == nil && !errors.Is(created.Err, client.ErrAborted):
+				failure = fmt.Errorf("laptop %d (%s): %w", offset+i+1, laptops[i].GetId(), created.Err)
+			}
+		}
+		return failure
+	}
+
+	batch := []*pcbook.Laptop{}
+	for {
+		laptop := &pcbook.Laptop{}
+		err := reader.Read(laptop)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// the laptops without an ID get one here, so that a retried create does not save them twice
+		if len(laptop.GetId()) == 0 {
+			laptop.Id = uuid.New().String()
+		}
+
+		batch = append(batch, laptop)
+		if *atomic && len(batch) > maxImportBatchSize {
+			return fmt.Errorf("import: -atomic creates at most %d laptops, %s has more: import it without -atomic", maxImportBatchSize, *file)
+		}
+		if len(batch) == *batchSize && !*atomic {
+			err := create(batch)
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		err := create(batch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return app.printer.printValue(table{
+		header: []string{"FILE", "CREATED", "SKIPPED"},
+		rows:   [][]string{{result.File, strconv.Itoa(result.Created), strconv.Itoa(result.Skipped)}},
+	}, result)
+}
+
+// parseCSVRepeated parses the numbers of CSV columns of repeated fields, such as gpus=4,storages=3
+func parseCSVRepeated(text string) (map[string]int, error) {
+	repeated := map[string]int{}
+	if len(text) == 0 {
+		return repeated, nil
+	}
+
+	for _, pair := range strings.Split(text, ",") {
+		name, value := pair, ""
+		if i := strings.Index(pair, "="); i >= 0 {
+			name, value = pair[:i], pair[i+1:]
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("export: invalid number of columns of %s %q", name, value)
+		}
+		repeated[strings.TrimSpace(name)] = count
+	}
+	return repeated, nil
+}
+
+// loadCSVOptions reads the mapping of CSV headers to field paths, none if path is empty
+func loadCSVOptions(path string) (serializer.CSVOptions, error) {
+	options := serializer.CSVOptions{}
+	if len(path) == 0 {
+		return options, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return options, fmt.Errorf("cannot read column map: %w", err)
+	}
+
+	err = json.Unmarshal(data, &options.Columns)
+	if err != nil {
+		return options, fmt.Errorf("cannot parse column map %s: %w", path, err)
+	}
+	return options, nil
+}
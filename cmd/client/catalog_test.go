@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/serializer"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunImportBatchLimit(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "laptops.ndjson")
+	writer, err := serializer.CreateMessageFile(file)
+	require.NoError(t, err)
+	for i := 0; i <= maxImportBatchSize; i++ {
+		require.NoError(t, writer.Write(sample.NewLaptop()))
+	}
+	require.NoError(t, writer.Close())
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	app, _ := newTestApp(t, laptopStore)
+	countLaptops := func() int {
+		facets, err := laptopStore.Aggregate(nil, nil)
+		require.NoError(t, err)
+		return facets.Total
+	}
+
+	err = runImport(app, []string{"-f", file, "-atomic"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "-atomic creates at most 1000 laptops")
+	require.Zero(t, countLaptops())
+
+	err = runImport(app, []string{"-f", file, "-batch", "5000"})
+	require.EqualError(t, err, "import: -batch must be between 1 and 1000")
+
+	require.NoError(t, runImport(app, []string{"-f", file, "-batch", "500"}))
+	require.Equal(t, maxImportBatchSize+1, countLaptops())
+}
+
+func TestRunExportCSVRepeated(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	laptop.Storages = append(laptop.Storages, sample.NewHDD())
+	require.NoError(t, laptopStore.Save(laptop))
+	app, _ := newTestApp(t, laptopStore)
+
+	file := filepath.Join(t.TempDir(), "laptops.csv")
+	err := runExport(app, []string{"-f", file})
+	require.EqualError(t, err, "cannot write csv row: storages has 3 elements, more than its 2 columns")
+	require.NoFileExists(t, file)
+
+	// the export stream is not bounded by the command timeout
+	app.timeout = time.Nanosecond
+	require.NoError(t, runExport(app, []string{"-f", file, "-repeated", "storages=3"}))
+	reader, err := serializer.OpenMessageFile(file)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	other := &pcbook.Laptop{}
+	require.NoError(t, reader.Read(other))
+	require.Len(t, other.GetStorages(), 3)
+
+	err = runExport(app, []string{"-f", file, "-repeated", "storages=many"})
+	require.EqualError(t, err, `export: invalid number of columns of storages "many"`)
+}
@@ -0,0 +1,756 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/client"
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/serializer"
+	"google.golang.org/protobuf/proto"
+)
+
+func runLogin(app *app, args []string) error {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	save := flags.Bool("save", true, "save the access token to the config file")
+	flags.Parse(args)
+
+	if len(app.cfg.Username) == 0 || len(app.cfg.Password) == 0 {
+		return fmt.Errorf("username and password are required to log in")
+	}
+
+	transport, err := app.transportOption()
+	if err != nil {
+		return err
+	}
+	conn, err := client.Dial(app.addresses(), client.WithDialOptions(transport))
+	if err != nil {
+		return fmt.Errorf("cannot dial server: %w", err)
+	}
+	defer conn.Close()
+
+	accessToken, err := client.NewAuthClient(conn, app.cfg.Username, app.cfg.Password).Login()
+	if err != nil {
+		return fmt.Errorf("cannot log in: %w", err)
+	}
+
+	if *save {
+		cfg, err := loadConfig(app.configPath)
+		if err != nil {
+			return err
+		}
+		cfg.Address = app.cfg.Address
+		cfg.Username = app.cfg.Username
+		cfg.AccessToken = accessToken
+		err = saveConfig(app.configPath, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	res := &pcbook.LoginResponse{AccessToken: accessToken}
+	return app.printer.print(table{
+		header: []string{"USERNAME", "ACCESS TOKEN"},
+		rows:   [][]string{{app.cfg.Username, accessToken}},
+	}, res)
+}
+
+func runLaptop(app *app, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("laptop: expected a subcommand: create, get, update, search, facets, compare or similar")
+	}
+
+	switch args[0] {
+	case "create":
+		return runLaptopCreate(app, args[1:])
+	case "get":
+		return runLaptopGet(app, args[1:])
+	case "update":
+		return runLaptopUpdate(app, args[1:])
+	case "search":
+		return runLaptopSearch(app, args[1:])
+	case "facets":
+		return runLaptopFacets(app, args[1:])
+	case "compare":
+		return runLaptopCompare(app, args[1:])
+	case "similar":
+		return runLaptopSimilar(app, args[1:])
+	default:
+		return fmt.Errorf("laptop: unknown subcommand %q", args[0])
+	}
+}
+
+func runLaptopCreate(app *app, args []string) error {
+	flags := flag.NewFlagSet("laptop create", flag.ExitOnError)
+	file := flags.String("f", "", "JSON, or protobuf text format if named *.txtpb or *.textproto, file of the laptop to create")
+	random := flags.Bool("random", false, "create a random sample laptop")
+	flags.Parse(args)
+
+	laptop := &pcbook.Laptop{}
+	switch {
+	case len(*file) > 0:
+		err := readLaptopFile(*file, laptop)
+		if err != nil {
+			return err
+		}
+	case *random:
+		laptop = sample.NewLaptop()
+	default:
+		return fmt.Errorf("laptop create: either -f or -random is required")
+	}
+
+	laptopClient, conn, err := app.laptopClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	id, err := laptopClient.CreateLaptop(context.Background(), laptop)
+	if err != nil {
+		return err
+	}
+
+	return app.printer.print(table{
+		header: []string{"ID"},
+		rows:   [][]string{{id}},
+	}, &pcbook.CreateLaptopResponse{Id: id})
+}
+
+func runLaptopGet(app *app, args []string) error {
+	flags := flag.NewFlagSet("laptop get", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("laptop get: expected a laptop ID")
+	}
+
+	laptopClient, conn, err := app.laptopClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	laptop, etag, err := laptopClient.GetLaptopWithEtag(context.Background(), flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	t := laptopTable(laptop)
+	t.header = append(t.header, "ETAG")
+	t.rows[0] = append(t.rows[0], etag)
+	return app.printer.print(t, laptop)
+}
+
+func runLaptopUpdate(app *app, args []string) error {
+	flags := flag.NewFlagSet("laptop update", flag.ExitOnError)
+	file := flags.String("f", "", "JSON, or protobuf text format if named *.txtpb or *.textproto, file of the laptop to update")
+	etag := flags.String("etag", "", "etag the laptop must still have, as printed by laptop get")
+	allowMissing := flags.Bool("allow-missing", false, "create the laptop if it does not exist")
+	flags.Parse(args)
+
+	if len(*file) == 0 {
+		return fmt.Errorf("laptop update: -f is required")
+	}
+
+	laptop := &pcbook.Laptop{}
+	err := readLaptopFile(*file, laptop)
+	if err != nil {
+		return err
+	}
+
+	opts := []client.UpdateOption{}
+	if len(*etag) > 0 {
+		opts = append(opts, client.IfEtag(*etag))
+	}
+	if *allowMissing {
+		opts = append(opts, client.AllowMissing())
+	}
+
+	laptopClient, conn, err := app.laptopClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	res, err := laptopClient.UpdateLaptop(context.Background(), laptop, opts...)
+	if err != nil {
+		return err
+	}
+
+	return app.printer.print(table{
+		header: []string{"ID", "ETAG", "CREATED"},
+		rows:   [][]string{{res.GetId(), res.GetEtag(), strconv.FormatBool(res.GetCreated())}},
+	}, res)
+}
+
+// readLaptopFile reads a laptop from JSON, or from protobuf text format if named *.txtpb or *.textproto
+func readLaptopFile(file string, laptop *pcbook.Laptop) error {
+	read := serializer.ReadProtobufFromJSONFile
+	switch filepath.Ext(file) {
+	case ".txtpb", ".textproto":
+		read = serializer.ReadProtobufFromTextFile
+	}
+
+	err := read(file, laptop)
+	if err != nil {
+		return fmt.Errorf("cannot load laptop file %s: %w", file, err)
+	}
+	return nil
+}
+
+func runLaptopSearch(app *app, args []string) error {
+	flags := flag.NewFlagSet("laptop search", flag.ExitOnError)
+	filterFlags := newFilterFlags(flags)
+	query := flags.String("q", "", "free text query on the brand, name, CPU and GPU, e.g. \"thinkpad i7\"")
+	expression := flags.String("expr", "", "condition on the laptop fields, e.g. 'cpu.cores >= 8 && brand == \"Dell\"'")
+	flags.Parse(args)
+
+	filter, err := filterFlags.filter()
+	if err != nil {
+		return err
+	}
+
+	opts := []client.SearchOption{}
+	if len(*query) > 0 {
+		opts = append(opts, client.WithQuery(*query))
+	}
+	if len(*expression) > 0 {
+		opts = append(opts, client.WithExpression(*expression))
+	}
+	if filter == nil && len(opts) == 0 {
+		// without a query or an expression the filter is required, this one matches every laptop
+		filter = &pcbook.Filter{MaxPriceUsd: math.MaxFloat64}
+	}
+
+	laptopClient, conn, err := app.laptopClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	it, err := laptopClient.SearchLaptop(context.Background(), filter, opts...)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	laptops := []*pcbook.Laptop{}
+	scores := []float64{}
+	for it.Next() {
+		laptops = append(laptops, it.Laptop())
+		scores = append(scores, it.Score())
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	if len(*query) == 0 {
+		return printLaptops(app, laptops)
+	}
+
+	t := laptopTable(laptops...)
+	t.header = append(t.header, "SCORE")
+	for i := range t.rows {
+		t.rows[i] = append(t.rows[i], strconv.FormatFloat(scores[i], 'f', 2, 64))
+	}
+	messages := make([]proto.Message, len(laptops))
+	for i := range laptops {
+		messages[i] = &pcbook.SearchLaptopResponse{Laptop: laptops[i], Score: scores[i]}
+	}
+	return app.printer.printList(t, messages)
+}
+
+func runLaptopFacets(app *app, args []string) error {
+	flags := flag.NewFlagSet("laptop facets", flag.ExitOnError)
+	filterFlags := newFilterFlags(flags)
+	bounds := flags.String("price-bounds", "", "comma separated upper bounds of the price buckets in USD, e.g. 1000,2000")
+	flags.Parse(args)
+
+	filter, err := filterFlags.filter()
+	if err != nil {
+		return err
+	}
+
+	priceBounds := []float64{}
+	if len(*bounds) > 0 {
+		for _, text := range strings.Split(*bounds, ",") {
+			bound, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+			if err != nil {
+				return fmt.Errorf("laptop facets: invalid price bound %q: %w", text, err)
+			}
+			priceBounds = append(priceBounds, bound)
+		}
+	}
+
+	laptopClient, conn, err := app.laptopClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	res, err := laptopClient.AggregateLaptops(context.Background(), filter, priceBounds...)
+	if err != nil {
+		return err
+	}
+
+	t := table{
+		header: []string{"FACET", "VALUE", "COUNT"},
+		rows:   [][]string{{"total", "", strconv.FormatUint(uint64(res.GetTotal()), 10)}},
+	}
+	for _, facet := range []struct {
+		name   string
+		counts []*pcbook.FacetCount
+	}{
+		{name: "brand", counts: res.GetBrands()},
+		{name: "cpu brand", counts: res.GetCpuBrands()},
+		{name: "gpu brand", counts: res.GetGpuBrands()},
+		{name: "ram", counts: res.GetRamSizes()},
+		{name: "panel", counts: res.GetScreenPanels()},
+		{name: "layout", counts: res.GetKeyboardLayouts()},
+	} {
+		for _, count := range facet.counts {
+			t.rows = append(t.rows, []string{facet.name, count.GetValue(), strconv.FormatUint(uint64(count.GetCount()), 10)})
+		}
+	}
+	for _, bucket := range res.GetPriceBuckets() {
+		t.rows = append(t.rows, []string{"price usd", formatPriceBucket(bucket), strconv.FormatUint(uint64(bucket.GetCount()), 10)})
+	}
+
+	return app.printer.print(t, res)
+}
+
+// formatPriceBucket formats a bucket as a range of prices, e.g. 1000-1500 or 3000+
+func formatPriceBucket(bucket *pcbook.PriceBucket) string {
+	min := strconv.FormatFloat(bucket.GetMinPriceUsd(), 'f', -1, 64)
+	if bucket.GetMaxPriceUsd() == 0 {
+		return min + "+"
+	}
+	return min + "-" + strconv.FormatFloat(bucket.GetMaxPriceUsd(), 'f', -1, 64)
+}
+
+func runLaptopCompare(app *app, args []string) error {
+	flags := flag.NewFlagSet("laptop compare", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() < 2 || flags.NArg() > 5 {
+		return fmt.Errorf("laptop compare: expected 2 to 5 laptop IDs")
+	}
+
+	laptopClient, conn, err := app.laptopClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	res, err := laptopClient.CompareLaptops(context.Background(), flags.Args()...)
+	if err != nil {
+		return err
+	}
+
+	return app.printer.print(comparisonTable(res), res)
+}
+
+// comparisonTable renders a comparison with a column per laptop, the best values are marked with a *
+func comparisonTable(res *pcbook.CompareLaptopsResponse) table {
+	t := table{
+		header: []string{"SPEC"},
+		rows:   [][]string{{"id"}},
+	}
+	for _, laptop := range res.GetLaptops() {
+		t.header = append(t.header, strings.ToUpper(laptop.GetBrand()+" "+laptop.GetName()))
+		t.rows[0] = append(t.rows[0], laptop.GetId())
+	}
+
+	for _, row := range res.GetRows() {
+		cells := []string{row.GetName()}
+		for _, cell := range row.GetCells() {
+			if cell.GetMissing() {
+				cells = append(cells, "-")
+				continue
+			}
+
+			text := strconv.FormatFloat(math.Round(cell.GetValue()*100)/100, 'f', -1, 64)
+			if len(row.GetUnit()) > 0 {
+				text += " " + row.GetUnit()
+			}
+			if cell.GetBest() {
+				text += " *"
+			}
+			cells = append(cells, text)
+		}
+		t.rows = append(t.rows, cells)
+	}
+	return t
+}
+
+func runLaptopSimilar(app *app, args []string) error {
+	flags := flag.NewFlagSet("laptop similar", flag.ExitOnError)
+	limit := flags.Uint("n", 0, "maximum number of laptops, the server's default if 0")
+	filterFlags := newFilterFlags(flags)
+	weightsText := flags.String("weights", "", "comma separated weights of the specs, 1 if not set, e.g. price=2,rating=0 (specs: "+
+		strings.Join(similarityWeightNames, ", ")+")")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("laptop similar: expected a laptop ID")
+	}
+
+	filter, err := filterFlags.filter()
+	if err != nil {
+		return err
+	}
+	opts := []client.RecommendOption{client.WithConstraints(filter)}
+	if len(*weightsText) > 0 {
+		weights, err := parseSimilarityWeights(*weightsText)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, client.WithWeights(weights))
+	}
+
+	laptopClient, conn, err := app.laptopClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	recommendations, err := laptopClient.RecommendSimilar(context.Background(), flags.Arg(0), uint32(*limit), opts...)
+	if err != nil {
+		return err
+	}
+
+	laptops := make([]*pcbook.Laptop, len(recommendations))
+	messages := make([]proto.Message, len(recommendations))
+	for i, recommendation := range recommendations {
+		laptops[i] = recommendation.GetLaptop()
+		messages[i] = recommendation
+	}
+	t := laptopTable(laptops...)
+	t.header = append(t.header, "SIMILARITY")
+	for i := range t.rows {
+		t.rows[i] = append(t.rows[i], strconv.FormatFloat(recommendations[i].GetSimilarity(), 'f', 3, 64))
+	}
+	return app.printer.printList(t, messages)
+}
+
+// similarityWeightNames are the names of the specs of the -weights flag
+var similarityWeightNames = []string{"cores", "ghz", "ram", "storage", "screen", "weight", "price", "rating"}
+
+// parseSimilarityWeights parses comma separated spec=weight pairs, the weights not set are 1
+func parseSimilarityWeights(text string) (*pcbook.SimilarityWeights, error) {
+	weights := &pcbook.SimilarityWeights{CpuCores: 1, CpuGhz: 1, Ram: 1, Storage: 1, ScreenSize: 1, Weight: 1, Price: 1, Rating: 1}
+	fields := map[string]*float64{
+		"cores":   &weights.CpuCores,
+		"ghz":     &weights.CpuGhz,
+		"ram":     &weights.Ram,
+		"storage": &weights.Storage,
+		"screen":  &weights.ScreenSize,
+		"weight":  &weights.Weight,
+		"price":   &weights.Price,
+		"rating":  &weights.Rating,
+	}
+
+	for _, pair := range strings.Split(text, ",") {
+		name, value := pair, ""
+		if i := strings.Index(pair, "="); i >= 0 {
+			name, value = pair[:i], pair[i+1:]
+		}
+		field, ok := fields[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("laptop similar: unknown spec %q, expected one of %s", name, strings.Join(similarityWeightNames, ", "))
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("laptop similar: invalid weight of %s %q: %w", name, value, err)
+		}
+		*field = weight
+	}
+	return weights, nil
+}
+
+// filterFlags are the flags of a search filter
+type filterFlags struct {
+	flags    *flag.FlagSet
+	maxPrice *float64
+	minCores *uint
+	minGhz   *float64
+	minRAM   *string
+}
+
+func newFilterFlags(flags *flag.FlagSet) *filterFlags {
+	return &filterFlags{
+		flags:    flags,
+		maxPrice: flags.Float64("max-price", 0, "maximum price in USD"),
+		minCores: flags.Uint("min-cores", 0, "minimum number of CPU cores"),
+		minGhz:   flags.Float64("min-ghz", 0, "minimum CPU frequency in GHz"),
+		minRAM:   flags.String("min-ram", "", "minimum RAM, e.g. 16GB"),
+	}
+}
+
+// filter returns the filter of the parsed flags, nil if none of them is set
+func (f *filterFlags) filter() (*pcbook.Filter, error) {
+	set, maxPriceSet := false, false
+	f.flags.Visit(func(flag *flag.Flag) {
+		switch flag.Name {
+		case "max-price":
+			set, maxPriceSet = true, true
+		case "min-cores", "min-ghz", "min-ram":
+			set = true
+		}
+	})
+	if !set {
+		return nil, nil
+	}
+
+	filter := &pcbook.Filter{
+		// without -max-price the price is not limited
+		MaxPriceUsd: math.MaxFloat64,
+		MinCpuCores: uint32(*f.minCores),
+		MinCpuGhz:   *f.minGhz,
+	}
+	if maxPriceSet {
+		filter.MaxPriceUsd = *f.maxPrice
+	}
+	if len(*f.minRAM) > 0 {
+		ram, err := serializer.ParseMemory(*f.minRAM)
+		if err != nil {
+			return nil, err
+		}
+		filter.MinRam = ram
+	}
+	return filter, nil
+}
+
+func runImage(app *app, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("image: expected a subcommand: upload, bulk-upload or download")
+	}
+
+	switch args[0] {
+	case "upload":
+		return runImageUpload(app, args[1:])
+	case "bulk-upload":
+		return runImageBulkUpload(app, args[1:])
+	case "download":
+		return runImageDownload(app, args[1:])
+	default:
+		return fmt.Errorf("image: unknown subcommand %q", args[0])
+	}
+}
+
+func runImageUpload(app *app, args []string) error {
+	flags := flag.NewFlagSet("image upload", flag.ExitOnError)
+	laptopID := flags.String("laptop-id", "", "ID of the laptop")
+	imagePath := flags.String("f", "", "image file to upload")
+	flags.Parse(args)
+
+	if len(*laptopID) == 0 || len(*imagePath) == 0 {
+		return fmt.Errorf("image upload: -laptop-id and -f are required")
+	}
+
+	laptopClient, conn, err := app.laptopClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	res, err := laptopClient.UploadImage(context.Background(), *laptopID, *imagePath)
+	if err != nil {
+		return err
+	}
+
+	return app.printer.print(table{
+		header: []string{"ID", "SIZE"},
+		rows:   [][]string{{res.GetId(), strconv.FormatUint(uint64(res.GetSize()), 10)}},
+	}, res)
+}
+
+func runImageBulkUpload(app *app, args []string) error {
+	flags := flag.NewFlagSet("image bulk-upload", flag.ExitOnError)
+	dir := flags.String("dir", "", "directory holding a sub directory of images per laptop, named by the laptop ID")
+	manifest := flags.String("manifest", "", "JSON manifest mapping laptop IDs to image files")
+	retry := flags.String("retry", "", "summary of a previous bulk upload, to upload its failures again")
+	workers := flags.Int("workers", client.DefaultUploadWorkers, "number of images uploaded concurrently")
+	summaryPath := flags.String("summary", "upload-summary.json", "file to write the summary to, for -retry")
+	flags.Parse(args)
+
+	var uploads []client.ImageUpload
+	var err error
+	switch {
+	case len(*dir) > 0:
+		uploads, err = client.ImageUploadsFromDir(*dir)
+	case len(*manifest) > 0:
+		uploads, err = client.ReadImageManifest(*manifest)
+	case len(*retry) > 0:
+		var previous *client.BulkUploadSummary
+		previous, err = client.ReadBulkUploadSummary(*retry)
+		if err == nil {
+			uploads = previous.Failures()
+		}
+	default:
+		return fmt.Errorf("image bulk-upload: one of -dir, -manifest or -retry is required")
+	}
+	if err != nil {
+		return err
+	}
+
+	laptopClient, conn, err := app.laptopClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// progress goes to stderr, so the output can still be piped
+	summary := laptopClient.UploadImages(context.Background(), uploads,
+		client.WithUploadWorkers(*workers),
+		client.WithUploadProgress(func(progress client.BulkUploadProgress) {
+			fmt.Fprintf(os.Stderr, "\r%d/%d uploaded, %d failed, %.1f KB/s",
+				progress.Succeeded, progress.Total, progress.Failed, progress.Throughput()/1024)
+		}),
+	)
+	if len(uploads) > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+
+	err = client.WriteBulkUploadSummary(*summaryPath, summary)
+	if err != nil {
+		return err
+	}
+
+	t := table{header: []string{"LAPTOP ID", "FILE", "IMAGE ID", "SIZE", "ERROR"}}
+	for _, result := range summary.Results {
+		t.rows = append(t.rows, []string{
+			result.LaptopID,
+			result.Path,
+			result.ImageID,
+			strconv.FormatUint(uint64(result.Size), 10),
+			result.Error,
+		})
+	}
+	err = app.printer.printValue(t, summary)
+	if err != nil {
+		return err
+	}
+
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d of %d uploads failed, run again with -retry %s", summary.Failed, len(uploads), *summaryPath)
+	}
+	return nil
+}
+
+func runImageDownload(app *app, args []string) error {
+	flags := flag.NewFlagSet("image download", flag.ExitOnError)
+	output := flags.String("output", "", "file to write the image to, defaults to <image-id><image-type>")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("image download: expected an image ID")
+	}
+	imageID := flags.Arg(0)
+
+	laptopClient, conn, err := app.laptopClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// the image is buffered since its type, needed for the default file name, comes with the data
+	var data bytes.Buffer
+	info, err := laptopClient.DownloadImage(context.Background(), imageID, &data)
+	if err != nil {
+		return err
+	}
+
+	path := *output
+	if len(path) == 0 {
+		path = imageID + info.GetImageType()
+	}
+
+	size := data.Len()
+	err = ioutil.WriteFile(path, data.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("cannot write image file: %w", err)
+	}
+
+	return app.printer.print(table{
+		header: []string{"ID", "LAPTOP ID", "FILE", "SIZE"},
+		rows:   [][]string{{imageID, info.GetLaptopId(), path, strconv.Itoa(size)}},
+	}, info)
+}
+
+func runRate(app *app, args []string) error {
+	flags := flag.NewFlagSet("rate", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() == 0 || flags.NArg()%2 != 0 {
+		return fmt.Errorf("rate: expected pairs of laptop ID and score")
+	}
+
+	laptopIDs := []string{}
+	scores := []float64{}
+	for i := 0; i < flags.NArg(); i += 2 {
+		score, err := strconv.ParseFloat(flags.Arg(i+1), 64)
+		if err != nil {
+			return fmt.Errorf("rate: invalid score %q: %w", flags.Arg(i+1), err)
+		}
+		laptopIDs = append(laptopIDs, flags.Arg(i))
+		scores = append(scores, score)
+	}
+
+	laptopClient, conn, err := app.laptopClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	responses, err := laptopClient.RateLaptop(context.Background(), laptopIDs, scores)
+	if err != nil {
+		return err
+	}
+
+	t := table{header: []string{"LAPTOP ID", "TIMES RATED", "AVERAGE SCORE"}}
+	for _, res := range responses {
+		t.rows = append(t.rows, []string{
+			res.GetLaptopId(),
+			strconv.FormatUint(uint64(res.GetTimesRated()), 10),
+			strconv.FormatFloat(res.GetAverageScore(), 'f', 2, 64),
+		})
+	}
+
+	messages := make([]proto.Message, len(responses))
+	for i := range responses {
+		messages[i] = responses[i]
+	}
+	return app.printer.printList(t, messages)
+}
+
+func laptopTable(laptops ...*pcbook.Laptop) table {
+	t := table{
+		header: []string{"ID", "BRAND", "NAME", "CPU", "CORES", "GHZ", "RAM", "PRICE USD"},
+	}
+	for _, laptop := range laptops {
+		t.rows = append(t.rows, []string{
+			laptop.GetId(),
+			laptop.GetBrand(),
+			laptop.GetName(),
+			laptop.GetCpu().GetName(),
+			strconv.FormatUint(uint64(laptop.GetCpu().GetNumberOfCores()), 10),
+			strconv.FormatFloat(laptop.GetCpu().GetMinGhz(), 'f', 2, 64),
+			serializer.FormatMemory(laptop.GetRam()),
+			strconv.FormatFloat(laptop.GetPriceUsd(), 'f', 2, 64),
+		})
+	}
+	return t
+}
+
+func printLaptops(app *app, laptops []*pcbook.Laptop) error {
+	messages := make([]proto.Message, len(laptops))
+	for i := range laptops {
+		messages[i] = laptops[i]
+	}
+	return app.printer.printList(laptopTable(laptops...), messages)
+}
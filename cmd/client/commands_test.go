@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestRunLaptopSearchWithoutFilter(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, laptopStore.Save(sample.NewLaptop()))
+	}
+	app, out := newTestApp(t, laptopStore)
+
+	require.NoError(t, runLaptop(app, []string{"search"}))
+	require.Len(t, decodeList(t, out), 3)
+}
+
+func TestRunLaptopFilterFlags(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ids := []string{}
+	for _, cores := range []uint32{2, 4, 8} {
+		laptop := sample.NewLaptop()
+		laptop.Brand = "Lenovo"
+		laptop.Cpu.NumberOfCores = cores
+		laptop.Cpu.NumberOfThreads = cores * 2
+		laptop.PriceUsd = 1500
+		require.NoError(t, laptopStore.Save(laptop))
+		ids = append(ids, laptop.GetId())
+	}
+
+	for _, args := range [][]string{
+		{"search", "-min-cores", "4"},
+		{"search", "-q", "lenovo", "-min-cores", "4"},
+		{"search", "-expr", "price > 1000", "-min-cores", "4"},
+		{"search", "-max-price", "2000", "-min-cores", "4"},
+	} {
+		app, out := newTestApp(t, laptopStore)
+		require.NoError(t, runLaptop(app, args), "%v", args)
+		require.Len(t, decodeList(t, out), 2, "%v", args)
+	}
+
+	app, out := newTestApp(t, laptopStore)
+	require.NoError(t, runLaptop(app, []string{"search", "-max-price", "1000", "-min-cores", "4"}))
+	require.Empty(t, decodeList(t, out))
+
+	app, out = newTestApp(t, laptopStore)
+	require.NoError(t, runLaptop(app, []string{"facets", "-min-cores", "4"}))
+	facets := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &facets))
+	require.Equal(t, float64(2), facets["total"])
+
+	app, out = newTestApp(t, laptopStore)
+	require.NoError(t, runLaptop(app, []string{"similar", "-min-cores", "4", ids[0]}))
+	require.Len(t, decodeList(t, out), 2)
+}
+
+// newTestApp returns an app printing JSON to the returned buffer, connected to a server with the laptop store
+func newTestApp(t *testing.T, laptopStore service.LaptopStore) (*app, *bytes.Buffer) {
+	grpcServer := grpc.NewServer()
+	pcbook.RegisterLaptopServiceServer(grpcServer, service.NewLaptopServer(laptopStore, nil, nil))
+
+	listener, err := net.Listen("tcp", ":0") // any random available port
+	require.NoError(t, err)
+
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	out := &bytes.Buffer{}
+	printer, err := newPrinter(outputJSON, out)
+	require.NoError(t, err)
+
+	app := &app{
+		cfg:     &config{Address: listener.Addr().String(), Insecure: true},
+		timeout: 5 * time.Second,
+		printer: printer,
+	}
+	return app, out
+}
+
+func decodeList(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	list := []map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &list))
+	return list
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config holds the settings of the client, resolved from flags, then environment, then the config file
+type config struct {
+	Address     string `yaml:"address,omitempty"`
+	Username    string `yaml:"username,omitempty"`
+	Password    string `yaml:"password,omitempty"`
+	AccessToken string `yaml:"access_token,omitempty"`
+	CACert      string `yaml:"ca_cert,omitempty"`
+	Insecure    bool   `yaml:"insecure,omitempty"`
+	Output      string `yaml:"output,omitempty"`
+}
+
+// environment variables overriding the config file
+const (
+	envAddress  = "PCBOOK_ADDRESS"
+	envUsername = "PCBOOK_USERNAME"
+	envPassword = "PCBOOK_PASSWORD"
+	envToken    = "PCBOOK_TOKEN"
+	envCACert   = "PCBOOK_CA_CERT"
+	envConfig   = "PCBOOK_CONFIG"
+)
+
+var defaultConfig = config{
+	Address: "0.0.0.0:8080",
+	CACert:  "certs/ca-cert.pem",
+	Output:  "table",
+}
+
+// defaultConfigPath returns the path of the config file used when none is given
+func defaultConfigPath() string {
+	if path := os.Getenv(envConfig); len(path) > 0 {
+		return path
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pcbook", "config.yaml")
+}
+
+// loadConfig reads the config file, a missing file is an empty config
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	if len(path) == 0 {
+		return cfg, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	err = yaml.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// saveConfig writes the config file, readable by the current user only since it holds credentials
+func saveConfig(path string, cfg *config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot marshal config: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("cannot create config directory: %w", err)
+	}
+
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot write config file: %w", err)
+	}
+
+	return nil
+}
+
+// applyEnv overrides the config with the environment variables that are set
+func (cfg *config) applyEnv() {
+	setIfNotEmpty(&cfg.Address, os.Getenv(envAddress))
+	setIfNotEmpty(&cfg.Username, os.Getenv(envUsername))
+	setIfNotEmpty(&cfg.Password, os.Getenv(envPassword))
+	setIfNotEmpty(&cfg.AccessToken, os.Getenv(envToken))
+	setIfNotEmpty(&cfg.CACert, os.Getenv(envCACert))
+}
+
+// applyDefaults fills the settings that are still empty
+func (cfg *config) applyDefaults() {
+	if len(cfg.Address) == 0 {
+		cfg.Address = defaultConfig.Address
+	}
+	if len(cfg.CACert) == 0 {
+		cfg.CACert = defaultConfig.CACert
+	}
+	if len(cfg.Output) == 0 {
+		cfg.Output = defaultConfig.Output
+	}
+}
+
+func setIfNotEmpty(target *string, value string) {
+	if len(value) > 0 {
+		*target = value
+	}
+}
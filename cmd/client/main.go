@@ -1,100 +1,54 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/mikhail-bigun/grpc-app-pcbook/client"
-	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
-	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
 
-func testRateLaptop(laptopClient *client.LaptopClient) {
-	n := 3
-	laptopIDs := make([]string, n)
-
-	for i := 0; i < n; i++ {
-		laptop := sample.NewLaptop()
-		laptopIDs[i] = laptop.Id
-		laptopClient.CreateLaptop(laptop)
-	}
-
-	scores := make([]float64, n)
-	for {
-		fmt.Print("rate laptop (y/n)?")
-		var answer string
-		fmt.Scan(&answer)
-		if strings.ToLower(answer) != "y" {
-			break
-		}
-
-		for i := 0; i < n; i++ {
-			scores[i] = sample.RandomLaptopScore()
-		}
-
-		err := laptopClient.RateLaptop(laptopIDs, scores)
-		if err != nil {
-			log.Fatal(err)
-		}
-	}
-}
-
-func testCreateLaptop(laptopClient *client.LaptopClient) {
-	laptopClient.CreateLaptop(sample.NewLaptop())
-}
-
-func testSearchLaptop(laptopClient *client.LaptopClient) {
-	// Creating 10 random laptops
-	for i := 0; i <= 10; i++ {
-		testCreateLaptop(laptopClient)
-	}
-
-	// making filter
-	filter := &pcbook.Filter{
-		MaxPriceUsd: 3000,
-		MinCpuCores: 4,
-		MinCpuGhz:   2.5,
-		MinRam: &pcbook.Memory{
-			Value: 8,
-			Unit:  pcbook.Memory_GIGABYTE,
-		},
-	}
-
-	laptopClient.SearchLaptop(filter)
-}
-
-func testUploadImage(laptopClient *client.LaptopClient) {
-	laptop := sample.NewLaptop()
-	laptopClient.CreateLaptop(laptop)
-	laptopClient.UploadImage(laptop.GetId(), "tmp/laptop.jpg")
-}
-
 func authMethods() map[string]bool {
 	const laptopServicePath = "/pcbook.LaptopService/"
+	const reviewServicePath = "/pcbook.ReviewService/"
+	const savedSearchServicePath = "/pcbook.SavedSearchService/"
+	const webhookServicePath = "/pcbook.WebhookService/"
 	return map[string]bool{
-		laptopServicePath + "CreateLaptop": true,
-		laptopServicePath + "UploadImage":  true,
-		laptopServicePath + "RateLaptop":   true,
+		laptopServicePath + "CreateLaptop":              true,
+		laptopServicePath + "BatchCreateLaptops":        true,
+		laptopServicePath + "UpdateLaptop":              true,
+		laptopServicePath + "DeleteLaptop":              true,
+		laptopServicePath + "UploadImage":               true,
+		laptopServicePath + "RateLaptop":                true,
+		reviewServicePath + "AddReview":                 true,
+		reviewServicePath + "HideReview":                true,
+		reviewServicePath + "DeleteReview":              true,
+		savedSearchServicePath + "CreateSavedSearch":    true,
+		savedSearchServicePath + "ListSavedSearches":    true,
+		savedSearchServicePath + "DeleteSavedSearch":    true,
+		savedSearchServicePath + "SubscribeSavedSearch": true,
+		webhookServicePath + "RegisterWebhook":          true,
+		webhookServicePath + "ListWebhooks":             true,
+		webhookServicePath + "DeleteWebhook":            true,
+		webhookServicePath + "ListWebhookDeliveries":    true,
 	}
 }
 
-const (
-	username        = "admin"
-	password        = "admin"
-	refreshDuration = 30 * time.Second
-)
+const refreshDuration = 30 * time.Second
 
-func loadTLSCreds() (credentials.TransportCredentials, error) {
+func loadTLSCreds(caCertPath string) (credentials.TransportCredentials, error) {
 	// Load CA certificate
-	pemServerCA, err := ioutil.ReadFile("certs/ca-cert.pem")
+	pemServerCA, err := ioutil.ReadFile(caCertPath)
 	if err != nil {
 		return nil, err
 	}
@@ -112,37 +66,216 @@ func loadTLSCreds() (credentials.TransportCredentials, error) {
 	return credentials.NewTLS(config), nil
 }
 
+// app holds the resolved settings shared by all the commands
+type app struct {
+	cfg        *config
+	configPath string
+	timeout    time.Duration
+	printer    *printer
+}
+
+// command runs a subcommand with the arguments following its name
+type command struct {
+	usage string
+	run   func(app *app, args []string) error
+}
+
+var commands = map[string]command{
+	"login":  {usage: "log in and save the access token to the config file", run: runLogin},
+	"laptop": {usage: "create, get, update, search, count, compare or find similar laptops: laptop create|get|update|search|facets|compare|similar", run: runLaptop},
+	"image":  {usage: "upload or download laptop images: image upload|bulk-upload|download", run: runImage},
+	"rate":   {usage: "rate laptops: rate <laptop-id> <score> [<laptop-id> <score>...]", run: runRate},
+	"export": {usage: "export all the laptops to a file: export -f laptops.ndjson.gz|laptops.csv", run: runExport},
+	"import": {usage: "create the laptops of a file, skipping existing ones: import -f laptops.ndjson.gz", run: runImport},
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <command> [command flags]\n\nCommands:\n", os.Args[0])
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-8s %s\n", name, commands[name].usage)
+	}
+
+	fmt.Fprintf(flag.CommandLine.Output(), "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
 func main() {
-	serverAdress := flag.String("address", "", "server adress")
+	configPath := flag.String("config", defaultConfigPath(), "config file path, env "+envConfig)
+	address := flag.String("address", "", "server address, or comma separated addresses, env "+envAddress)
+	username := flag.String("username", "", "username, env "+envUsername)
+	password := flag.String("password", "", "password, env "+envPassword)
+	caCert := flag.String("ca-cert", "", "CA certificate of the server, env "+envCACert)
+	insecure := flag.Bool("insecure", false, "connect without TLS")
+	output := flag.String("o", "", "output format: table, json or yaml")
+	verbose := flag.Bool("v", false, "log the RPCs made")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of every command, the export stream is not bounded by it")
+	flag.Usage = usage
 	flag.Parse()
-	log.Printf("dial server %s", *serverAdress)
 
-	tlsCreds, err := loadTLSCreds()
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	cfg, err := loadConfig(*configPath)
 	if err != nil {
-		log.Fatal("cannot load TLS credentials: ", err)
+		fatal(err)
 	}
+	cfg.applyEnv()
+	setIfNotEmpty(&cfg.Address, *address)
+	setIfNotEmpty(&cfg.Username, *username)
+	setIfNotEmpty(&cfg.Password, *password)
+	setIfNotEmpty(&cfg.CACert, *caCert)
+	setIfNotEmpty(&cfg.Output, *output)
+	cfg.Insecure = cfg.Insecure || *insecure
+	cfg.applyDefaults()
 
-	auth_cc, err := grpc.Dial(*serverAdress, grpc.WithTransportCredentials(tlsCreds))
+	printer, err := newPrinter(cfg.Output, os.Stdout)
 	if err != nil {
-		log.Fatal("cannot dial server: ", err)
+		fatal(err)
+	}
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fatal(fmt.Errorf("unknown command %q", flag.Arg(0)))
 	}
-	auth_client := client.NewAuthClient(auth_cc, username, password)
-	interceptor, err := client.NewAuthInterceptor(auth_client, authMethods(), refreshDuration)
+
+	app := &app{
+		cfg:        cfg,
+		configPath: *configPath,
+		timeout:    *timeout,
+		printer:    printer,
+	}
+
+	err = cmd.run(app, flag.Args()[1:])
 	if err != nil {
-		log.Fatal("cannot create auth interceptor: ", err)
-	}
-	laptop_cc, err := grpc.Dial(
-		*serverAdress,
-		grpc.WithTransportCredentials(tlsCreds),
-		grpc.WithUnaryInterceptor(interceptor.Unary()),
-		grpc.WithStreamInterceptor(interceptor.Stream()),
-	)
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+// transportOption returns the dial option securing the connection
+func (app *app) transportOption() (grpc.DialOption, error) {
+	if app.cfg.Insecure {
+		return grpc.WithInsecure(), nil
+	}
+
+	tlsCreds, err := loadTLSCreds(app.cfg.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TLS credentials: %w", err)
+	}
+	return grpc.WithTransportCredentials(tlsCreds), nil
+}
+
+// addresses returns the server addresses, several comma separated addresses are balanced in round-robin
+func (app *app) addresses() []string {
+	addresses := []string{}
+	for _, address := range strings.Split(app.cfg.Address, ",") {
+		if address = strings.TrimSpace(address); len(address) > 0 {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// clientConn is a connection to the server, closing it stops refreshing its access token
+type clientConn struct {
+	*grpc.ClientConn
+	interceptor *client.AuthInterceptor
+	// authConn is the connection logging in to refresh the access token, nil without a password
+	authConn *grpc.ClientConn
+}
+
+// Close closes the connection and the one refreshing the access token
+func (conn *clientConn) Close() error {
+	if conn.interceptor != nil {
+		conn.interceptor.Close()
+	}
+	if conn.authConn != nil {
+		conn.authConn.Close()
+	}
+	return conn.ClientConn.Close()
+}
+
+// dial connects to the server, authenticating with the password if there is one, or else with the saved access token
+func (app *app) dial(connOptions ...client.ConnOption) (*clientConn, error) {
+	transport, err := app.transportOption()
 	if err != nil {
-		log.Fatal("cannot dial server: ", err)
+		return nil, err
 	}
-	laptopClient := client.NewLaptopClient(laptop_cc)
 
-	// testSearchLaptop(laptopClient)
-	// testUploadImage(laptopClient)
-	testRateLaptop(laptopClient)
+	opts := []grpc.DialOption{transport}
+	var interceptor *client.AuthInterceptor
+	var authConn *grpc.ClientConn
+
+	switch {
+	case len(app.cfg.Username) > 0 && len(app.cfg.Password) > 0:
+		authConn, err = client.Dial(app.addresses(), client.WithDialOptions(transport))
+		if err != nil {
+			return nil, fmt.Errorf("cannot dial server: %w", err)
+		}
+		authClient := client.NewAuthClient(authConn, app.cfg.Username, app.cfg.Password)
+		interceptor, err = client.NewAuthInterceptor(authClient, authMethods(), refreshDuration)
+		if err != nil {
+			authConn.Close()
+			return nil, fmt.Errorf("cannot log in: %w", err)
+		}
+		opts = append(opts,
+			grpc.WithUnaryInterceptor(interceptor.Unary()),
+			grpc.WithStreamInterceptor(interceptor.Stream()),
+		)
+	case len(app.cfg.AccessToken) > 0:
+		opts = append(opts, grpc.WithPerRPCCredentials(&tokenCredentials{
+			accessToken: app.cfg.AccessToken,
+			secure:      !app.cfg.Insecure,
+		}))
+	}
+
+	conn, err := client.Dial(app.addresses(), append(connOptions, client.WithDialOptions(opts...))...)
+	if err != nil {
+		if interceptor != nil {
+			interceptor.Close()
+			authConn.Close()
+		}
+		return nil, fmt.Errorf("cannot dial server: %w", err)
+	}
+	return &clientConn{ClientConn: conn, interceptor: interceptor, authConn: authConn}, nil
+}
+
+// laptopClient dials the server and returns a laptop client bounded by the command timeout
+func (app *app) laptopClient(connOptions ...client.ConnOption) (*client.LaptopClient, *clientConn, error) {
+	conn, err := app.dial(connOptions...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.NewLaptopClient(conn, client.WithTimeout(app.timeout)), conn, nil
+}
+
+// tokenCredentials attaches a saved access token to every RPC
+type tokenCredentials struct {
+	accessToken string
+	secure      bool
+}
+
+// GetRequestMetadata returns the authorization metadata
+func (creds *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": creds.accessToken}, nil
+}
+
+// RequireTransportSecurity tells if the token may only be sent over TLS
+func (creds *tokenCredentials) RequireTransportSecurity() bool {
+	return creds.secure
 }
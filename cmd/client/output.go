@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// table is the tabular rendering of a command result
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// printer prints command results in the selected output format
+type printer struct {
+	format string
+	out    io.Writer
+}
+
+func newPrinter(format string, out io.Writer) (*printer, error) {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return &printer{format: format, out: out}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, expected one of: table, json, yaml", format)
+	}
+}
+
+// print prints a single result as a table, a JSON object or a YAML document
+func (p *printer) print(t table, message proto.Message) error {
+	if p.format == outputTable {
+		return p.printTable(t)
+	}
+
+	value, err := toValue(message)
+	if err != nil {
+		return err
+	}
+	return p.encode(value)
+}
+
+// printList prints several results as a table, a JSON array or a YAML list
+func (p *printer) printList(t table, messages []proto.Message) error {
+	if p.format == outputTable {
+		return p.printTable(t)
+	}
+
+	values := make([]interface{}, len(messages))
+	for i, message := range messages {
+		value, err := toValue(message)
+		if err != nil {
+			return err
+		}
+		values[i] = value
+	}
+	return p.encode(values)
+}
+
+// printValue prints a result which is not a protobuf message, JSON and YAML share the fields of its JSON encoding
+func (p *printer) printValue(t table, result interface{}) error {
+	if p.format == outputTable {
+		return p.printTable(t)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("cannot marshal result: %w", err)
+	}
+
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal result: %w", err)
+	}
+	return p.encode(value)
+}
+
+func (p *printer) encode(value interface{}) error {
+	if p.format == outputYAML {
+		encoder := yaml.NewEncoder(p.out)
+		encoder.SetIndent(2)
+		defer encoder.Close()
+		return encoder.Encode(value)
+	}
+
+	encoder := json.NewEncoder(p.out)
+	encoder.SetIndent("", "   ")
+	return encoder.Encode(value)
+}
+
+func (p *printer) printTable(t table) error {
+	writer := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+// toValue converts a message to generic JSON values, so JSON and YAML share the protobuf field names
+func toValue(message proto.Message) (interface{}, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal result: %w", err)
+	}
+
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal result: %w", err)
+	}
+	return value, nil
+}
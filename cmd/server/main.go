@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"github.com/mikhail-bigun/grpc-app-pcbook/service"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -39,10 +41,27 @@ func createUser(userStore service.UserStore, username, password, role string) er
 
 func accessRoles() map[string][]string {
 	const laptopServicePath = "/pcbook.LaptopService/"
+	const reviewServicePath = "/pcbook.ReviewService/"
+	const savedSearchServicePath = "/pcbook.SavedSearchService/"
+	const webhookServicePath = "/pcbook.WebhookService/"
 	return map[string][]string{
-		laptopServicePath + "CreateLaptop": {"admin"},
-		laptopServicePath + "UploadImage":  {"admin"},
-		laptopServicePath + "RateLaptop":   {"admin", "user"},
+		laptopServicePath + "CreateLaptop":              {"admin"},
+		laptopServicePath + "BatchCreateLaptops":        {"admin"},
+		laptopServicePath + "UpdateLaptop":              {"admin"},
+		laptopServicePath + "DeleteLaptop":              {"admin"},
+		laptopServicePath + "UploadImage":               {"admin"},
+		laptopServicePath + "RateLaptop":                {"admin", "user"},
+		reviewServicePath + "AddReview":                 {"admin", "user"},
+		reviewServicePath + "HideReview":                {"admin"},
+		reviewServicePath + "DeleteReview":              {"admin"},
+		savedSearchServicePath + "CreateSavedSearch":    {"admin", "user"},
+		savedSearchServicePath + "ListSavedSearches":    {"admin", "user"},
+		savedSearchServicePath + "DeleteSavedSearch":    {"admin", "user"},
+		savedSearchServicePath + "SubscribeSavedSearch": {"admin", "user"},
+		webhookServicePath + "RegisterWebhook":          {"admin"},
+		webhookServicePath + "ListWebhooks":             {"admin"},
+		webhookServicePath + "DeleteWebhook":            {"admin"},
+		webhookServicePath + "ListWebhookDeliveries":    {"admin"},
 	}
 }
 
@@ -70,6 +89,8 @@ func runGRPCServer() error {
 
 func main() {
 	port := flag.Int("port", 0, "the server port")
+	minScore := flag.Float64("min-score", service.DefaultScoreRange.Min, "the lowest accepted laptop score")
+	maxScore := flag.Float64("max-score", service.DefaultScoreRange.Max, "the highest accepted laptop score")
 	flag.Parse()
 	log.Printf("start server on port %d", *port)
 
@@ -82,10 +103,29 @@ func main() {
 	authServer := service.NewAuthServiceServer(userStore, jwtManager)
 
 	laptopStore := service.NewInMemoryLaptopStore()
-	imageStore := service.NewDiskImageStore("img")
-	ratingStore := service.NewInMemoryRatingStore()
+
+	webhookStore := service.NewInMemoryWebhookStore()
+	webhookServer := service.NewWebhookServiceServer(webhookStore)
+	webhookDispatcher := service.NewWebhookDispatcher(webhookStore, laptopStore, service.DefaultWebhookRetryPolicy)
+	go func() {
+		err := webhookDispatcher.Run(context.Background())
+		log.Printf("webhook dispatcher stopped: %v", err)
+	}()
+
+	imageStore := webhookDispatcher.WrapImageStore(service.NewDiskImageStore("img"))
+	inMemoryRatingStore, err := service.NewInMemoryRatingStoreWithRange(service.ScoreRange{Min: *minScore, Max: *maxScore})
+	if err != nil {
+		log.Fatalf("cannot create rating store: %v", err)
+	}
+	ratingStore := webhookDispatcher.WrapRatingStore(inMemoryRatingStore)
 	laptopServer := service.NewLaptopServer(laptopStore, imageStore, ratingStore)
 
+	reviewStore := service.NewInMemoryReviewStore()
+	reviewServer := service.NewReviewServiceServer(laptopStore, ratingStore, reviewStore)
+
+	savedSearchStore := service.NewInMemorySavedSearchStore()
+	savedSearchServer := service.NewSavedSearchServiceServer(laptopStore, savedSearchStore)
+
 	tlsCreds, err := loadTLSCreds()
 	if err != nil {
 		log.Fatal("cannot load TLS credentials: ", err)
@@ -94,12 +134,20 @@ func main() {
 	interceptor := service.NewAuthInterceptor(jwtManager, accessRoles())
 	grpcServer := grpc.NewServer(
 		grpc.Creds(tlsCreds),
+		// allow the keepalive pings of client.DefaultKeepalive, the default policy closes connections pinging more than every 5 minutes
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
 		grpc.UnaryInterceptor(interceptor.Unary()),
 		grpc.StreamInterceptor(interceptor.Stream()),
 	)
 
 	pcbook.RegisterAuthServiceServer(grpcServer, authServer)
 	pcbook.RegisterLaptopServiceServer(grpcServer, laptopServer)
+	pcbook.RegisterReviewServiceServer(grpcServer, reviewServer)
+	pcbook.RegisterSavedSearchServiceServer(grpcServer, savedSearchServer)
+	pcbook.RegisterWebhookServiceServer(grpcServer, webhookServer)
 	reflection.Register(grpcServer)
 
 	address := fmt.Sprintf("0.0.0.0:%d", *port)
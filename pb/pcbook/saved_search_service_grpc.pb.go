@@ -0,0 +1,235 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package pcbook
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// SavedSearchServiceClient is the client API for SavedSearchService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SavedSearchServiceClient interface {
+	CreateSavedSearch(ctx context.Context, in *CreateSavedSearchRequest, opts ...grpc.CallOption) (*CreateSavedSearchResponse, error)
+	ListSavedSearches(ctx context.Context, in *ListSavedSearchesRequest, opts ...grpc.CallOption) (*ListSavedSearchesResponse, error)
+	DeleteSavedSearch(ctx context.Context, in *DeleteSavedSearchRequest, opts ...grpc.CallOption) (*DeleteSavedSearchResponse, error)
+	SubscribeSavedSearch(ctx context.Context, in *SubscribeSavedSearchRequest, opts ...grpc.CallOption) (SavedSearchService_SubscribeSavedSearchClient, error)
+}
+
+type savedSearchServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSavedSearchServiceClient(cc grpc.ClientConnInterface) SavedSearchServiceClient {
+	return &savedSearchServiceClient{cc}
+}
+
+func (c *savedSearchServiceClient) CreateSavedSearch(ctx context.Context, in *CreateSavedSearchRequest, opts ...grpc.CallOption) (*CreateSavedSearchResponse, error) {
+	out := new(CreateSavedSearchResponse)
+	err := c.cc.Invoke(ctx, "/pcbook.SavedSearchService/CreateSavedSearch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *savedSearchServiceClient) ListSavedSearches(ctx context.Context, in *ListSavedSearchesRequest, opts ...grpc.CallOption) (*ListSavedSearchesResponse, error) {
+	out := new(ListSavedSearchesResponse)
+	err := c.cc.Invoke(ctx, "/pcbook.SavedSearchService/ListSavedSearches", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *savedSearchServiceClient) DeleteSavedSearch(ctx context.Context, in *DeleteSavedSearchRequest, opts ...grpc.CallOption) (*DeleteSavedSearchResponse, error) {
+	out := new(DeleteSavedSearchResponse)
+	err := c.cc.Invoke(ctx, "/pcbook.SavedSearchService/DeleteSavedSearch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *savedSearchServiceClient) SubscribeSavedSearch(ctx context.Context, in *SubscribeSavedSearchRequest, opts ...grpc.CallOption) (SavedSearchService_SubscribeSavedSearchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &SavedSearchService_ServiceDesc.Streams[0], "/pcbook.SavedSearchService/SubscribeSavedSearch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &savedSearchServiceSubscribeSavedSearchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SavedSearchService_SubscribeSavedSearchClient interface {
+	Recv() (*SubscribeSavedSearchResponse, error)
+	grpc.ClientStream
+}
+
+type savedSearchServiceSubscribeSavedSearchClient struct {
+	grpc.ClientStream
+}
+
+func (x *savedSearchServiceSubscribeSavedSearchClient) Recv() (*SubscribeSavedSearchResponse, error) {
+	m := new(SubscribeSavedSearchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SavedSearchServiceServer is the server API for SavedSearchService service.
+// All implementations should embed UnimplementedSavedSearchServiceServer
+// for forward compatibility
+type SavedSearchServiceServer interface {
+	CreateSavedSearch(context.Context, *CreateSavedSearchRequest) (*CreateSavedSearchResponse, error)
+	ListSavedSearches(context.Context, *ListSavedSearchesRequest) (*ListSavedSearchesResponse, error)
+	DeleteSavedSearch(context.Context, *DeleteSavedSearchRequest) (*DeleteSavedSearchResponse, error)
+	SubscribeSavedSearch(*SubscribeSavedSearchRequest, SavedSearchService_SubscribeSavedSearchServer) error
+}
+
+// UnimplementedSavedSearchServiceServer should be embedded to have forward compatible implementations.
+type UnimplementedSavedSearchServiceServer struct {
+}
+
+func (UnimplementedSavedSearchServiceServer) CreateSavedSearch(context.Context, *CreateSavedSearchRequest) (*CreateSavedSearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSavedSearch not implemented")
+}
+func (UnimplementedSavedSearchServiceServer) ListSavedSearches(context.Context, *ListSavedSearchesRequest) (*ListSavedSearchesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSavedSearches not implemented")
+}
+func (UnimplementedSavedSearchServiceServer) DeleteSavedSearch(context.Context, *DeleteSavedSearchRequest) (*DeleteSavedSearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSavedSearch not implemented")
+}
+func (UnimplementedSavedSearchServiceServer) SubscribeSavedSearch(*SubscribeSavedSearchRequest, SavedSearchService_SubscribeSavedSearchServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeSavedSearch not implemented")
+}
+
+// UnsafeSavedSearchServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SavedSearchServiceServer will
+// result in compilation errors.
+type UnsafeSavedSearchServiceServer interface {
+	mustEmbedUnimplementedSavedSearchServiceServer()
+}
+
+func RegisterSavedSearchServiceServer(s grpc.ServiceRegistrar, srv SavedSearchServiceServer) {
+	s.RegisterService(&SavedSearchService_ServiceDesc, srv)
+}
+
+func _SavedSearchService_CreateSavedSearch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSavedSearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SavedSearchServiceServer).CreateSavedSearch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pcbook.SavedSearchService/CreateSavedSearch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SavedSearchServiceServer).CreateSavedSearch(ctx, req.(*CreateSavedSearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SavedSearchService_ListSavedSearches_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSavedSearchesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SavedSearchServiceServer).ListSavedSearches(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pcbook.SavedSearchService/ListSavedSearches",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SavedSearchServiceServer).ListSavedSearches(ctx, req.(*ListSavedSearchesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SavedSearchService_DeleteSavedSearch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSavedSearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SavedSearchServiceServer).DeleteSavedSearch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pcbook.SavedSearchService/DeleteSavedSearch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SavedSearchServiceServer).DeleteSavedSearch(ctx, req.(*DeleteSavedSearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SavedSearchService_SubscribeSavedSearch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeSavedSearchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SavedSearchServiceServer).SubscribeSavedSearch(m, &savedSearchServiceSubscribeSavedSearchServer{stream})
+}
+
+type SavedSearchService_SubscribeSavedSearchServer interface {
+	Send(*SubscribeSavedSearchResponse) error
+	grpc.ServerStream
+}
+
+type savedSearchServiceSubscribeSavedSearchServer struct {
+	grpc.ServerStream
+}
+
+func (x *savedSearchServiceSubscribeSavedSearchServer) Send(m *SubscribeSavedSearchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// SavedSearchService_ServiceDesc is the grpc.ServiceDesc for SavedSearchService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SavedSearchService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pcbook.SavedSearchService",
+	HandlerType: (*SavedSearchServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateSavedSearch",
+			Handler:    _SavedSearchService_CreateSavedSearch_Handler,
+		},
+		{
+			MethodName: "ListSavedSearches",
+			Handler:    _SavedSearchService_ListSavedSearches_Handler,
+		},
+		{
+			MethodName: "DeleteSavedSearch",
+			Handler:    _SavedSearchService_DeleteSavedSearch_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeSavedSearch",
+			Handler:       _SavedSearchService_SubscribeSavedSearch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "saved_search_service.proto",
+}
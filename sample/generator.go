@@ -20,7 +20,7 @@ func NewCPU() *pcbook.CPU {
 	brand := randomCPUBrand()
 	name := randomCPUName(brand)
 	numberOfCores := randomInt(2, 8)
-	NumberOfThreads := randomInt(2, 8)
+	NumberOfThreads := randomInt(numberOfCores, 12)
 	minGhz := randomFloat64(2.0, 3.5)
 	maxGhz := randomFloat64(minGhz, 5.0)
 	cpu := &pcbook.CPU{
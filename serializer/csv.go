@@ -0,0 +1,570 @@
+package serializer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DefaultCSVRepeated is the number of indexed columns written for a repeated message field
+const DefaultCSVRepeated = 2
+
+// csvListSeparator separates the values of a repeated scalar field in a cell
+const csvListSeparator = ";"
+
+// CSVOptions configures the mapping between CSV columns and message fields.
+//
+// A column is named by the path of its field, nested fields are separated by dots and the elements of repeated
+// message fields are indexed from 0, e.g. cpu.number_of_cores, screen.resolution.width or gpus.1.memory.
+// Memory sizes are written as 16GB and timestamps in RFC 3339.
+type CSVOptions struct {
+	// Columns maps CSV headers to field paths, e.g. "Price" to "price_usd", other headers are field paths
+	Columns map[string]string
+	// Repeated sets the number of indexed columns written for repeated message fields by path, e.g. "gpus" to 4
+	Repeated map[string]int
+}
+
+// csvStep is a field of a column path, index is the element of a repeated message field, or -1
+type csvStep struct {
+	field protoreflect.FieldDescriptor
+	index int
+}
+
+// csvColumn maps a CSV column to a field
+type csvColumn struct {
+	header string
+	path   string
+	steps  []csvStep
+}
+
+// csvRepeated is a repeated message field written in count indexed columns, steps lead to the field
+type csvRepeated struct {
+	path  string
+	steps []csvStep
+	count int
+}
+
+// CSVWriter writes messages of the same type as CSV rows, after a header row
+type CSVWriter struct {
+	writer   *csv.Writer
+	options  CSVOptions
+	columns  []csvColumn
+	repeated []csvRepeated
+	record   []string
+}
+
+// NewCSVWriter returns a writer of messages to w as CSV
+func NewCSVWriter(w io.Writer, options CSVOptions) *CSVWriter {
+	return &CSVWriter{
+		writer:  csv.NewWriter(w),
+		options: options,
+	}
+}
+
+// Write writes a message as a CSV row, the header row is written with the first message.
+// A repeated message field with more elements than its indexed columns is an error, see CSVOptions.Repeated
+func (writer *CSVWriter) Write(message proto.Message) error {
+	m := message.ProtoReflect()
+
+	if writer.columns == nil {
+		writer.columns = writer.descriptorColumns(m.Descriptor(), "", nil)
+
+		headers := make(map[string]string, len(writer.options.Columns))
+		for header, path := range writer.options.Columns {
+			headers[path] = header
+		}
+
+		record := make([]string, len(writer.columns))
+		for i := range writer.columns {
+			writer.columns[i].header = writer.columns[i].path
+			if header, ok := headers[writer.columns[i].path]; ok {
+				writer.columns[i].header = header
+			}
+			record[i] = writer.columns[i].header
+		}
+
+		err := writer.writer.Write(record)
+		if err != nil {
+			return fmt.Errorf("cannot write csv header: %w", err)
+		}
+		writer.record = make([]string, len(writer.columns))
+	}
+
+	for _, repeated := range writer.repeated {
+		parent, ok := csvParent(m, repeated.steps)
+		if !ok {
+			continue
+		}
+		if n := parent.Get(repeated.steps[len(repeated.steps)-1].field).List().Len(); n > repeated.count {
+			return fmt.Errorf("cannot write csv row: %s has %d elements, more than its %d columns", repeated.path, n, repeated.count)
+		}
+	}
+
+	for i, column := range writer.columns {
+		value, err := getCSVValue(m, column)
+		if err != nil {
+			return err
+		}
+		writer.record[i] = value
+	}
+
+	err := writer.writer.Write(writer.record)
+	if err != nil {
+		return fmt.Errorf("cannot write csv row: %w", err)
+	}
+	return nil
+}
+
+// Flush writes the buffered rows
+func (writer *CSVWriter) Flush() error {
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+// descriptorColumns lists the columns of the leaf fields of a message
+func (writer *CSVWriter) descriptorColumns(descriptor protoreflect.MessageDescriptor, prefix string, steps []csvStep) []csvColumn {
+	columns := []csvColumn{}
+
+	fields := descriptor.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		path := prefix + string(field.Name())
+
+		switch {
+		case field.IsMap():
+			continue
+		case field.Message() != nil && !isCSVLeafMessage(field.Message()):
+			if !field.IsList() {
+				columns = append(columns, writer.descriptorColumns(field.Message(), path+".", appendStep(steps, field, -1))...)
+				continue
+			}
+
+			count, ok := writer.options.Repeated[path]
+			if !ok {
+				count = DefaultCSVRepeated
+			}
+			writer.repeated = append(writer.repeated, csvRepeated{path: path, steps: appendStep(steps, field, -1), count: count})
+			for index := 0; index < count; index++ {
+				indexPath := fmt.Sprintf("%s.%d.", path, index)
+				columns = append(columns, writer.descriptorColumns(field.Message(), indexPath, appendStep(steps, field, index))...)
+			}
+		default:
+			columns = append(columns, csvColumn{path: path, steps: appendStep(steps, field, -1)})
+		}
+	}
+
+	return columns
+}
+
+func appendStep(steps []csvStep, field protoreflect.FieldDescriptor, index int) []csvStep {
+	result := make([]csvStep, len(steps), len(steps)+1)
+	copy(result, steps)
+	return append(result, csvStep{field: field, index: index})
+}
+
+// csvParent returns the message holding the last field of steps, false if one of its parents is not set
+func csvParent(m protoreflect.Message, steps []csvStep) (protoreflect.Message, bool) {
+	for _, step := range steps[:len(steps)-1] {
+		if step.index >= 0 {
+			list := m.Get(step.field).List()
+			if step.index >= list.Len() {
+				return nil, false
+			}
+			m = list.Get(step.index).Message()
+			continue
+		}
+
+		if !m.Has(step.field) {
+			return nil, false
+		}
+		m = m.Get(step.field).Message()
+	}
+	return m, true
+}
+
+// getCSVValue returns the cell of a column, empty if the field or one of its parents is not set
+func getCSVValue(m protoreflect.Message, column csvColumn) (string, error) {
+	m, ok := csvParent(m, column.steps)
+	if !ok {
+		return "", nil
+	}
+
+	field := column.steps[len(column.steps)-1].field
+	if (field.ContainingOneof() != nil || field.Message() != nil) && !m.Has(field) {
+		return "", nil
+	}
+
+	value := m.Get(field)
+	if !field.IsList() {
+		return formatCSVValue(field, value)
+	}
+
+	list := value.List()
+	items := make([]string, list.Len())
+	for i := range items {
+		item, err := formatCSVValue(field, list.Get(i))
+		if err != nil {
+			return "", err
+		}
+		items[i] = item
+	}
+	return strings.Join(items, csvListSeparator), nil
+}
+
+// CSVReader reads messages of the same type from CSV rows, after a header row
+type CSVReader struct {
+	lines   *bufio.Reader
+	line    int
+	options CSVOptions
+	columns []csvColumn
+}
+
+// NewCSVReader returns a reader of messages from the CSV of r
+func NewCSVReader(r io.Reader, options CSVOptions) *CSVReader {
+	return &CSVReader{
+		lines:   bufio.NewReader(r),
+		options: options,
+	}
+}
+
+// Read reads the next row into message, returns io.EOF at the end of the CSV,
+// the errors of a row tell its line and column
+func (reader *CSVReader) Read(message proto.Message) error {
+	proto.Reset(message)
+	m := message.ProtoReflect()
+
+	if reader.columns == nil {
+		err := reader.readHeader(m.Descriptor())
+		if err != nil {
+			return err
+		}
+	}
+
+	record, line, err := reader.readRecord()
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err == nil && len(record) != len(reader.columns) {
+		err = &csv.ParseError{StartLine: line, Line: line, Err: csv.ErrFieldCount}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read csv: %w", err)
+	}
+
+	for i, cell := range record {
+		if len(strings.TrimSpace(cell)) == 0 {
+			continue
+		}
+
+		err := setCSVValue(m, reader.columns[i], strings.TrimSpace(cell))
+		if err != nil {
+			return fmt.Errorf("line %d, column %q: %w", line, reader.columns[i].header, err)
+		}
+	}
+
+	return nil
+}
+
+// readRecord reads the lines of the next record and returns its fields with the line it starts on.
+// A record ends on the first line after which its quotes are balanced, as quoted fields may span lines
+func (reader *CSVReader) readRecord() ([]string, int, error) {
+	var text strings.Builder
+	start, quotes := 0, 0
+
+	for {
+		line, err := reader.lines.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		if len(line) > 0 {
+			reader.line++
+		}
+
+		// like encoding/csv, skip the empty lines between records
+		if text.Len() > 0 || len(strings.TrimRight(line, "\r\n")) > 0 {
+			if text.Len() == 0 {
+				start = reader.line
+			}
+			text.WriteString(line)
+			quotes += strings.Count(line, `"`)
+		}
+
+		if err == io.EOF && text.Len() == 0 {
+			return nil, 0, io.EOF
+		}
+		if err == io.EOF || (text.Len() > 0 && quotes%2 == 0) {
+			break
+		}
+	}
+
+	record, err := csv.NewReader(strings.NewReader(text.String())).Read()
+	if parseErr, ok := err.(*csv.ParseError); ok {
+		// the record was parsed alone, so its lines start at 1
+		parseErr.StartLine += start - 1
+		parseErr.Line += start - 1
+	}
+	return record, start, err
+}
+
+func (reader *CSVReader) readHeader(descriptor protoreflect.MessageDescriptor) error {
+	record, line, err := reader.readRecord()
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read csv header: %w", err)
+	}
+
+	columns := make([]csvColumn, len(record))
+	seen := make(map[string]bool, len(record))
+	for i, header := range record {
+		header = strings.TrimSpace(header)
+		path := header
+		if mapped, ok := reader.options.Columns[header]; ok {
+			path = mapped
+		}
+
+		if seen[path] {
+			return fmt.Errorf("line %d: duplicate column %q", line, header)
+		}
+		seen[path] = true
+
+		steps, err := parseCSVPath(descriptor, path)
+		if err != nil {
+			return fmt.Errorf("line %d, column %q: %w", line, header, err)
+		}
+		columns[i] = csvColumn{header: header, path: path, steps: steps}
+	}
+
+	reader.columns = columns
+	return nil
+}
+
+// parseCSVPath resolves the fields of a column path
+func parseCSVPath(descriptor protoreflect.MessageDescriptor, path string) ([]csvStep, error) {
+	parts := strings.Split(path, ".")
+	steps := []csvStep{}
+
+	for i := 0; i < len(parts); i++ {
+		if descriptor == nil {
+			return nil, fmt.Errorf("unknown field path %q", path)
+		}
+
+		field := descriptor.Fields().ByName(protoreflect.Name(parts[i]))
+		if field == nil || field.IsMap() {
+			return nil, fmt.Errorf("unknown field path %q", path)
+		}
+
+		step := csvStep{field: field, index: -1}
+		descriptor = nil
+		if field.Message() != nil && !isCSVLeafMessage(field.Message()) {
+			descriptor = field.Message()
+			if field.IsList() {
+				i++
+				if i == len(parts) {
+					return nil, fmt.Errorf("field path %q misses the index of %s", path, field.Name())
+				}
+				index, err := strconv.Atoi(parts[i])
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid index %q in field path %q", parts[i], path)
+				}
+				step.index = index
+			}
+		}
+		steps = append(steps, step)
+	}
+
+	if descriptor != nil {
+		return nil, fmt.Errorf("field path %q is a message, expected one of its fields", path)
+	}
+	return steps, nil
+}
+
+// setCSVValue sets the field of a column, creating its parents
+func setCSVValue(m protoreflect.Message, column csvColumn, cell string) error {
+	last := len(column.steps) - 1
+	for _, step := range column.steps[:last] {
+		if step.index < 0 {
+			m = m.Mutable(step.field).Message()
+			continue
+		}
+
+		list := m.Mutable(step.field).List()
+		if step.index > list.Len() {
+			return fmt.Errorf("%s %d is set but not %s %d", step.field.Name(), step.index, step.field.Name(), list.Len())
+		}
+		if step.index == list.Len() {
+			list.Append(list.NewElement())
+		}
+		m = list.Get(step.index).Message()
+	}
+
+	field := column.steps[last].field
+	if oneof := field.ContainingOneof(); oneof != nil {
+		if other := m.WhichOneof(oneof); other != nil && other != field {
+			return fmt.Errorf("%s is also set, only one of them can be set", other.Name())
+		}
+	}
+
+	if !field.IsList() {
+		value, err := parseCSVValue(field, cell)
+		if err != nil {
+			return err
+		}
+		m.Set(field, value)
+		return nil
+	}
+
+	list := m.Mutable(field).List()
+	for _, item := range strings.Split(cell, csvListSeparator) {
+		value, err := parseCSVValue(field, strings.TrimSpace(item))
+		if err != nil {
+			return err
+		}
+		list.Append(value)
+	}
+	return nil
+}
+
+// isCSVLeafMessage tells if a message is written in a single cell
+func isCSVLeafMessage(descriptor protoreflect.MessageDescriptor) bool {
+	switch descriptor.FullName() {
+	case "google.protobuf.Timestamp", "pcbook.Memory":
+		return true
+	default:
+		return false
+	}
+}
+
+func formatCSVValue(field protoreflect.FieldDescriptor, value protoreflect.Value) (string, error) {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		switch message := value.Message().Interface().(type) {
+		case *timestamppb.Timestamp:
+			return message.AsTime().Format(time.RFC3339Nano), nil
+		case *pcbook.Memory:
+			return FormatMemory(message), nil
+		default:
+			return "", fmt.Errorf("cannot write message %s in a csv cell", field.Message().FullName())
+		}
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByNumber(value.Enum()); enumValue != nil {
+			return string(enumValue.Name()), nil
+		}
+		return strconv.Itoa(int(value.Enum())), nil
+	case protoreflect.BoolKind:
+		return strconv.FormatBool(value.Bool()), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case protoreflect.FloatKind:
+		return strconv.FormatFloat(value.Float(), 'g', -1, 32), nil
+	case protoreflect.DoubleKind:
+		return strconv.FormatFloat(value.Float(), 'g', -1, 64), nil
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(value.Bytes()), nil
+	default:
+		return value.String(), nil
+	}
+}
+
+func parseCSVValue(field protoreflect.FieldDescriptor, cell string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		switch field.Message().FullName() {
+		case "google.protobuf.Timestamp":
+			t, err := time.Parse(time.RFC3339Nano, cell)
+			if err != nil {
+				return protoreflect.Value{}, fmt.Errorf("invalid timestamp %q, expected RFC 3339 like 2021-07-30T15:04:05Z", cell)
+			}
+			return protoreflect.ValueOfMessage(timestamppb.New(t).ProtoReflect()), nil
+		case "pcbook.Memory":
+			memory, err := ParseMemory(cell)
+			if err != nil {
+				return protoreflect.Value{}, err
+			}
+			return protoreflect.ValueOfMessage(memory.ProtoReflect()), nil
+		default:
+			return protoreflect.Value{}, fmt.Errorf("cannot read message %s from a csv cell", field.Message().FullName())
+		}
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByName(protoreflect.Name(strings.ToUpper(cell))); enumValue != nil {
+			return protoreflect.ValueOfEnum(enumValue.Number()), nil
+		}
+		number, err := strconv.ParseInt(cell, 10, 32)
+		if err != nil || field.Enum().Values().ByNumber(protoreflect.EnumNumber(number)) == nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid %s %q, expected one of: %s", field.Enum().Name(), cell, enumNames(field.Enum()))
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(number)), nil
+	case protoreflect.BoolKind:
+		value, err := strconv.ParseBool(cell)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid boolean %q", cell)
+		}
+		return protoreflect.ValueOfBool(value), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		value, err := strconv.ParseInt(cell, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid integer %q", cell)
+		}
+		return protoreflect.ValueOfInt32(int32(value)), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		value, err := strconv.ParseInt(cell, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid integer %q", cell)
+		}
+		return protoreflect.ValueOfInt64(value), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		value, err := strconv.ParseUint(cell, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid positive integer %q", cell)
+		}
+		return protoreflect.ValueOfUint32(uint32(value)), nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		value, err := strconv.ParseUint(cell, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid positive integer %q", cell)
+		}
+		return protoreflect.ValueOfUint64(value), nil
+	case protoreflect.FloatKind:
+		value, err := strconv.ParseFloat(cell, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid number %q", cell)
+		}
+		return protoreflect.ValueOfFloat32(float32(value)), nil
+	case protoreflect.DoubleKind:
+		value, err := strconv.ParseFloat(cell, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid number %q", cell)
+		}
+		return protoreflect.ValueOfFloat64(value), nil
+	case protoreflect.BytesKind:
+		value, err := base64.StdEncoding.DecodeString(cell)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid base64 %q", cell)
+		}
+		return protoreflect.ValueOfBytes(value), nil
+	default:
+		return protoreflect.ValueOfString(cell), nil
+	}
+}
+
+func enumNames(enum protoreflect.EnumDescriptor) string {
+	names := make([]string, enum.Values().Len())
+	for i := range names {
+		names[i] = string(enum.Values().Get(i).Name())
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,166 @@
+package serializer_test
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/serializer"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	laptops := []*pcbook.Laptop{sample.NewLaptop(), sample.NewLaptop(), sample.NewLaptop()}
+	laptops[1].Gpus = append(laptops[1].Gpus, sample.NewGPU(), sample.NewGPU())
+	laptops[2].Gpus = nil
+	laptops[2].Weight = &pcbook.Laptop_WeightLb{WeightLb: 4.2}
+
+	options := serializer.CSVOptions{
+		Columns:  map[string]string{"Price": "price_usd", "RAM": "ram"},
+		Repeated: map[string]int{"gpus": 3},
+	}
+
+	var buffer bytes.Buffer
+	writer := serializer.NewCSVWriter(&buffer, options)
+	for _, laptop := range laptops {
+		require.NoError(t, writer.Write(laptop))
+	}
+	require.NoError(t, writer.Flush())
+
+	header := strings.SplitN(buffer.String(), "\n", 2)[0]
+	require.Contains(t, header, ",RAM,")
+	require.Contains(t, header, ",Price,")
+	require.Contains(t, header, ",cpu.number_of_cores,")
+	require.Contains(t, header, ",gpus.2.memory,")
+	require.Contains(t, header, ",screen.resolution.width,")
+	require.NotContains(t, header, "gpus.3")
+
+	reader := serializer.NewCSVReader(&buffer, options)
+	for _, laptop := range laptops {
+		other := &pcbook.Laptop{}
+		require.NoError(t, reader.Read(other))
+		require.True(t, proto.Equal(laptop, other), "%v\n%v", laptop, other)
+	}
+	require.Equal(t, io.EOF, reader.Read(&pcbook.Laptop{}))
+
+	// the elements beyond the columns of a repeated field are not dropped silently
+	laptop := sample.NewLaptop()
+	laptop.Storages = append(laptop.Storages, sample.NewHDD())
+	writer = serializer.NewCSVWriter(&buffer, options)
+	err := writer.Write(laptop)
+	require.EqualError(t, err, "cannot write csv row: storages has 3 elements, more than its 2 columns")
+
+	buffer.Reset()
+	options.Repeated["storages"] = 3
+	writer = serializer.NewCSVWriter(&buffer, options)
+	require.NoError(t, writer.Write(laptop))
+	require.NoError(t, writer.Flush())
+
+	other := &pcbook.Laptop{}
+	require.NoError(t, serializer.NewCSVReader(&buffer, options).Read(other))
+	require.True(t, proto.Equal(laptop, other), "%v\n%v", laptop, other)
+}
+
+func TestCSVReadErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		csv  string
+		err  string
+	}{
+		{
+			name: "unknown column",
+			csv:  "id,cpu.speed\n1,2\n",
+			err:  `line 1, column "cpu.speed": unknown field path`,
+		},
+		{
+			name: "message column",
+			csv:  "id,cpu\n1,2\n",
+			err:  `field path "cpu" is a message`,
+		},
+		{
+			name: "invalid number",
+			csv:  "id,price_usd\n1,1000\n2,cheap\n",
+			err:  `line 3, column "price_usd": invalid number "cheap"`,
+		},
+		{
+			name: "invalid enum",
+			csv:  "id,keyboard.layout\n1,DVORAK\n",
+			err:  `line 2, column "keyboard.layout": invalid Layout "DVORAK", expected one of: UNKNOWN, QWERTY, QWERTZ, AZERTY`,
+		},
+		{
+			name: "invalid memory",
+			csv:  "id,ram\n1,16 parsecs\n",
+			err:  `line 2, column "ram": invalid memory unit`,
+		},
+		{
+			name: "two weights",
+			csv:  "id,weight_kg,weight_lb\n1,1.5,3.3\n",
+			err:  `line 2, column "weight_lb": weight_kg is also set`,
+		},
+		{
+			name: "missing index",
+			csv:  "id,gpus.0.name,gpus.1.name\n1,,RTX 3070\n",
+			err:  `line 2, column "gpus.1.name": gpus 1 is set but not gpus 0`,
+		},
+		{
+			name: "missing cell",
+			csv:  "id,brand\n1,Apple\n2\n",
+			err:  "line 3",
+		},
+		{
+			name: "quoted lines",
+			csv:  "id,name,price_usd\n1,\"Pro\n\"\"14\"\"\",1000\n\n2,Air,cheap\n",
+			err:  `line 5, column "price_usd": invalid number "cheap"`,
+		},
+		{
+			name: "unterminated quote",
+			csv:  "id,name\n1,\"Pro\n2,Air\n",
+			err:  "line 3",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			reader := serializer.NewCSVReader(strings.NewReader(tc.csv), serializer.CSVOptions{})
+			var err error
+			for err == nil {
+				err = reader.Read(&pcbook.Laptop{})
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestCSVMessageFile(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "laptops.csv.gz")
+	laptop := sample.NewLaptop()
+
+	writer, err := serializer.CreateMessageFile(filename)
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(laptop))
+	require.NoError(t, writer.Close())
+
+	reader, err := serializer.OpenMessageFile(filename)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	other := &pcbook.Laptop{}
+	require.NoError(t, reader.Read(other))
+	require.True(t, proto.Equal(laptop, other))
+	require.Equal(t, io.EOF, reader.Read(other))
+}
@@ -4,9 +4,10 @@ import (
 	"fmt"
 	"io/ioutil"
 
-	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/proto"
 )
 
+// WriteProtobufToJSONFile writes protocol buffer message to JSON file
 func WriteProtobufToJSONFile(message proto.Message, filename string) error {
 	data, err := ProtobufToJSON(message)
 	if err != nil {
@@ -19,6 +20,48 @@ func WriteProtobufToJSONFile(message proto.Message, filename string) error {
 	return nil
 }
 
+// ReadProtobufFromJSONFile reads protocol buffer message from JSON file
+func ReadProtobufFromJSONFile(filename string, message proto.Message) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("cannot read file: %w", err)
+	}
+
+	err = JSONToProtobuf(string(data), message)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal json: %w", err)
+	}
+	return nil
+}
+
+// WriteProtobufToTextFile writes protocol buffer message to text format file
+func WriteProtobufToTextFile(message proto.Message, filename string) error {
+	data, err := ProtobufToText(message)
+	if err != nil {
+		return fmt.Errorf("cannot marshal proto message to text: %w", err)
+	}
+
+	err = ioutil.WriteFile(filename, []byte(data), 0644)
+	if err != nil {
+		return fmt.Errorf("cannot write file: %w", err)
+	}
+	return nil
+}
+
+// ReadProtobufFromTextFile reads protocol buffer message from text format file
+func ReadProtobufFromTextFile(filename string, message proto.Message) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("cannot read file: %w", err)
+	}
+
+	err = TextToProtobuf(string(data), message)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal text: %w", err)
+	}
+	return nil
+}
+
 // WriteProtobufToBinaryFile writes protocol buffer message to binary file
 func WriteProtobufToBinaryFile(message proto.Message, filename string) error {
 	data, err := proto.Marshal(message)
@@ -1,6 +1,7 @@
 package serializer_test
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
@@ -15,6 +16,7 @@ func TestFileSerializer(t *testing.T) {
 
 	binaryFile := "../tmp/laptop.bin"
 	jsonFile := "../tmp/laptop.json"
+	textFile := filepath.Join(t.TempDir(), "laptop.txt")
 
 	laptop1 := sample.NewLaptop()
 	err := serializer.WriteProtobufToBinaryFile(laptop1, binaryFile)
@@ -28,4 +30,43 @@ func TestFileSerializer(t *testing.T) {
 	err = serializer.WriteProtobufToJSONFile(laptop1, jsonFile)
 	require.NoError(t, err)
 
+	laptop3 := &pcbook.Laptop{}
+	err = serializer.ReadProtobufFromJSONFile(jsonFile, laptop3)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(laptop1, laptop3))
+
+	err = serializer.WriteProtobufToTextFile(laptop1, textFile)
+	require.NoError(t, err)
+
+	laptop4 := &pcbook.Laptop{}
+	err = serializer.ReadProtobufFromTextFile(textFile, laptop4)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(laptop1, laptop4))
+}
+
+func TestProtobufToJSONWithOptions(t *testing.T) {
+	t.Parallel()
+
+	keyboard := &pcbook.Keyboard{Layout: pcbook.Keyboard_QWERTY}
+
+	data, err := serializer.ProtobufToJSONWithOptions(keyboard, serializer.JSONOptions{})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"layout": "QWERTY"}`, data)
+
+	data, err = serializer.ProtobufToJSONWithOptions(keyboard, serializer.JSONOptions{EmitDefaults: true, EnumsAsInts: true})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"layout": 1, "backlit": false}`, data)
+
+	cpu := &pcbook.CPU{NumberOfCores: 4}
+	data, err = serializer.ProtobufToJSONWithOptions(cpu, serializer.JSONOptions{OrigName: true})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"number_of_cores": 4}`, data)
+
+	other := &pcbook.CPU{}
+	err = serializer.JSONToProtobuf(`{"numberOfCores": 4}`, other)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(cpu, other))
+
+	err = serializer.JSONToProtobuf(`{"unknown_field": 4}`, other)
+	require.Error(t, err)
 }
@@ -1,19 +1,51 @@
 package serializer
 
 import (
-	"github.com/golang/protobuf/jsonpb"
-	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
+// JSONOptions configures how proto messages are converted to JSON
+type JSONOptions struct {
+	// EmitDefaults writes the fields holding their default value
+	EmitDefaults bool
+	// EnumsAsInts writes enums as numbers instead of names
+	EnumsAsInts bool
+	// OrigName writes the field names of the proto files instead of lowerCamelCase names
+	OrigName bool
+	// Indent indents the JSON on several lines, empty writes a single line
+	Indent string
+}
+
+// DefaultJSONOptions are the options used by ProtobufToJSON
+var DefaultJSONOptions = JSONOptions{
+	OrigName: true,
+	Indent:   "   ",
+}
+
 // ProtobufToJSON convert proto message to JSON
 func ProtobufToJSON(message proto.Message) (string, error) {
-	marshaler := jsonpb.Marshaler{
-		EnumsAsInts:  false,
-		EmitDefaults: false,
-		Indent:       "   ",
-		OrigName:     true,
+	return ProtobufToJSONWithOptions(message, DefaultJSONOptions)
+}
+
+// ProtobufToJSONWithOptions convert proto message to JSON with the given options
+func ProtobufToJSONWithOptions(message proto.Message, options JSONOptions) (string, error) {
+	marshaler := protojson.MarshalOptions{
+		Multiline:       len(options.Indent) > 0,
+		Indent:          options.Indent,
+		UseProtoNames:   options.OrigName,
+		UseEnumNumbers:  options.EnumsAsInts,
+		EmitUnpopulated: options.EmitDefaults,
 	}
 
-	return marshaler.MarshalToString(message)
+	data, err := marshaler.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
 
+// JSONToProtobuf convert JSON to proto message, both field name styles and both enum styles are accepted
+func JSONToProtobuf(data string, message proto.Message) error {
+	return protojson.Unmarshal([]byte(data), message)
 }
@@ -0,0 +1,57 @@
+package serializer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+)
+
+var memoryUnits = map[string]pcbook.Memory_Unit{
+	"BIT": pcbook.Memory_BIT,
+	"B":   pcbook.Memory_BYTE,
+	"KB":  pcbook.Memory_KILOBYTE,
+	"MB":  pcbook.Memory_MEGABYTE,
+	"GB":  pcbook.Memory_GIGABYTE,
+	"TB":  pcbook.Memory_TERABYTE,
+}
+
+var memoryUnitNames = map[pcbook.Memory_Unit]string{
+	pcbook.Memory_BIT:      "bit",
+	pcbook.Memory_BYTE:     "B",
+	pcbook.Memory_KILOBYTE: "KB",
+	pcbook.Memory_MEGABYTE: "MB",
+	pcbook.Memory_GIGABYTE: "GB",
+	pcbook.Memory_TERABYTE: "TB",
+}
+
+// ParseMemory parses a memory size such as 16GB or 512 MB
+func ParseMemory(text string) (*pcbook.Memory, error) {
+	text = strings.TrimSpace(text)
+	digits := strings.IndexFunc(text, func(r rune) bool { return !unicode.IsDigit(r) })
+	if digits <= 0 {
+		return nil, fmt.Errorf("invalid memory size %q, expected a number followed by a unit like 16GB", text)
+	}
+
+	value, err := strconv.ParseUint(text[:digits], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory size %q: %w", text, err)
+	}
+
+	unit, ok := memoryUnits[strings.ToUpper(strings.TrimSpace(text[digits:]))]
+	if !ok {
+		return nil, fmt.Errorf("invalid memory unit in %q, expected one of: bit, B, KB, MB, GB, TB", text)
+	}
+
+	return &pcbook.Memory{Value: value, Unit: unit}, nil
+}
+
+// FormatMemory formats a memory size the way ParseMemory reads it
+func FormatMemory(memory *pcbook.Memory) string {
+	if memory == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d%s", memory.GetValue(), memoryUnitNames[memory.GetUnit()])
+}
@@ -0,0 +1,297 @@
+package serializer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// StreamFormat is the encoding of the messages of a stream file
+type StreamFormat int
+
+const (
+	// DelimitedFormat writes every message in binary prefixed by its size as a varint
+	DelimitedFormat StreamFormat = iota
+	// NDJSONFormat writes every message as JSON on its own line
+	NDJSONFormat
+	// CSVFormat writes every message as a CSV row, after a header row
+	CSVFormat
+)
+
+// MaxStreamMessageSize is the largest message read from a delimited stream, to fail fast on corrupted files
+const MaxStreamMessageSize = 64 << 20
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// StreamFormatFromFilename returns the format of a stream file from its extension,
+// .ndjson or .jsonl for NDJSON, .ldpb or .bin for delimited and .csv for CSV, followed by .gz if compressed
+func StreamFormatFromFilename(filename string) (format StreamFormat, compressed bool, err error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".gz" {
+		compressed = true
+		ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(filename, filepath.Ext(filename))))
+	}
+
+	switch ext {
+	case ".ndjson", ".jsonl":
+		return NDJSONFormat, compressed, nil
+	case ".ldpb", ".bin":
+		return DelimitedFormat, compressed, nil
+	case ".csv":
+		return CSVFormat, compressed, nil
+	default:
+		return 0, false, fmt.Errorf("unknown stream file extension %q, expected .ndjson, .jsonl, .ldpb, .bin or .csv, optionally followed by .gz", ext)
+	}
+}
+
+// streamConfig is built by the stream options
+type streamConfig struct {
+	csv CSVOptions
+}
+
+// StreamOption configures a message stream
+type StreamOption func(config *streamConfig)
+
+// WithCSVOptions sets the column mapping of a CSV stream
+func WithCSVOptions(options CSVOptions) StreamOption {
+	return func(config *streamConfig) {
+		config.csv = options
+	}
+}
+
+func newStreamConfig(opts []StreamOption) *streamConfig {
+	config := &streamConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+// MessageWriter writes a stream of proto messages
+type MessageWriter struct {
+	format StreamFormat
+	writer *bufio.Writer
+	csv    *CSVWriter
+	gzip   *gzip.Writer
+	closer io.Closer
+	buffer []byte
+}
+
+// NewMessageWriter returns a writer of messages to w, compressed with gzip if asked
+func NewMessageWriter(w io.Writer, format StreamFormat, compress bool, opts ...StreamOption) *MessageWriter {
+	writer := &MessageWriter{format: format}
+	if compress {
+		writer.gzip = gzip.NewWriter(w)
+		w = writer.gzip
+	}
+	writer.writer = bufio.NewWriter(w)
+	if format == CSVFormat {
+		writer.csv = NewCSVWriter(writer.writer, newStreamConfig(opts).csv)
+	}
+	return writer
+}
+
+// CreateMessageFile creates a stream file, its format and compression come from its name
+func CreateMessageFile(filename string, opts ...StreamOption) (*MessageWriter, error) {
+	format, compressed, err := StreamFormatFromFilename(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create file: %w", err)
+	}
+
+	writer := NewMessageWriter(file, format, compressed, opts...)
+	writer.closer = file
+	return writer, nil
+}
+
+// Write writes a message to the stream
+func (writer *MessageWriter) Write(message proto.Message) error {
+	var err error
+	switch writer.format {
+	case CSVFormat:
+		return writer.csv.Write(message)
+	case NDJSONFormat:
+		data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(message)
+		if err != nil {
+			return fmt.Errorf("cannot marshal proto message to json: %w", err)
+		}
+		writer.buffer = append(append(writer.buffer[:0], data...), '\n')
+	default:
+		var size [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(size[:], uint64(proto.Size(message)))
+		writer.buffer, err = proto.MarshalOptions{}.MarshalAppend(append(writer.buffer[:0], size[:n]...), message)
+		if err != nil {
+			return fmt.Errorf("cannot marshal proto message to binary: %w", err)
+		}
+	}
+
+	_, err = writer.writer.Write(writer.buffer)
+	if err != nil {
+		return fmt.Errorf("cannot write message: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the stream, and closes the file if the writer created it
+func (writer *MessageWriter) Close() error {
+	var err error
+	if writer.csv != nil {
+		err = writer.csv.Flush()
+	}
+	if err == nil {
+		err = writer.writer.Flush()
+	}
+	if err == nil && writer.gzip != nil {
+		err = writer.gzip.Close()
+	}
+	if writer.closer != nil {
+		closeErr := writer.closer.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot close stream: %w", err)
+	}
+	return nil
+}
+
+// MessageReader reads a stream of proto messages
+type MessageReader struct {
+	format StreamFormat
+	reader *bufio.Reader
+	csv    *CSVReader
+	closer io.Closer
+	buffer []byte
+	line   int
+}
+
+// NewMessageReader returns a reader of the messages of r, gzip compression is detected
+func NewMessageReader(r io.Reader, format StreamFormat, opts ...StreamOption) (*MessageReader, error) {
+	reader := bufio.NewReader(r)
+
+	magic, err := reader.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("cannot read stream: %w", err)
+	}
+	if bytes.Equal(magic, gzipMagic) {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read gzip stream: %w", err)
+		}
+		reader = bufio.NewReader(gzipReader)
+	}
+
+	messageReader := &MessageReader{
+		format: format,
+		reader: reader,
+	}
+	if format == CSVFormat {
+		messageReader.csv = NewCSVReader(reader, newStreamConfig(opts).csv)
+	}
+	return messageReader, nil
+}
+
+// OpenMessageFile opens a stream file, its format comes from its name
+func OpenMessageFile(filename string, opts ...StreamOption) (*MessageReader, error) {
+	format, _, err := StreamFormatFromFilename(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file: %w", err)
+	}
+
+	reader, err := NewMessageReader(file, format, opts...)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader.closer = file
+	return reader, nil
+}
+
+// Read reads the next message of the stream into message, returns io.EOF at the end of the stream
+func (reader *MessageReader) Read(message proto.Message) error {
+	switch reader.format {
+	case CSVFormat:
+		return reader.csv.Read(message)
+	case NDJSONFormat:
+		return reader.readJSONLine(message)
+	}
+
+	size, err := binary.ReadUvarint(reader.reader)
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read message size: %w", err)
+	}
+	if size > MaxStreamMessageSize {
+		return fmt.Errorf("message size %d is larger than %d", size, MaxStreamMessageSize)
+	}
+
+	if uint64(cap(reader.buffer)) < size {
+		reader.buffer = make([]byte, size)
+	}
+	reader.buffer = reader.buffer[:size]
+
+	_, err = io.ReadFull(reader.reader, reader.buffer)
+	if err != nil {
+		return fmt.Errorf("cannot read message: %w", err)
+	}
+
+	err = proto.Unmarshal(reader.buffer, message)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal message: %w", err)
+	}
+	return nil
+}
+
+func (reader *MessageReader) readJSONLine(message proto.Message) error {
+	for {
+		line, err := reader.reader.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			return io.EOF
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("cannot read line: %w", err)
+		}
+		reader.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		err = protojson.Unmarshal(line, message)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal line %d: %w", reader.line, err)
+		}
+		return nil
+	}
+}
+
+// Close closes the file if the reader opened it
+func (reader *MessageReader) Close() error {
+	if reader.closer != nil {
+		return reader.closer.Close()
+	}
+	return nil
+}
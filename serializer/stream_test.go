@@ -0,0 +1,74 @@
+package serializer_test
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/serializer"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMessageFile(t *testing.T) {
+	t.Parallel()
+
+	laptops := make([]*pcbook.Laptop, 100)
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+	}
+
+	for _, name := range []string{"laptops.ldpb", "laptops.bin.gz", "laptops.ndjson", "laptops.jsonl.gz"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			filename := filepath.Join(t.TempDir(), name)
+			writer, err := serializer.CreateMessageFile(filename)
+			require.NoError(t, err)
+			for _, laptop := range laptops {
+				require.NoError(t, writer.Write(laptop))
+			}
+			require.NoError(t, writer.Close())
+
+			reader, err := serializer.OpenMessageFile(filename)
+			require.NoError(t, err)
+			defer reader.Close()
+
+			for _, laptop := range laptops {
+				other := &pcbook.Laptop{}
+				require.NoError(t, reader.Read(other))
+				require.True(t, proto.Equal(laptop, other))
+			}
+			require.Equal(t, io.EOF, reader.Read(&pcbook.Laptop{}))
+		})
+	}
+
+	_, err := serializer.CreateMessageFile(filepath.Join(t.TempDir(), "laptops.json"))
+	require.Error(t, err)
+}
+
+func TestMessageReaderErrors(t *testing.T) {
+	t.Parallel()
+
+	reader, err := serializer.NewMessageReader(bytes.NewBufferString("\n{\"brand\": \"Apple\"}\n\n{\"brand\": 42}\n"), serializer.NDJSONFormat)
+	require.NoError(t, err)
+
+	laptop := &pcbook.Laptop{}
+	require.NoError(t, reader.Read(laptop))
+	require.Equal(t, "Apple", laptop.GetBrand())
+
+	err = reader.Read(laptop)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 4")
+
+	// a message size larger than the remaining data
+	reader, err = serializer.NewMessageReader(bytes.NewReader([]byte{0x10, 0x01}), serializer.DelimitedFormat)
+	require.NoError(t, err)
+	err = reader.Read(laptop)
+	require.Error(t, err)
+	require.NotEqual(t, io.EOF, err)
+}
@@ -0,0 +1,25 @@
+package serializer
+
+import (
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtobufToText convert proto message to protobuf text format
+func ProtobufToText(message proto.Message) (string, error) {
+	marshaler := prototext.MarshalOptions{
+		Multiline: true,
+		Indent:    "  ",
+	}
+
+	data, err := marshaler.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// TextToProtobuf convert protobuf text format to proto message
+func TextToProtobuf(data string, message proto.Message) error {
+	return prototext.Unmarshal([]byte(data), message)
+}
@@ -2,11 +2,11 @@ package service
 
 import (
 	"context"
+	"fmt"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
 // AuthInterceptor server interceptor for auth and authorization
@@ -26,7 +26,7 @@ func NewAuthInterceptor(jwtManager *JWTManager, accessRoles map[string][]string)
 // Unary returns a server interceptor function to authenticate and authorize an unary rpc
 func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		err := interceptor.authorize(ctx, info.FullMethod)
+		ctx, err := interceptor.authorize(ctx, info.FullMethod)
 		if err != nil {
 			return nil, err
 		}
@@ -37,42 +37,67 @@ func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 // Stream returns a server interceptor function to authenticate and authorize an stream rpc
 func (interceptor *AuthInterceptor) Stream() grpc.StreamServerInterceptor {
 	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		err := interceptor.authorize(ss.Context(), info.FullMethod)
+		ctx, err := interceptor.authorize(ss.Context(), info.FullMethod)
 		if err != nil {
 			return err
 		}
-		return handler(srv, ss)
+		return handler(srv, &authServerStream{ServerStream: ss, ctx: ctx})
 	}
 }
 
-func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) error {
+// authorize verifies the access token of a protected method and returns a context carrying the user's claims
+func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) (context.Context, error) {
 
 	accessRoles, ok := interceptor.accessRoles[method]
 	if !ok {
 		// public method
-		return nil
+		return ctx, nil
 	}
 
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return status.Error(codes.Unauthenticated, "metadata is not provided")
+		return nil, newError(codes.Unauthenticated, ReasonMissingAccessToken, "metadata is not provided")
 	}
 	values := md["authorization"]
 	if len(values) == 0 {
-		return status.Errorf(codes.Unauthenticated, "authorization token is not provided")
+		return nil, newError(codes.Unauthenticated, ReasonMissingAccessToken, "authorization token is not provided")
 	}
 
 	accessToken := values[0]
 	claims, err := interceptor.jwtManager.Verify(accessToken)
 	if err != nil {
-		return status.Errorf(codes.Unauthenticated, "access token is invalid: %v", err)
+		return nil, newError(codes.Unauthenticated, ReasonInvalidAccessToken, fmt.Sprintf("access token is invalid: %v", err))
 	}
 
 	for _, role := range accessRoles {
 		if role == claims.Role {
-			return nil
+			return ContextWithUserClaims(ctx, claims), nil
 		}
 	}
 
-	return status.Errorf(codes.PermissionDenied, "permission denied for user: %s", claims.Username)
+	return nil, newError(codes.PermissionDenied, ReasonPermissionDenied, fmt.Sprintf("permission denied for user: %s", claims.Username))
+}
+
+type userClaimsKey struct{}
+
+// ContextWithUserClaims returns a copy of ctx carrying the claims of the authenticated user
+func ContextWithUserClaims(ctx context.Context, claims *UserClaims) context.Context {
+	return context.WithValue(ctx, userClaimsKey{}, claims)
+}
+
+// UserClaimsFromContext returns the claims of the authenticated user, ok is false for public methods
+func UserClaimsFromContext(ctx context.Context) (*UserClaims, bool) {
+	claims, ok := ctx.Value(userClaimsKey{}).(*UserClaims)
+	return claims, ok && claims != nil
+}
+
+// authServerStream wraps a server stream to expose the context carrying the user's claims
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the stream
+func (stream *authServerStream) Context() context.Context {
+	return stream.ctx
 }
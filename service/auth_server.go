@@ -5,7 +5,6 @@ import (
 
 	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 // AuthServiceServer server for authentication
@@ -27,16 +26,16 @@ func (server *AuthServiceServer) Login(ctx context.Context, req *pcbook.LoginReq
 
 	user, err := server.userStore.Find(req.GetUsername())
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "cannot find user: %v", err)
+		return nil, internalError("cannot find user", err)
 	}
 
 	if user == nil || !user.IsCorrectPassword(req.GetPassword()) {
-		return nil, status.Errorf(codes.NotFound, "incorrect username/password: %v", err)
+		return nil, newError(codes.Unauthenticated, ReasonInvalidCredentials, "incorrect username/password")
 	}
 
 	token, err := server.jwtManager.Generate(user)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "cannot generate access token: %v", err)
+		return nil, internalError("cannot generate access token", err)
 	}
 
 	res := &pcbook.LoginResponse{
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ErrorDomain is the domain of the ErrorInfo detail of the errors returned by the services
+const ErrorDomain = "pcbook.mikhail-bigun.github.com"
+
+// reasons of the ErrorInfo detail of the errors returned by the services, they never change so clients can match them
+const (
+	ReasonLaptopNotFound        = "LAPTOP_NOT_FOUND"
+	ReasonLaptopAlreadyExists   = "LAPTOP_ALREADY_EXISTS"
+	ReasonInvalidLaptop         = "INVALID_LAPTOP"
+	ReasonInvalidExpression     = "INVALID_EXPRESSION"
+	ReasonInvalidPriceBounds    = "INVALID_PRICE_BOUNDS"
+	ReasonInvalidComparison     = "INVALID_COMPARISON"
+	ReasonInvalidWeights        = "INVALID_WEIGHTS"
+	ReasonEtagMismatch          = "ETAG_MISMATCH"
+	ReasonBatchAborted          = "BATCH_ABORTED"
+	ReasonBatchTooLarge         = "BATCH_TOO_LARGE"
+	ReasonImageNotFound         = "IMAGE_NOT_FOUND"
+	ReasonImageTooLarge         = "IMAGE_TOO_LARGE"
+	ReasonInvalidScore          = "INVALID_SCORE"
+	ReasonInvalidResumeToken    = "INVALID_RESUME_TOKEN"
+	ReasonResumeTokenOutOfRange = "RESUME_TOKEN_OUT_OF_RANGE"
+	ReasonWatcherTooSlow        = "WATCHER_TOO_SLOW"
+	ReasonInvalidCredentials    = "INVALID_CREDENTIALS"
+	ReasonMissingAccessToken    = "MISSING_ACCESS_TOKEN"
+	ReasonInvalidAccessToken    = "INVALID_ACCESS_TOKEN"
+	ReasonPermissionDenied      = "PERMISSION_DENIED"
+	ReasonRequestCanceled       = "REQUEST_CANCELED"
+	ReasonDeadlineExceeded      = "DEADLINE_EXCEEDED"
+	ReasonStreamFailed          = "STREAM_FAILED"
+	ReasonInternal              = "INTERNAL"
+)
+
+// resource types of the ResourceInfo detail of the errors
+const (
+	laptopResourceType = "pcbook.Laptop"
+	imageResourceType  = "pcbook.Image"
+)
+
+// watcherRetryDelay is the delay after which a watcher dropped for being too slow should resume
+const watcherRetryDelay = time.Second
+
+// newError returns a status error with an ErrorInfo detail of the reason, followed by the other details
+func newError(code codes.Code, reason string, message string, details ...protoiface.MessageV1) error {
+	all := append([]protoiface.MessageV1{&errdetails.ErrorInfo{Reason: reason, Domain: ErrorDomain}}, details...)
+
+	st := status.New(code, message)
+	detailed, err := st.WithDetails(all...)
+	if err != nil {
+		log.Printf("cannot add error details: %v", err)
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// notFoundError returns a NotFound error naming the missing resource
+func notFoundError(reason string, resourceType string, name string) error {
+	message := fmt.Sprintf("%s %q not found", resourceType, name)
+	return newError(codes.NotFound, reason, message, &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: name,
+		Description:  message,
+	})
+}
+
+// laptopStoreError maps an error of the laptop store for the laptop with the given ID
+func laptopStoreError(message string, id string, err error) error {
+	switch {
+	case errors.Is(err, ErrorNotFound):
+		return notFoundError(ReasonLaptopNotFound, laptopResourceType, id)
+	case errors.Is(err, ErrorAlreadyExists):
+		return newError(codes.AlreadyExists, ReasonLaptopAlreadyExists, fmt.Sprintf("%s: %v", message, err), &errdetails.ResourceInfo{
+			ResourceType: laptopResourceType,
+			ResourceName: id,
+			Description:  "a laptop with the same ID already exists",
+		})
+	case errors.Is(err, ErrorEtagMismatch):
+		return newError(codes.Aborted, ReasonEtagMismatch, fmt.Sprintf("%s: %v", message, err))
+	case errors.Is(err, ErrorBatchAborted):
+		return newError(codes.Aborted, ReasonBatchAborted, fmt.Sprintf("%s: %v", message, err))
+	default:
+		return internalError(message, err)
+	}
+}
+
+// badRequestError returns an InvalidArgument error with a violation of the field
+func badRequestError(reason string, field string, description string) error {
+	return newError(codes.InvalidArgument, reason, field+" "+description, &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: description}},
+	})
+}
+
+// internalError logs an unexpected error and returns it as Internal
+func internalError(message string, err error) error {
+	log.Printf("%s: %v", message, err)
+	return newError(codes.Internal, ReasonInternal, fmt.Sprintf("%s: %v", message, err))
+}
+
+// streamError logs a failed stream receive or send, keeping the code of err
+func streamError(message string, err error) error {
+	log.Printf("%s: %v", message, err)
+
+	code := status.Code(err)
+	if code == codes.OK {
+		code = codes.Unknown
+	}
+	return newError(code, ReasonStreamFailed, fmt.Sprintf("%s: %v", message, err))
+}
+
+func contextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		log.Print("request is canceled")
+		return newError(codes.Canceled, ReasonRequestCanceled, "request is canceled")
+	case context.DeadlineExceeded:
+		log.Print("deadline is exceeded")
+		return newError(codes.DeadlineExceeded, ReasonDeadlineExceeded, "deadline is exceeded")
+	default:
+		return nil
+	}
+}
+
+// watcherTooSlowError asks a watcher that fell behind to resume after a delay
+func watcherTooSlowError(err error) error {
+	return newError(codes.ResourceExhausted, ReasonWatcherTooSlow,
+		fmt.Sprintf("cannot keep up with laptop events, resume from the last token: %v", err),
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(watcherRetryDelay)})
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+)
+
+// SearchByScan matches every laptop of the store against the filter, as Search did before the indexes
+func (store *InMemoryLaptopStore) SearchByScan(ctx context.Context, filter *pcbook.Filter, found func(laptop *pcbook.Laptop) error) error {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	for _, laptop := range store.data {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if isMatchFilter(filter, laptop) {
+			err := found(deepCopy(laptop))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -13,6 +13,9 @@ import (
 type ImageStore interface {
 	// Save save new image
 	Save(laptopID string, imageType string, imageData bytes.Buffer) (string, error)
+
+	// Find finds the info of an image by ID, returns nil if there is no such image
+	Find(imageID string) (*ImageInfo, error)
 }
 
 // DiskImageStore stroes images on a disk
@@ -66,4 +69,18 @@ func (store *DiskImageStore) Save(laptopID string, imageType string, imageData b
 	}
 
 	return imageID.String(), nil
-}
\ No newline at end of file
+}
+
+// Find finds the info of an image by ID
+func (store *DiskImageStore) Find(imageID string) (*ImageInfo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	info := store.images[imageID]
+	if info == nil {
+		return nil, nil
+	}
+
+	other := *info
+	return &other, nil
+}
@@ -2,9 +2,11 @@ package service_test
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
@@ -16,6 +18,8 @@ import (
 	"github.com/mikhail-bigun/grpc-app-pcbook/service"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestClientRateLaptop(t *testing.T) {
@@ -64,6 +68,132 @@ func TestClientRateLaptop(t *testing.T) {
 	}
 }
 
+func TestClientRateLaptopInvalidScore(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
+
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	serverAddress := startTestLaptopServer(t, laptopStore, nil, ratingStore)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	stream, err := laptopClient.RateLaptop(context.Background())
+	require.NoError(t, err)
+
+	err = stream.Send(&pcbook.RateLaptopRequest{
+		LaptopId: laptop.GetId(),
+		Score:    1e9,
+	})
+	require.NoError(t, err)
+
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestClientGetRating(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
+
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	for _, score := range []float64{8, 7.5, 10} {
+		_, err := ratingStore.Add(laptop.GetId(), score)
+		require.NoError(t, err)
+	}
+
+	serverAddress := startTestLaptopServer(t, laptopStore, nil, ratingStore)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	res, err := laptopClient.GetRating(context.Background(), &pcbook.GetRatingRequest{LaptopId: laptop.GetId()})
+	require.NoError(t, err)
+	require.Equal(t, laptop.GetId(), res.GetLaptopId())
+	require.EqualValues(t, 3, res.GetRating().GetTimesRated())
+	require.Equal(t, 8.5, res.GetRating().GetAverageScore())
+	require.Equal(t, 7.5, res.GetRating().GetMinScore())
+	require.Equal(t, 10.0, res.GetRating().GetMaxScore())
+	require.Equal(t, []uint32{0, 0, 0, 0, 0, 0, 0, 2, 0, 1}, res.GetRating().GetHistogram())
+
+	_, err = laptopClient.GetRating(context.Background(), &pcbook.GetRatingRequest{LaptopId: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestClientTopRatedLaptops(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
+
+	scores := [][]float64{
+		{10},
+		{9, 9, 9, 9, 9, 9},
+		{2, 3, 2},
+	}
+	laptopIDs := make([]string, len(scores))
+	for i := range scores {
+		laptop := sample.NewLaptop()
+		err := laptopStore.Save(laptop)
+		require.NoError(t, err)
+		laptopIDs[i] = laptop.GetId()
+
+		for _, score := range scores[i] {
+			_, err := ratingStore.Add(laptop.GetId(), score)
+			require.NoError(t, err)
+		}
+	}
+
+	serverAddress := startTestLaptopServer(t, laptopStore, nil, ratingStore)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	req := &pcbook.TopRatedLaptopsRequest{
+		Limit:         5,
+		MinTimesRated: 2,
+	}
+	stream, err := laptopClient.TopRatedLaptops(context.Background(), req)
+	require.NoError(t, err)
+
+	expectedIDs := []string{laptopIDs[1], laptopIDs[2]}
+	for idx := 0; ; idx++ {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			require.Equal(t, len(expectedIDs), idx)
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, expectedIDs[idx], res.GetLaptop().GetId())
+		require.EqualValues(t, len(scores[idx+1]), res.GetRating().GetTimesRated())
+	}
+
+	// a rated laptop missing from the store does not count in the limit
+	missingID := sample.NewLaptop().GetId()
+	for i := 0; i < 6; i++ {
+		_, err := ratingStore.Add(missingID, 10)
+		require.NoError(t, err)
+	}
+
+	req.Limit = 2
+	stream, err = laptopClient.TopRatedLaptops(context.Background(), req)
+	require.NoError(t, err)
+
+	ids := []string{}
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		ids = append(ids, res.GetLaptop().GetId())
+	}
+	require.Equal(t, expectedIDs, ids)
+}
+
 func TestClientUploadImage(t *testing.T) {
 	t.Parallel()
 
@@ -273,3 +403,162 @@ func TestClientSearchLaptop(t *testing.T) {
 
 	require.Equal(t, len(expectedIDs), found)
 }
+
+func TestClientWatchLaptops(t *testing.T) {
+	t.Parallel()
+
+	filter := &pcbook.Filter{
+		MaxPriceUsd: 2000,
+	}
+
+	laptopStore := service.NewInMemoryLaptopStore()
+
+	first := sample.NewLaptop()
+	err := laptopStore.Save(first)
+	require.NoError(t, err)
+
+	cheap := sample.NewLaptop()
+	cheap.PriceUsd = 1500
+	err = laptopStore.Save(cheap)
+	require.NoError(t, err)
+
+	expensive := sample.NewLaptop()
+	expensive.PriceUsd = 2500
+	err = laptopStore.Save(expensive)
+	require.NoError(t, err)
+
+	cheap.PriceUsd = 1400
+	err = laptopStore.Update(cheap)
+	require.NoError(t, err)
+
+	err = laptopStore.Delete(cheap.GetId())
+	require.NoError(t, err)
+
+	serverAddress := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// resume right after the first laptop was created
+	req := &pcbook.WatchLaptopsRequest{
+		Filter:      filter,
+		ResumeToken: "1",
+	}
+	stream, err := laptopClient.WatchLaptops(ctx, req)
+	require.NoError(t, err)
+
+	expectedEvents := []pcbook.WatchLaptopsResponse_EventType{
+		pcbook.WatchLaptopsResponse_CREATED,
+		pcbook.WatchLaptopsResponse_UPDATED,
+		pcbook.WatchLaptopsResponse_DELETED,
+	}
+	for _, eventType := range expectedEvents {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, eventType, res.GetEventType())
+		require.Equal(t, cheap.GetId(), res.GetLaptop().GetId())
+	}
+
+	// the watcher is registered once the backlog is replayed, so new events follow
+	live := sample.NewLaptop()
+	live.PriceUsd = 1999
+	err = laptopStore.Save(live)
+	require.NoError(t, err)
+
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, pcbook.WatchLaptopsResponse_CREATED, res.GetEventType())
+	require.Equal(t, live.GetId(), res.GetLaptop().GetId())
+	require.Equal(t, "6", res.GetResumeToken())
+
+	// updates out of the filter are reported once, and updates back into it as updates
+	for _, price := range []float64{2100, 2200, 1900} {
+		live.PriceUsd = price
+		err = laptopStore.Update(live)
+		require.NoError(t, err)
+	}
+
+	res, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, pcbook.WatchLaptopsResponse_LEFT_FILTER, res.GetEventType())
+	require.Equal(t, 2100.0, res.GetLaptop().GetPriceUsd())
+	require.Equal(t, "7", res.GetResumeToken())
+
+	res, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, pcbook.WatchLaptopsResponse_UPDATED, res.GetEventType())
+	require.Equal(t, 1900.0, res.GetLaptop().GetPriceUsd())
+	require.Equal(t, "9", res.GetResumeToken())
+
+	stream, err = laptopClient.WatchLaptops(ctx, &pcbook.WatchLaptopsRequest{ResumeToken: "999"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+}
+
+func TestClientGetLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	serverAddress := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	res, err := laptopClient.GetLaptop(context.Background(), &pcbook.GetLaptopRequest{Id: laptop.GetId()})
+	require.NoError(t, err)
+	requireSameLaptop(t, laptop, res.GetLaptop())
+
+	_, err = laptopClient.GetLaptop(context.Background(), &pcbook.GetLaptopRequest{Id: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestClientDownloadImage(t *testing.T) {
+	t.Parallel()
+
+	testImageFolder := "../tmp"
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(testImageFolder)
+
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	imageData, err := ioutil.ReadFile(fmt.Sprintf("%s/laptop.jpg", testImageFolder))
+	require.NoError(t, err)
+
+	imageID, err := imageStore.Save(laptop.GetId(), ".jpg", *bytes.NewBuffer(imageData))
+	require.NoError(t, err)
+	defer os.Remove(fmt.Sprintf("%s/%s.jpg", testImageFolder, imageID))
+
+	serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	stream, err := laptopClient.DownloadImage(context.Background(), &pcbook.DownloadImageRequest{ImageId: imageID})
+	require.NoError(t, err)
+
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, laptop.GetId(), res.GetInfo().GetLaptopId())
+	require.Equal(t, ".jpg", res.GetInfo().GetImageType())
+
+	downloaded := bytes.Buffer{}
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		downloaded.Write(res.GetDataChunk())
+	}
+	require.Equal(t, imageData, downloaded.Bytes())
+
+	stream, err = laptopClient.DownloadImage(context.Background(), &pcbook.DownloadImageRequest{ImageId: "unknown"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+)
+
+const (
+	// minComparedLaptops and maxComparedLaptops are the bounds of the number of laptops of a comparison
+	minComparedLaptops = 2
+	maxComparedLaptops = 5
+
+	// kgPerLb is the weight of a pound in kilograms
+	kgPerLb = 0.45359237
+	// bitsPerGB is the number of bits of a gigabyte
+	bitsPerGB = 1 << 33
+)
+
+// comparisonSpec is a row of a laptop comparison
+type comparisonSpec struct {
+	name  string
+	unit  string
+	order pcbook.ComparisonRow_Order
+	// value returns the value of a laptop with its rating, nil if it was never rated, false if it has none
+	value func(laptop *pcbook.Laptop, rating *Rating) (float64, bool)
+}
+
+// comparisonSpecs are the rows of a laptop comparison, memory sizes are in GB
+var comparisonSpecs = []comparisonSpec{
+	{name: "price", unit: "USD", order: pcbook.ComparisonRow_LOWER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return laptop.GetPriceUsd(), true
+	}},
+	{name: "cpu_cores", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return float64(laptop.GetCpu().GetNumberOfCores()), laptop.GetCpu() != nil
+	}},
+	{name: "cpu_threads", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return float64(laptop.GetCpu().GetNumberOfThreads()), laptop.GetCpu() != nil
+	}},
+	{name: "cpu_min_ghz", unit: "GHz", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return laptop.GetCpu().GetMinGhz(), laptop.GetCpu() != nil
+	}},
+	{name: "cpu_max_ghz", unit: "GHz", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return laptop.GetCpu().GetMaxGhz(), laptop.GetCpu() != nil
+	}},
+	{name: "gpu_max_ghz", unit: "GHz", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return bestGPU(laptop, func(gpu *pcbook.GPU) float64 { return gpu.GetMaxGhz() })
+	}},
+	{name: "gpu_memory", unit: "GB", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return bestGPU(laptop, func(gpu *pcbook.GPU) float64 { return toGB(gpu.GetMemory()) })
+	}},
+	{name: "ram", unit: "GB", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return toGB(laptop.GetRam()), laptop.GetRam() != nil
+	}},
+	{name: "storage_ssd", unit: "GB", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return totalStorage(laptop, pcbook.Storage_SSD), true
+	}},
+	{name: "storage_hdd", unit: "GB", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return totalStorage(laptop, pcbook.Storage_HDD), true
+	}},
+	{name: "screen_size", unit: "inch", order: pcbook.ComparisonRow_NONE, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return float64(laptop.GetScreen().GetSizeInch()), laptop.GetScreen() != nil
+	}},
+	{name: "weight_kg", unit: "kg", order: pcbook.ComparisonRow_LOWER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return weightKg(laptop)
+	}},
+	{name: "weight_lb", unit: "lb", order: pcbook.ComparisonRow_LOWER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		kg, ok := weightKg(laptop)
+		return kg / kgPerLb, ok
+	}},
+	{name: "release_year", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return float64(laptop.GetReleaseYear()), true
+	}},
+	{name: "rating", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		return averageScore(rating)
+	}},
+	{name: "times_rated", order: pcbook.ComparisonRow_HIGHER_IS_BETTER, value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+		if rating == nil {
+			return 0, true
+		}
+		return float64(rating.Count), true
+	}},
+}
+
+// compareLaptops returns the comparison rows of the laptops, ratings has the rating of each laptop, nil if never rated
+func compareLaptops(laptops []*pcbook.Laptop, ratings []*Rating) []*pcbook.ComparisonRow {
+	rows := make([]*pcbook.ComparisonRow, len(comparisonSpecs))
+	for i, spec := range comparisonSpecs {
+		row := &pcbook.ComparisonRow{
+			Name:  spec.name,
+			Unit:  spec.unit,
+			Order: spec.order,
+			Cells: make([]*pcbook.ComparisonCell, len(laptops)),
+		}
+		for j, laptop := range laptops {
+			value, ok := spec.value(laptop, ratings[j])
+			row.Cells[j] = &pcbook.ComparisonCell{Value: value, Missing: !ok}
+		}
+		flagBest(row)
+		rows[i] = row
+	}
+	return rows
+}
+
+// flagBest flags the best cells of an ordered row, none if the values are all equal
+func flagBest(row *pcbook.ComparisonRow) {
+	if row.GetOrder() == pcbook.ComparisonRow_NONE {
+		return
+	}
+
+	var best *pcbook.ComparisonCell
+	distinct := false
+	for _, cell := range row.GetCells() {
+		if cell.GetMissing() {
+			continue
+		}
+		if best == nil {
+			best = cell
+			continue
+		}
+		if cell.GetValue() != best.GetValue() {
+			distinct = true
+		}
+		if isBetter(row.GetOrder(), cell.GetValue(), best.GetValue()) {
+			best = cell
+		}
+	}
+	if best == nil || (!distinct && countPresent(row) > 1) {
+		return
+	}
+
+	for _, cell := range row.GetCells() {
+		cell.Best = !cell.GetMissing() && cell.GetValue() == best.GetValue()
+	}
+}
+
+func isBetter(order pcbook.ComparisonRow_Order, value float64, than float64) bool {
+	if order == pcbook.ComparisonRow_LOWER_IS_BETTER {
+		return value < than
+	}
+	return value > than
+}
+
+func countPresent(row *pcbook.ComparisonRow) int {
+	present := 0
+	for _, cell := range row.GetCells() {
+		if !cell.GetMissing() {
+			present++
+		}
+	}
+	return present
+}
+
+// bestGPU returns the highest value of the GPUs of a laptop, false if it has none
+func bestGPU(laptop *pcbook.Laptop, value func(gpu *pcbook.GPU) float64) (float64, bool) {
+	best := 0.0
+	for _, gpu := range laptop.GetGpus() {
+		if v := value(gpu); v > best {
+			best = v
+		}
+	}
+	return best, len(laptop.GetGpus()) > 0
+}
+
+// weightKg returns the weight of a laptop in kg, false if it has none
+func weightKg(laptop *pcbook.Laptop) (float64, bool) {
+	switch weight := laptop.GetWeight().(type) {
+	case *pcbook.Laptop_WeightKg:
+		return weight.WeightKg, true
+	case *pcbook.Laptop_WeightLb:
+		return weight.WeightLb * kgPerLb, true
+	default:
+		return 0, false
+	}
+}
+
+// averageScore returns the average score of a rating, false if the laptop was never rated
+func averageScore(rating *Rating) (float64, bool) {
+	if rating == nil || rating.Count == 0 {
+		return 0, false
+	}
+	return rating.Average(), true
+}
+
+// totalStorage returns the total size in GB of the storages of a laptop with the driver
+func totalStorage(laptop *pcbook.Laptop, driver pcbook.Storage_Driver) float64 {
+	bits := uint64(0)
+	for _, storage := range laptop.GetStorages() {
+		if storage.GetDriver() == driver {
+			bits += toBit(storage.GetMemory())
+		}
+	}
+	return float64(bits) / bitsPerGB
+}
+
+// toGB converts a memory size to GB
+func toGB(memory *pcbook.Memory) float64 {
+	return float64(toBit(memory)) / bitsPerGB
+}
@@ -0,0 +1,99 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerCompareLaptops(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
+
+	light := sample.NewLaptop()
+	light.Ram = &pcbook.Memory{Value: 16384, Unit: pcbook.Memory_MEGABYTE}
+	light.Storages = []*pcbook.Storage{
+		{Driver: pcbook.Storage_SSD, Memory: &pcbook.Memory{Value: 512, Unit: pcbook.Memory_GIGABYTE}},
+		{Driver: pcbook.Storage_SSD, Memory: &pcbook.Memory{Value: 1, Unit: pcbook.Memory_TERABYTE}},
+	}
+	light.Weight = &pcbook.Laptop_WeightLb{WeightLb: 2.2}
+	light.PriceUsd = 1500
+
+	heavy := sample.NewLaptop()
+	heavy.Ram = &pcbook.Memory{Value: 32, Unit: pcbook.Memory_GIGABYTE}
+	heavy.Storages = []*pcbook.Storage{
+		{Driver: pcbook.Storage_HDD, Memory: &pcbook.Memory{Value: 2, Unit: pcbook.Memory_TERABYTE}},
+	}
+	heavy.Gpus = nil
+	heavy.Weight = &pcbook.Laptop_WeightKg{WeightKg: 2.5}
+	heavy.PriceUsd = 1500
+
+	require.NoError(t, laptopStore.Save(light))
+	require.NoError(t, laptopStore.Save(heavy))
+	_, err := ratingStore.Add(heavy.GetId(), 8)
+	require.NoError(t, err)
+
+	server := service.NewLaptopServer(laptopStore, nil, ratingStore)
+	res, err := server.CompareLaptops(context.Background(), &pcbook.CompareLaptopsRequest{
+		LaptopIds: []string{light.GetId(), heavy.GetId()},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.GetLaptops(), 2)
+	require.Equal(t, light.GetId(), res.GetLaptops()[0].GetId())
+
+	rows := make(map[string]*pcbook.ComparisonRow)
+	for _, row := range res.GetRows() {
+		require.Len(t, row.GetCells(), 2)
+		rows[row.GetName()] = row
+	}
+
+	type cell struct {
+		value   float64
+		missing bool
+		best    bool
+	}
+	cells := func(name string) []cell {
+		row := rows[name]
+		require.NotNil(t, row, name)
+		result := []cell{}
+		for _, c := range row.GetCells() {
+			result = append(result, cell{value: c.GetValue(), missing: c.GetMissing(), best: c.GetBest()})
+		}
+		return result
+	}
+
+	require.Equal(t, "GB", rows["ram"].GetUnit())
+	require.Equal(t, []cell{{value: 16}, {value: 32, best: true}}, cells("ram"))
+	require.Equal(t, []cell{{value: 1536, best: true}, {value: 0}}, cells("storage_ssd"))
+	require.Equal(t, []cell{{value: 0}, {value: 2048, best: true}}, cells("storage_hdd"))
+	require.Equal(t, []cell{{value: 1500}, {value: 1500}}, cells("price"))
+	require.Equal(t, pcbook.ComparisonRow_LOWER_IS_BETTER, rows["weight_kg"].GetOrder())
+	require.InDelta(t, 0.998, cells("weight_kg")[0].value, 0.001)
+	require.True(t, cells("weight_kg")[0].best)
+	require.InDelta(t, 5.512, cells("weight_lb")[1].value, 0.001)
+	require.True(t, cells("gpu_memory")[1].missing)
+	require.True(t, cells("gpu_memory")[0].best)
+	require.Equal(t, []cell{{missing: true}, {value: 8, best: true}}, cells("rating"))
+
+	for _, ids := range [][]string{
+		{light.GetId()},
+		{light.GetId(), light.GetId()},
+		{light.GetId(), heavy.GetId(), "a", "b", "c", "d"},
+	} {
+		_, err = server.CompareLaptops(context.Background(), &pcbook.CompareLaptopsRequest{LaptopIds: ids})
+		require.Equal(t, codes.InvalidArgument, status.Code(err), "%v", ids)
+	}
+
+	_, err = server.CompareLaptops(context.Background(), &pcbook.CompareLaptopsRequest{
+		LaptopIds: []string{light.GetId(), sample.NewLaptop().GetId()},
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,721 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/serializer"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// maxExpressionLength is the maximum length in bytes of a laptop expression
+	maxExpressionLength = 4096
+	// maxExpressionDepth is the maximum nesting of the conditions of a laptop expression
+	maxExpressionDepth = 64
+)
+
+// fieldAliases are the short names of the laptop fields in expressions
+var fieldAliases = map[string]string{
+	"cores":   "number_of_cores",
+	"threads": "number_of_threads",
+	"price":   "price_usd",
+}
+
+var (
+	laptopDescriptor = (&pcbook.Laptop{}).ProtoReflect().Descriptor()
+	memoryDescriptor = (&pcbook.Memory{}).ProtoReflect().Descriptor()
+)
+
+// ExpressionError is an invalid laptop expression, Position is the byte offset of the error counted from 1
+type ExpressionError struct {
+	Position int
+	Message  string
+}
+
+func (err *ExpressionError) Error() string {
+	return fmt.Sprintf("position %d: %s", err.Position, err.Message)
+}
+
+// LaptopExpression is a compiled condition on the laptops
+type LaptopExpression struct {
+	text  string
+	match exprPredicate
+}
+
+// CompileLaptopExpression parses and type-checks a condition on the fields of pcbook.Laptop, e.g.
+//
+//	cpu.cores >= 8 && (brand == "Dell" || gpus.exists(g, g.memory >= 6GB))
+//
+// Fields are selected by their proto names, with cores, threads and price as short names. Numbers,
+// memory sizes like 16GB, strings and booleans compare with == != < <= > >=, enums with the name of
+// a value, lists with list.exists(x, condition) and list.all(x, condition). Conditions combine
+// with && || ! and parentheses. The returned error is an *ExpressionError
+func CompileLaptopExpression(text string) (*LaptopExpression, error) {
+	if len(text) > maxExpressionLength {
+		return nil, &ExpressionError{
+			Position: maxExpressionLength + 1,
+			Message:  fmt.Sprintf("expression is longer than %d bytes", maxExpressionLength),
+		}
+	}
+
+	tokens, err := lexExpression(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{
+		tokens:    tokens,
+		variables: []exprVariable{{message: laptopDescriptor}},
+	}
+	match, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != tokenEOF {
+		return nil, p.errorf(token.position, "unexpected %s", token)
+	}
+
+	return &LaptopExpression{text: text, match: match}, nil
+}
+
+// Match returns whether the laptop satisfies the expression
+func (expression *LaptopExpression) Match(laptop *pcbook.Laptop) bool {
+	return expression.match(exprScope{laptop.ProtoReflect()})
+}
+
+func (expression *LaptopExpression) String() string {
+	return expression.text
+}
+
+type exprTokenKind int
+
+const (
+	tokenEOF exprTokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenMemory
+	tokenString
+	tokenOperator
+)
+
+type exprToken struct {
+	kind     exprTokenKind
+	text     string
+	position int
+}
+
+func (token exprToken) String() string {
+	switch token.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(token.text)
+	default:
+		return fmt.Sprintf("%q", token.text)
+	}
+}
+
+// exprOperators are the operators and punctuation, the longest first
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", ",", "."}
+
+func lexExpression(text string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		token := exprToken{position: i + 1}
+
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case r == '_' || unicode.IsLetter(r):
+			end := i + scanExpression(text[i:], func(r rune) bool {
+				return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+			})
+			token.kind, token.text = tokenIdent, text[i:end]
+			i = end
+		case unicode.IsDigit(r):
+			end := i + scanExpression(text[i:], func(r rune) bool { return r == '.' || unicode.IsDigit(r) })
+			token.kind = tokenNumber
+			if units := scanExpression(text[end:], unicode.IsLetter); units > 0 {
+				token.kind = tokenMemory
+				end += units
+			}
+			token.text = text[i:end]
+			i = end
+		case r == '"':
+			end := closingQuote(text, i)
+			if end < 0 {
+				return nil, &ExpressionError{Position: token.position, Message: "unterminated string"}
+			}
+			value, err := strconv.Unquote(text[i:end])
+			if err != nil {
+				return nil, &ExpressionError{Position: token.position, Message: fmt.Sprintf("invalid string %s", text[i:end])}
+			}
+			token.kind, token.text = tokenString, value
+			i = end
+		default:
+			for _, operator := range exprOperators {
+				if strings.HasPrefix(text[i:], operator) {
+					token.kind, token.text = tokenOperator, operator
+					break
+				}
+			}
+			if token.kind != tokenOperator {
+				return nil, &ExpressionError{Position: token.position, Message: fmt.Sprintf("unexpected character %q", r)}
+			}
+			i += len(token.text)
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return append(tokens, exprToken{kind: tokenEOF, position: len(text) + 1}), nil
+}
+
+// scanExpression returns the length of the prefix of text made of the runes accepted by f
+func scanExpression(text string, f func(r rune) bool) int {
+	end := strings.IndexFunc(text, func(r rune) bool { return !f(r) })
+	if end < 0 {
+		return len(text)
+	}
+	return end
+}
+
+// closingQuote returns the end of the string starting at the quote at start, -1 if it is not closed
+func closingQuote(text string, start int) int {
+	for i := start + 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// exprScope holds the laptop at 0 and the elements bound by the enclosing exists and all
+type exprScope []protoreflect.Message
+
+type exprPredicate func(scope exprScope) bool
+
+type exprKind int
+
+const (
+	exprBool exprKind = iota + 1
+	exprNumber
+	exprString
+	exprMemory
+	exprEnum
+	exprList
+)
+
+func (kind exprKind) String() string {
+	switch kind {
+	case exprBool:
+		return "bool"
+	case exprNumber:
+		return "number"
+	case exprString:
+		return "string"
+	case exprMemory:
+		return "memory size"
+	case exprEnum:
+		return "enum"
+	default:
+		return "list"
+	}
+}
+
+// exprValue is the value of an operand, memory sizes are in bits and enums are their numbers
+type exprValue struct {
+	boolean bool
+	number  float64
+	text    string
+	list    protoreflect.List
+}
+
+// exprOperand is a typed field or literal of an expression
+type exprOperand struct {
+	kind     exprKind
+	enum     protoreflect.EnumDescriptor
+	literal  bool
+	text     string
+	position int
+	eval     func(scope exprScope) exprValue
+}
+
+func (operand exprOperand) String() string {
+	if operand.kind == exprEnum {
+		return string(operand.enum.Name())
+	}
+	return operand.kind.String()
+}
+
+// exprVariable is the laptop or an element bound by exists or all
+type exprVariable struct {
+	name    string
+	message protoreflect.MessageDescriptor
+}
+
+// exprPath is a field selected from a variable
+type exprPath struct {
+	name     string
+	position int
+	scope    int
+	fields   []protoreflect.FieldDescriptor
+	// message is the message of the last field if more fields can be selected from it
+	message protoreflect.MessageDescriptor
+}
+
+func (path *exprPath) last() protoreflect.FieldDescriptor {
+	if len(path.fields) == 0 {
+		return nil
+	}
+	return path.fields[len(path.fields)-1]
+}
+
+func (path *exprPath) list() bool {
+	field := path.last()
+	return field != nil && field.IsList()
+}
+
+// comparisons hold for the order of the compared values, -1, 0 or 1
+var comparisons = map[string]func(order int) bool{
+	"==": func(order int) bool { return order == 0 },
+	"!=": func(order int) bool { return order != 0 },
+	"<":  func(order int) bool { return order < 0 },
+	"<=": func(order int) bool { return order <= 0 },
+	">":  func(order int) bool { return order > 0 },
+	">=": func(order int) bool { return order >= 0 },
+}
+
+// exprParser compiles the tokens of an expression by recursive descent:
+//
+//	or         = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | "(" or ")" | comparison
+//	comparison = operand [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) operand ]
+//	operand    = number | memory | string | "true" | "false" | path [ "." ( "exists" | "all" ) "(" ident "," or ")" ]
+//	path       = ident { "." ident }
+type exprParser struct {
+	tokens    []exprToken
+	pos       int
+	depth     int
+	variables []exprVariable
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *exprParser) accept(operator string) bool {
+	token := p.peek()
+	if token.kind != tokenOperator || token.text != operator {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *exprParser) expect(operator string) error {
+	if !p.accept(operator) {
+		return p.errorf(p.peek().position, "expected %q, found %s", operator, p.peek())
+	}
+	return nil
+}
+
+func (p *exprParser) errorf(position int, format string, args ...interface{}) error {
+	return &ExpressionError{Position: position, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *exprParser) parseOr() (exprPredicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		either := left
+		left = func(scope exprScope) bool {
+			return either(scope) || right(scope)
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprPredicate, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		both := left
+		left = func(scope exprScope) bool {
+			return both(scope) && right(scope)
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprPredicate, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExpressionDepth {
+		return nil, p.errorf(p.peek().position, "conditions are nested more than %d times", maxExpressionDepth)
+	}
+
+	if p.accept("!") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(scope exprScope) bool {
+			return !inner(scope)
+		}, nil
+	}
+
+	if p.accept("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprPredicate, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	operator := p.peek()
+	if operator.kind != tokenOperator || comparisons[operator.text] == nil {
+		if left.kind != exprBool {
+			return nil, p.errorf(left.position, "%s is a %s, not a condition", left.text, left)
+		}
+		return func(scope exprScope) bool {
+			return left.eval(scope).boolean
+		}, nil
+	}
+	p.next()
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return p.compare(left, operator, right)
+}
+
+func (p *exprParser) compare(left exprOperand, operator exprToken, right exprOperand) (exprPredicate, error) {
+	// an enum compares with the name of one of its values
+	if left.kind == exprString && left.literal && right.kind == exprEnum {
+		left, right = right, left
+	}
+	if left.kind == exprEnum && right.kind == exprString && right.literal {
+		value := left.enum.Values().ByName(protoreflect.Name(strings.ToUpper(right.text)))
+		if value == nil {
+			return nil, p.errorf(right.position, "unknown %s value %q, expected one of: %s", left, right.text, enumValueNames(left.enum))
+		}
+		number := float64(value.Number())
+		right = exprOperand{kind: exprEnum, enum: left.enum, position: right.position, eval: func(scope exprScope) exprValue {
+			return exprValue{number: number}
+		}}
+	}
+
+	if left.kind == exprList || right.kind == exprList {
+		return nil, p.errorf(operator.position, "cannot compare lists, use exists or all")
+	}
+	if left.kind != right.kind || (left.kind == exprEnum && left.enum.FullName() != right.enum.FullName()) {
+		return nil, p.errorf(operator.position, "cannot compare %s with %s", left, right)
+	}
+	ordered := left.kind == exprNumber || left.kind == exprMemory
+	if !ordered && operator.text != "==" && operator.text != "!=" {
+		return nil, p.errorf(operator.position, "%s values can only be compared with == and !=", left)
+	}
+
+	holds := comparisons[operator.text]
+	order := compareNumbers
+	switch left.kind {
+	case exprBool:
+		order = compareBools
+	case exprString:
+		order = compareStrings
+	}
+
+	return func(scope exprScope) bool {
+		return holds(order(left.eval(scope), right.eval(scope)))
+	}, nil
+}
+
+func compareNumbers(a exprValue, b exprValue) int {
+	switch {
+	case a.number < b.number:
+		return -1
+	case a.number > b.number:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareBools(a exprValue, b exprValue) int {
+	if a.boolean == b.boolean {
+		return 0
+	}
+	return 1
+}
+
+func compareStrings(a exprValue, b exprValue) int {
+	return strings.Compare(a.text, b.text)
+}
+
+func enumValueNames(enum protoreflect.EnumDescriptor) string {
+	names := make([]string, enum.Values().Len())
+	for i := range names {
+		names[i] = string(enum.Values().Get(i).Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+func (p *exprParser) parseOperand() (exprOperand, error) {
+	token := p.next()
+	operand := exprOperand{text: token.text, position: token.position, literal: true}
+
+	switch token.kind {
+	case tokenNumber:
+		number, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return operand, p.errorf(token.position, "invalid number %q", token.text)
+		}
+		operand.kind = exprNumber
+		operand.eval = func(scope exprScope) exprValue { return exprValue{number: number} }
+		return operand, nil
+	case tokenMemory:
+		memory, err := serializer.ParseMemory(token.text)
+		if err != nil {
+			return operand, p.errorf(token.position, "invalid memory size %q, expected a size like 16GB", token.text)
+		}
+		bits := float64(toBit(memory))
+		operand.kind = exprMemory
+		operand.eval = func(scope exprScope) exprValue { return exprValue{number: bits} }
+		return operand, nil
+	case tokenString:
+		text := token.text
+		operand.kind = exprString
+		operand.eval = func(scope exprScope) exprValue { return exprValue{text: text} }
+		return operand, nil
+	case tokenIdent:
+		if token.text == "true" || token.text == "false" {
+			boolean := token.text == "true"
+			operand.kind = exprBool
+			operand.eval = func(scope exprScope) exprValue { return exprValue{boolean: boolean} }
+			return operand, nil
+		}
+		return p.parsePath(token)
+	default:
+		return operand, p.errorf(token.position, "expected a field or a value, found %s", token)
+	}
+}
+
+func (p *exprParser) parsePath(first exprToken) (exprOperand, error) {
+	path := &exprPath{name: first.text, position: first.position, message: laptopDescriptor}
+	if scope := p.variable(first.text); scope > 0 {
+		path.scope = scope
+		path.message = p.variables[scope].message
+	} else if err := p.selectField(path, first); err != nil {
+		return exprOperand{}, err
+	}
+
+	for p.accept(".") {
+		token := p.next()
+		if token.kind != tokenIdent {
+			return exprOperand{}, p.errorf(token.position, "expected a field name, found %s", token)
+		}
+
+		if path.list() {
+			if token.text == "exists" || token.text == "all" {
+				return p.parseQuantifier(path, token)
+			}
+			return exprOperand{}, p.errorf(token.position, "%s is a list, use %s.exists(x, condition) or %s.all(x, condition)", path.name, path.name, path.name)
+		}
+
+		if err := p.selectField(path, token); err != nil {
+			return exprOperand{}, err
+		}
+		path.name += "." + token.text
+	}
+
+	return p.pathOperand(path)
+}
+
+// variable returns the scope index of the variable bound by an enclosing exists or all, 0 if there is none
+func (p *exprParser) variable(name string) int {
+	for i := len(p.variables) - 1; i > 0; i-- {
+		if p.variables[i].name == name {
+			return i
+		}
+	}
+	return 0
+}
+
+func (p *exprParser) selectField(path *exprPath, token exprToken) error {
+	if path.message == nil {
+		return p.errorf(token.position, "%s has no field %s", path.name, token.text)
+	}
+
+	name := token.text
+	if alias, ok := fieldAliases[name]; ok && path.message.Fields().ByName(protoreflect.Name(name)) == nil {
+		name = alias
+	}
+	field := path.message.Fields().ByName(protoreflect.Name(name))
+	if field == nil {
+		return p.errorf(token.position, "unknown field %s of %s", token.text, path.message.Name())
+	}
+
+	path.fields = append(path.fields, field)
+	path.message = nil
+	if field.Message() != nil && !field.IsList() && field.Message().FullName() != memoryDescriptor.FullName() {
+		path.message = field.Message()
+	}
+	return nil
+}
+
+func (p *exprParser) pathOperand(path *exprPath) (exprOperand, error) {
+	operand := exprOperand{text: path.name, position: path.position}
+	field := path.last()
+	if field == nil {
+		return operand, p.errorf(path.position, "%s is an element of a list, select one of its fields", path.name)
+	}
+	if path.message != nil {
+		return operand, p.errorf(path.position, "%s is a message, select one of its fields", path.name)
+	}
+
+	scope := path.scope
+	parents := path.fields[:len(path.fields)-1]
+	get := func(s exprScope) protoreflect.Value {
+		message := s[scope]
+		for _, parent := range parents {
+			message = message.Get(parent).Message()
+		}
+		return message.Get(field)
+	}
+
+	switch {
+	case field.IsList():
+		if field.Message() == nil {
+			return operand, p.errorf(path.position, "%s is a list of values, which is not supported", path.name)
+		}
+		operand.kind = exprList
+		operand.eval = func(s exprScope) exprValue { return exprValue{list: get(s).List()} }
+	case field.Message() != nil:
+		operand.kind = exprMemory
+		operand.eval = func(s exprScope) exprValue {
+			memory, _ := get(s).Message().Interface().(*pcbook.Memory)
+			return exprValue{number: float64(toBit(memory))}
+		}
+	case field.Enum() != nil:
+		operand.kind = exprEnum
+		operand.enum = field.Enum()
+		operand.eval = func(s exprScope) exprValue { return exprValue{number: float64(get(s).Enum())} }
+	default:
+		switch field.Kind() {
+		case protoreflect.BoolKind:
+			operand.kind = exprBool
+			operand.eval = func(s exprScope) exprValue { return exprValue{boolean: get(s).Bool()} }
+		case protoreflect.StringKind:
+			operand.kind = exprString
+			operand.eval = func(s exprScope) exprValue { return exprValue{text: get(s).String()} }
+		case protoreflect.DoubleKind, protoreflect.FloatKind:
+			operand.kind = exprNumber
+			operand.eval = func(s exprScope) exprValue { return exprValue{number: get(s).Float()} }
+		case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+			protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+			operand.kind = exprNumber
+			operand.eval = func(s exprScope) exprValue { return exprValue{number: float64(get(s).Int())} }
+		case protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+			operand.kind = exprNumber
+			operand.eval = func(s exprScope) exprValue { return exprValue{number: float64(get(s).Uint())} }
+		default:
+			return operand, p.errorf(path.position, "%s has the unsupported type %s", path.name, field.Kind())
+		}
+	}
+
+	return operand, nil
+}
+
+// parseQuantifier compiles list.exists(x, condition) or list.all(x, condition) after the name of the quantifier
+func (p *exprParser) parseQuantifier(path *exprPath, quantifier exprToken) (exprOperand, error) {
+	list, err := p.pathOperand(path)
+	if err != nil {
+		return list, err
+	}
+	if err := p.expect("("); err != nil {
+		return list, err
+	}
+
+	name := p.next()
+	if name.kind != tokenIdent {
+		return list, p.errorf(name.position, "expected a variable name, found %s", name)
+	}
+	if err := p.expect(","); err != nil {
+		return list, err
+	}
+
+	p.variables = append(p.variables, exprVariable{name: name.text, message: path.last().Message()})
+	scope := len(p.variables) - 1
+	condition, err := p.parseOr()
+	p.variables = p.variables[:scope]
+	if err != nil {
+		return list, err
+	}
+	if err := p.expect(")"); err != nil {
+		return list, err
+	}
+
+	// exists stops at the first element satisfying the condition, all at the first one that does not
+	all := quantifier.text == "all"
+	return exprOperand{
+		kind:     exprBool,
+		text:     path.name + "." + quantifier.text,
+		position: path.position,
+		eval: func(s exprScope) exprValue {
+			elements := list.eval(s).list
+			inner := make(exprScope, scope+1)
+			copy(inner, s)
+			for i := 0; i < elements.Len(); i++ {
+				inner[scope] = elements.Get(i).Message()
+				if condition(inner) != all {
+					return exprValue{boolean: !all}
+				}
+			}
+			return exprValue{boolean: all}
+		},
+	}, nil
+}
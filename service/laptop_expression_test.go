@@ -0,0 +1,151 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newExpressionLaptop() *pcbook.Laptop {
+	laptop := sample.NewLaptop()
+	laptop.Brand = "Dell"
+	laptop.Name = "XPS 15"
+	laptop.Cpu.NumberOfCores = 8
+	laptop.Cpu.NumberOfThreads = 16
+	laptop.Cpu.MinGhz = 2.6
+	laptop.Cpu.MaxGhz = 4.5
+	laptop.Ram = &pcbook.Memory{Value: 32, Unit: pcbook.Memory_GIGABYTE}
+	laptop.Gpus = []*pcbook.GPU{
+		{Brand: "NVIDIA", Name: "GTX 1650", MinGhz: 1.2, MaxGhz: 1.5, Memory: &pcbook.Memory{Value: 4, Unit: pcbook.Memory_GIGABYTE}},
+		{Brand: "NVIDIA", Name: "RTX 2060", MinGhz: 1.3, MaxGhz: 1.7, Memory: &pcbook.Memory{Value: 6, Unit: pcbook.Memory_GIGABYTE}},
+	}
+	laptop.Storages = []*pcbook.Storage{
+		{Driver: pcbook.Storage_SSD, Memory: &pcbook.Memory{Value: 1, Unit: pcbook.Memory_TERABYTE}},
+	}
+	laptop.Keyboard = &pcbook.Keyboard{Layout: pcbook.Keyboard_QWERTY, Backlit: true}
+	laptop.Weight = &pcbook.Laptop_WeightKg{WeightKg: 1.8}
+	laptop.PriceUsd = 2000
+	laptop.ReleaseYear = 2020
+	return laptop
+}
+
+func TestLaptopExpressionMatch(t *testing.T) {
+	t.Parallel()
+
+	laptop := newExpressionLaptop()
+
+	testCases := []struct {
+		expression string
+		match      bool
+	}{
+		{`cpu.cores >= 8 && (brand == "Dell" || gpus.exists(g, g.memory >= 6GB))`, true},
+		{`cpu.cores >= 8 && (brand == "Lenovo" || gpus.exists(g, g.memory >= 8GB))`, false},
+		{`cpu.number_of_cores > 8`, false},
+		{`price < 2500 && price_usd >= 2000`, true},
+		{`ram >= 32GB && ram < 33GB`, true},
+		{`ram == 32768MB`, true},
+		{`brand != "Dell" || !(release_year == 2020)`, false},
+		{`gpus.all(g, g.brand == "NVIDIA" && g.memory >= 4GB)`, true},
+		{`gpus.all(g, g.memory >= 6GB)`, false},
+		{`storages.exists(s, s.driver == "SSD" && s.memory >= 512GB)`, true},
+		{`storages.exists(s, s.driver == "hdd")`, false},
+		{`gpus.exists(g, g.name == "RTX 2060" && storages.all(s, s.memory > g.memory))`, true},
+		{`keyboard.backlit && keyboard.layout != "AZERTY"`, true},
+		{`keyboard.backlit == false`, false},
+		{`weight_kg < 2 && weight_lb == 0`, true},
+		{`screen.resolution.width > 0 || true`, true},
+		{`updated_at.seconds > 0`, true},
+	}
+
+	for _, tc := range testCases {
+		expression, err := service.CompileLaptopExpression(tc.expression)
+		require.NoError(t, err, tc.expression)
+		require.Equal(t, tc.match, expression.Match(laptop), tc.expression)
+	}
+}
+
+func TestCompileLaptopExpressionErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		expression string
+		position   int
+		message    string
+	}{
+		{`brand == `, 10, "expected a field or a value, found end of expression"},
+		{`(brand == "Dell"`, 17, `expected ")"`},
+		{`brand == "Dell`, 10, "unterminated string"},
+		{`cpu.speed > 2`, 5, "unknown field speed of CPU"},
+		{`brand > "A"`, 7, "string values can only be compared with == and !="},
+		{`price == "cheap"`, 7, "cannot compare number with string"},
+		{`ram >= 16`, 5, "cannot compare memory size with number"},
+		{`storages.exists(s, s.driver == "NVME")`, 32, `unknown Driver value "NVME"`},
+		{`gpus > 1`, 6, "cannot compare lists"},
+		{`gpus.memory > 4GB`, 6, "gpus is a list"},
+		{`price`, 1, "price is a number, not a condition"},
+		{`cpu`, 1, "cpu is a message"},
+		{`ram.value > 1`, 5, "ram has no field value"},
+		{`g.memory > 1GB`, 1, "unknown field g of Laptop"},
+		{`brand == "Dell" brand`, 17, `unexpected "brand"`},
+		{`price < 1 # 2`, 11, "unexpected character '#'"},
+		{`ram > 16XB`, 7, "invalid memory size"},
+	}
+
+	for _, tc := range testCases {
+		_, err := service.CompileLaptopExpression(tc.expression)
+		require.Error(t, err, tc.expression)
+
+		var expressionErr *service.ExpressionError
+		require.True(t, errors.As(err, &expressionErr), tc.expression)
+		require.Equal(t, tc.position, expressionErr.Position, "%s: %v", tc.expression, err)
+		require.Contains(t, expressionErr.Message, tc.message, tc.expression)
+	}
+}
+
+func TestServerSearchLaptopExpression(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	dell := newExpressionLaptop()
+	require.NoError(t, store.Save(dell))
+	lenovo := newExpressionLaptop()
+	lenovo.Brand = "Lenovo"
+	lenovo.Id = sample.NewLaptop().GetId()
+	require.NoError(t, store.Save(lenovo))
+
+	ids := []string{}
+	err := store.Query(context.Background(), service.LaptopQuery{
+		Expression: mustCompile(t, `brand == "Lenovo" || brand == "Apple"`),
+	}, func(laptop *pcbook.Laptop, score float64) error {
+		ids = append(ids, laptop.GetId())
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{lenovo.GetId()}, ids)
+
+	server := service.NewLaptopServer(store, nil, nil)
+	err = server.SearchLaptop(&pcbook.SearchLaptopRequest{Expression: `cpu.cores >= `}, nil)
+	require.Error(t, err)
+
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 2)
+	badRequest, ok := st.Details()[1].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Equal(t, "expression", badRequest.GetFieldViolations()[0].GetField())
+	require.Contains(t, badRequest.GetFieldViolations()[0].GetDescription(), "position 14")
+}
+
+func mustCompile(t *testing.T, text string) *service.LaptopExpression {
+	expression, err := service.CompileLaptopExpression(text)
+	require.NoError(t, err)
+	return expression
+}
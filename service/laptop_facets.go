@@ -0,0 +1,156 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/serializer"
+)
+
+// DefaultPriceBounds are the upper bounds of the price buckets in USD when none are requested
+var DefaultPriceBounds = []float64{500, 1000, 1500, 2000, 2500, 3000}
+
+// LaptopFacets are the numbers of laptops per value of the fields a search can be refined by,
+// the laptops without a value are not counted
+type LaptopFacets struct {
+	Total     int
+	Brands    map[string]int
+	CPUBrands map[string]int
+	// GPUBrands counts a laptop once for each brand of its GPUs
+	GPUBrands map[string]int
+	// RAM counts the laptops by RAM size in bits
+	RAM     map[uint64]int
+	Panels  map[pcbook.Screen_Panel]int
+	Layouts map[pcbook.Keyboard_Layout]int
+	// PriceBuckets counts the laptops priced below each bound and at least the previous one,
+	// the last bucket counts the laptops priced at least the last bound
+	PriceBuckets []int
+}
+
+func newLaptopFacets(priceBounds []float64) *LaptopFacets {
+	return &LaptopFacets{
+		Brands:       make(map[string]int),
+		CPUBrands:    make(map[string]int),
+		GPUBrands:    make(map[string]int),
+		RAM:          make(map[uint64]int),
+		Panels:       make(map[pcbook.Screen_Panel]int),
+		Layouts:      make(map[pcbook.Keyboard_Layout]int),
+		PriceBuckets: make([]int, len(priceBounds)+1),
+	}
+}
+
+// add counts a laptop, priceBounds must be the bounds the facets were created with
+func (facets *LaptopFacets) add(laptop *pcbook.Laptop, priceBounds []float64) {
+	facets.Total++
+
+	if len(laptop.GetBrand()) > 0 {
+		facets.Brands[laptop.GetBrand()]++
+	}
+	if len(laptop.GetCpu().GetBrand()) > 0 {
+		facets.CPUBrands[laptop.GetCpu().GetBrand()]++
+	}
+
+	gpuBrands := make(map[string]bool)
+	for _, gpu := range laptop.GetGpus() {
+		if len(gpu.GetBrand()) > 0 && !gpuBrands[gpu.GetBrand()] {
+			gpuBrands[gpu.GetBrand()] = true
+			facets.GPUBrands[gpu.GetBrand()]++
+		}
+	}
+
+	if bits := toBit(laptop.GetRam()); bits > 0 {
+		facets.RAM[bits]++
+	}
+	if panel := laptop.GetScreen().GetPanel(); panel != pcbook.Screen_UNKNOWN {
+		facets.Panels[panel]++
+	}
+	if layout := laptop.GetKeyboard().GetLayout(); layout != pcbook.Keyboard_UNKNOWN {
+		facets.Layouts[layout]++
+	}
+
+	bucket := sort.Search(len(priceBounds), func(i int) bool {
+		return laptop.GetPriceUsd() < priceBounds[i]
+	})
+	facets.PriceBuckets[bucket]++
+}
+
+// memoryUnitBits are the memory units from the largest, with their size in bits
+var memoryUnitBits = []struct {
+	unit pcbook.Memory_Unit
+	bits uint64
+}{
+	{unit: pcbook.Memory_TERABYTE, bits: 1 << 43},
+	{unit: pcbook.Memory_GIGABYTE, bits: 1 << 33},
+	{unit: pcbook.Memory_MEGABYTE, bits: 1 << 23},
+	{unit: pcbook.Memory_KILOBYTE, bits: 1 << 13},
+	{unit: pcbook.Memory_BYTE, bits: 1 << 3},
+}
+
+// formatBits formats a memory size in the largest unit it is a whole number of, e.g. 16GB for 16384MB
+func formatBits(bits uint64) string {
+	for _, unit := range memoryUnitBits {
+		if bits%unit.bits == 0 {
+			return serializer.FormatMemory(&pcbook.Memory{Value: bits / unit.bits, Unit: unit.unit})
+		}
+	}
+	return serializer.FormatMemory(&pcbook.Memory{Value: bits, Unit: pcbook.Memory_BIT})
+}
+
+// toPbFacets converts the facets to the response of AggregateLaptops
+func toPbFacets(facets *LaptopFacets, priceBounds []float64) *pcbook.AggregateLaptopsResponse {
+	res := &pcbook.AggregateLaptopsResponse{
+		Total:     uint32(facets.Total),
+		Brands:    toPbFacetCounts(facets.Brands),
+		CpuBrands: toPbFacetCounts(facets.CPUBrands),
+		GpuBrands: toPbFacetCounts(facets.GPUBrands),
+	}
+
+	sizes := make([]uint64, 0, len(facets.RAM))
+	for bits := range facets.RAM {
+		sizes = append(sizes, bits)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	for _, bits := range sizes {
+		res.RamSizes = append(res.RamSizes, &pcbook.FacetCount{Value: formatBits(bits), Count: uint32(facets.RAM[bits])})
+	}
+
+	panels := make(map[string]int, len(facets.Panels))
+	for panel, count := range facets.Panels {
+		panels[panel.String()] = count
+	}
+	res.ScreenPanels = toPbFacetCounts(panels)
+
+	layouts := make(map[string]int, len(facets.Layouts))
+	for layout, count := range facets.Layouts {
+		layouts[layout.String()] = count
+	}
+	res.KeyboardLayouts = toPbFacetCounts(layouts)
+
+	for i, count := range facets.PriceBuckets {
+		bucket := &pcbook.PriceBucket{Count: uint32(count)}
+		if i > 0 {
+			bucket.MinPriceUsd = priceBounds[i-1]
+		}
+		if i < len(priceBounds) {
+			bucket.MaxPriceUsd = priceBounds[i]
+		}
+		res.PriceBuckets = append(res.PriceBuckets, bucket)
+	}
+
+	return res
+}
+
+// toPbFacetCounts returns the counts by decreasing count and then by value
+func toPbFacetCounts(counts map[string]int) []*pcbook.FacetCount {
+	facetCounts := make([]*pcbook.FacetCount, 0, len(counts))
+	for value, count := range counts {
+		facetCounts = append(facetCounts, &pcbook.FacetCount{Value: value, Count: uint32(count)})
+	}
+	sort.Slice(facetCounts, func(i, j int) bool {
+		if facetCounts[i].GetCount() != facetCounts[j].GetCount() {
+			return facetCounts[i].GetCount() > facetCounts[j].GetCount()
+		}
+		return facetCounts[i].GetValue() < facetCounts[j].GetValue()
+	})
+	return facetCounts
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+)
+
+// laptopIndexBlockSize is the number of entries of an index block, a block twice as large is split in two
+const laptopIndexBlockSize = 512
+
+// indexEntry is a laptop in an index, ordered by key and then by ID
+type indexEntry struct {
+	key float64
+	id  string
+}
+
+func (entry indexEntry) less(other indexEntry) bool {
+	return entry.key < other.key || (entry.key == other.key && entry.id < other.id)
+}
+
+// laptopIndex keeps laptop IDs sorted by a key, in blocks so that inserting or removing moves few entries
+type laptopIndex struct {
+	key    func(laptop *pcbook.Laptop) float64
+	blocks [][]indexEntry
+}
+
+func newLaptopIndex(key func(laptop *pcbook.Laptop) float64) *laptopIndex {
+	return &laptopIndex{key: key}
+}
+
+// insert adds a laptop to the index
+func (index *laptopIndex) insert(laptop *pcbook.Laptop) {
+	entry := indexEntry{key: index.key(laptop), id: laptop.GetId()}
+	if len(index.blocks) == 0 {
+		index.blocks = append(index.blocks, []indexEntry{entry})
+		return
+	}
+
+	b, i := index.search(entry)
+	if b == len(index.blocks) {
+		b = len(index.blocks) - 1
+		i = len(index.blocks[b])
+	}
+
+	block := append(index.blocks[b], indexEntry{})
+	copy(block[i+1:], block[i:])
+	block[i] = entry
+	index.blocks[b] = block
+
+	if len(block) >= 2*laptopIndexBlockSize {
+		// split the block, the halves get their own arrays so that appending to one never overwrites the other
+		first := append([]indexEntry(nil), block[:laptopIndexBlockSize]...)
+		second := append([]indexEntry(nil), block[laptopIndexBlockSize:]...)
+		index.blocks = append(index.blocks, nil)
+		copy(index.blocks[b+2:], index.blocks[b+1:])
+		index.blocks[b] = first
+		index.blocks[b+1] = second
+	}
+}
+
+// remove removes a laptop from the index, laptop must be the indexed version
+func (index *laptopIndex) remove(laptop *pcbook.Laptop) {
+	entry := indexEntry{key: index.key(laptop), id: laptop.GetId()}
+	b, i := index.search(entry)
+	if b == len(index.blocks) || index.blocks[b][i] != entry {
+		return
+	}
+
+	block := index.blocks[b]
+	copy(block[i:], block[i+1:])
+	block = block[:len(block)-1]
+	if len(block) > 0 {
+		index.blocks[b] = block
+		return
+	}
+
+	copy(index.blocks[b:], index.blocks[b+1:])
+	index.blocks[len(index.blocks)-1] = nil
+	index.blocks = index.blocks[:len(index.blocks)-1]
+}
+
+// search returns the block and the position in the block of the first entry not less than entry,
+// the number of blocks if there is none
+func (index *laptopIndex) search(entry indexEntry) (int, int) {
+	b := sort.Search(len(index.blocks), func(b int) bool {
+		block := index.blocks[b]
+		return !block[len(block)-1].less(entry)
+	})
+	if b == len(index.blocks) {
+		return b, 0
+	}
+
+	block := index.blocks[b]
+	i := sort.Search(len(block), func(i int) bool {
+		return !block[i].less(entry)
+	})
+	return b, i
+}
+
+// bounds returns the positions of the first entry with a key in [min, max] and of the first one after them
+func (index *laptopIndex) bounds(min float64, max float64) (startBlock int, start int, endBlock int, end int) {
+	startBlock, start = index.search(indexEntry{key: min})
+	if math.IsInf(max, 1) {
+		return startBlock, start, len(index.blocks), 0
+	}
+	endBlock, end = index.search(indexEntry{key: math.Nextafter(max, math.Inf(1))})
+	return startBlock, start, endBlock, end
+}
+
+// count returns the number of laptops with a key in [min, max]
+func (index *laptopIndex) count(min float64, max float64) int {
+	startBlock, start, endBlock, end := index.bounds(min, max)
+	if startBlock > endBlock || (startBlock == endBlock && start >= end) {
+		return 0
+	}
+
+	n := end - start
+	for b := startBlock; b < endBlock; b++ {
+		n += len(index.blocks[b])
+	}
+	return n
+}
+
+// ascend calls visit with the IDs of the laptops with a key in [min, max] in order, until visit returns false
+func (index *laptopIndex) ascend(min float64, max float64, visit func(id string) bool) {
+	startBlock, start, endBlock, end := index.bounds(min, max)
+	for b := startBlock; b <= endBlock && b < len(index.blocks); b++ {
+		block := index.blocks[b]
+		if b == endBlock {
+			block = block[:end]
+		}
+		if b == startBlock {
+			if start >= len(block) {
+				continue
+			}
+			block = block[start:]
+		}
+
+		for _, entry := range block {
+			if !visit(entry.id) {
+				return
+			}
+		}
+	}
+}
+
+// indexRange is a range of keys of an index matching a filter
+type indexRange struct {
+	index *laptopIndex
+	min   float64
+	max   float64
+}
+
+// laptopIndexes are the indexes of the laptop fields a filter can restrict, and of their words
+type laptopIndexes struct {
+	price *laptopIndex
+	cores *laptopIndex
+	ghz   *laptopIndex
+	ram   *laptopIndex
+	text  *textIndex
+}
+
+func newLaptopIndexes() *laptopIndexes {
+	return &laptopIndexes{
+		price: newLaptopIndex(func(laptop *pcbook.Laptop) float64 {
+			return laptop.GetPriceUsd()
+		}),
+		cores: newLaptopIndex(func(laptop *pcbook.Laptop) float64 {
+			return float64(laptop.GetCpu().GetNumberOfCores())
+		}),
+		ghz: newLaptopIndex(func(laptop *pcbook.Laptop) float64 {
+			return laptop.GetCpu().GetMinGhz()
+		}),
+		ram: newLaptopIndex(func(laptop *pcbook.Laptop) float64 {
+			return float64(toBit(laptop.GetRam()))
+		}),
+		text: newTextIndex(),
+	}
+}
+
+func (indexes *laptopIndexes) all() []*laptopIndex {
+	return []*laptopIndex{indexes.price, indexes.cores, indexes.ghz, indexes.ram}
+}
+
+func (indexes *laptopIndexes) insert(laptop *pcbook.Laptop) {
+	for _, index := range indexes.all() {
+		index.insert(laptop)
+	}
+	indexes.text.insert(laptop)
+}
+
+func (indexes *laptopIndexes) remove(laptop *pcbook.Laptop) {
+	for _, index := range indexes.all() {
+		index.remove(laptop)
+	}
+	indexes.text.remove(laptop)
+}
+
+// plan returns the range of the most selective index for the filter, the laptops in it still have to be matched
+// against the whole filter. The keys are float64, so a range may include a few laptops just outside the filter
+func (indexes *laptopIndexes) plan(filter *pcbook.Filter) indexRange {
+	ranges := []indexRange{
+		{index: indexes.price, min: math.Inf(-1), max: filter.GetMaxPriceUsd()},
+		{index: indexes.cores, min: float64(filter.GetMinCpuCores()), max: math.Inf(1)},
+		{index: indexes.ghz, min: filter.GetMinCpuGhz(), max: math.Inf(1)},
+		{index: indexes.ram, min: float64(toBit(filter.GetMinRam())), max: math.Inf(1)},
+	}
+
+	best := ranges[0]
+	bestCount := best.index.count(best.min, best.max)
+	for _, r := range ranges[1:] {
+		count := r.index.count(r.min, r.max)
+		if count < bestCount {
+			best = r
+			bestCount = count
+		}
+	}
+	return best
+}
@@ -0,0 +1,219 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLaptopStoreIndexedSearch(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	laptops := make([]*pcbook.Laptop, 3000)
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+		require.NoError(t, store.Save(laptops[i]))
+	}
+
+	// move and remove laptops so that index blocks are split, shrunk and emptied
+	for i, laptop := range laptops[:1000] {
+		if i%2 == 0 {
+			require.NoError(t, store.Delete(laptop.GetId()))
+			continue
+		}
+		laptop.PriceUsd = 1000 + float64(i)
+		laptop.Cpu.NumberOfCores = 16
+		laptop.Cpu.NumberOfThreads = 16
+		require.NoError(t, store.Update(laptop))
+	}
+
+	filters := []*pcbook.Filter{
+		{},
+		{MaxPriceUsd: 1200},
+		{MaxPriceUsd: 3000, MinCpuCores: 16},
+		{MaxPriceUsd: 2000, MinCpuGhz: 3.2},
+		{MaxPriceUsd: 3000, MinRam: &pcbook.Memory{Value: 60, Unit: pcbook.Memory_GIGABYTE}},
+		{MaxPriceUsd: 2500, MinCpuCores: 4, MinCpuGhz: 2.5, MinRam: &pcbook.Memory{Value: 32, Unit: pcbook.Memory_GIGABYTE}},
+		{MaxPriceUsd: 3000, MinCpuCores: 100},
+	}
+
+	expression, err := service.CompileLaptopExpression(`cpu.cores >= 8`)
+	require.NoError(t, err)
+
+	for i, filter := range filters {
+		indexed := searchIDs(t, store.Search, filter)
+		scanned := searchIDs(t, store.SearchByScan, filter)
+		require.Equal(t, scanned, indexed, "filter %d: %v", i, filter)
+
+		// a query without words is matched in the same index range as the search
+		queried := []string{}
+		err := store.Query(context.Background(), service.LaptopQuery{Filter: filter, Expression: expression}, func(laptop *pcbook.Laptop, score float64) error {
+			queried = append(queried, laptop.GetId())
+			return nil
+		})
+		require.NoError(t, err)
+		sort.Strings(queried)
+
+		expected := []string{}
+		for _, id := range scanned {
+			laptop, err := store.Find(id)
+			require.NoError(t, err)
+			if expression.Match(laptop) {
+				expected = append(expected, id)
+			}
+		}
+		require.Equal(t, expected, queried, "filter %d: %v", i, filter)
+	}
+}
+
+type searchFunc func(ctx context.Context, filter *pcbook.Filter, found func(laptop *pcbook.Laptop) error) error
+
+func searchIDs(t *testing.T, search searchFunc, filter *pcbook.Filter) []string {
+	ids := []string{}
+	err := search(context.Background(), filter, func(laptop *pcbook.Laptop) error {
+		ids = append(ids, laptop.GetId())
+		return nil
+	})
+	require.NoError(t, err)
+
+	sort.Strings(ids)
+	return ids
+}
+
+var (
+	benchmarkStore     *service.InMemoryLaptopStore
+	benchmarkStoreOnce sync.Once
+)
+
+// newBenchmarkStore returns a store of 100k sample laptops, shared by the benchmarks
+func newBenchmarkStore(b *testing.B) *service.InMemoryLaptopStore {
+	benchmarkStoreOnce.Do(func() {
+		benchmarkStore = service.NewInMemoryLaptopStore()
+		for i := 0; i < 100000; i++ {
+			err := benchmarkStore.Save(sample.NewLaptop())
+			if err != nil {
+				panic(err)
+			}
+		}
+	})
+	return benchmarkStore
+}
+
+var benchmarkFilters = []struct {
+	name   string
+	filter *pcbook.Filter
+}{
+	{name: "cheap", filter: &pcbook.Filter{MaxPriceUsd: 1510}},
+	{name: "many_cores", filter: &pcbook.Filter{MaxPriceUsd: 3000, MinCpuCores: 8, MinRam: &pcbook.Memory{Value: 60, Unit: pcbook.Memory_GIGABYTE}}},
+	{name: "fast_cpu", filter: &pcbook.Filter{MaxPriceUsd: 3000, MinCpuGhz: 3.49}},
+	{name: "nothing", filter: &pcbook.Filter{MaxPriceUsd: 1000}},
+}
+
+func BenchmarkLaptopStoreSearch(b *testing.B) {
+	store := newBenchmarkStore(b)
+
+	for _, search := range []struct {
+		name   string
+		search searchFunc
+	}{
+		{name: "scan", search: store.SearchByScan},
+		{name: "indexed", search: store.Search},
+	} {
+		for _, bf := range benchmarkFilters {
+			b.Run(fmt.Sprintf("%s/%s", search.name, bf.name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					err := search.search(context.Background(), bf.filter, func(laptop *pcbook.Laptop) error {
+						return nil
+					})
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkLaptopStoreQueryExpression(b *testing.B) {
+	store := newBenchmarkStore(b)
+	expression, err := service.CompileLaptopExpression(`keyboard.backlit`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bf := range benchmarkFilters {
+		b.Run(bf.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				err := store.Query(context.Background(), service.LaptopQuery{Filter: bf.filter, Expression: expression}, func(laptop *pcbook.Laptop, score float64) error {
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLaptopStoreSave(b *testing.B) {
+	store := service.NewInMemoryLaptopStore()
+	laptops := make([]*pcbook.Laptop, b.N)
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+		laptops[i].PriceUsd = rand.Float64() * 3000
+	}
+
+	b.ResetTimer()
+	for _, laptop := range laptops {
+		err := store.Save(laptop)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLaptopStoreFind(b *testing.B) {
+	store := service.NewInMemoryLaptopStore()
+	ids := make([]string, 10000)
+	for i := range ids {
+		laptop := sample.NewLaptop()
+		if err := store.Save(laptop); err != nil {
+			b.Fatal(err)
+		}
+		ids[i] = laptop.GetId()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := store.Find(ids[i%len(ids)])
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLaptopStoreSearchParallel(b *testing.B) {
+	store := newBenchmarkStore(b)
+	filter := benchmarkFilters[0].filter
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			err := store.Search(context.Background(), filter, func(laptop *pcbook.Laptop) error {
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+)
+
+const (
+	// defaultRecommendLimit is the number of laptops recommended when no limit is requested
+	defaultRecommendLimit = 10
+	// maxRecommendLimit is the maximum number of laptops of a recommendation, larger limits are lowered to it
+	maxRecommendLimit = 100
+)
+
+// DefaultSimilarityWeights weigh all the specs the same
+var DefaultSimilarityWeights = &pcbook.SimilarityWeights{
+	CpuCores:   1,
+	CpuGhz:     1,
+	Ram:        1,
+	Storage:    1,
+	ScreenSize: 1,
+	Weight:     1,
+	Price:      1,
+	Rating:     1,
+}
+
+// similaritySpec is a spec compared by the similarity of two laptops
+type similaritySpec struct {
+	weight func(weights *pcbook.SimilarityWeights) float64
+	// value is the spec of a laptop, whose rating is nil when unrated, a spec that is not ok does not count in the similarity
+	value func(laptop *pcbook.Laptop, rating *Rating) (float64, bool)
+}
+
+// similaritySpecs are the specs of the similarity, memory sizes are in GB
+var similaritySpecs = []similaritySpec{
+	{
+		weight: (*pcbook.SimilarityWeights).GetCpuCores,
+		value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+			return float64(laptop.GetCpu().GetNumberOfCores()), laptop.GetCpu() != nil
+		},
+	},
+	{
+		weight: (*pcbook.SimilarityWeights).GetCpuGhz,
+		value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+			return laptop.GetCpu().GetMinGhz(), laptop.GetCpu() != nil
+		},
+	},
+	{
+		weight: (*pcbook.SimilarityWeights).GetRam,
+		value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+			return toGB(laptop.GetRam()), laptop.GetRam() != nil
+		},
+	},
+	{
+		weight: (*pcbook.SimilarityWeights).GetStorage,
+		value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+			return totalStorage(laptop, pcbook.Storage_SSD) + totalStorage(laptop, pcbook.Storage_HDD), true
+		},
+	},
+	{
+		weight: (*pcbook.SimilarityWeights).GetScreenSize,
+		value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+			return float64(laptop.GetScreen().GetSizeInch()), laptop.GetScreen() != nil
+		},
+	},
+	{
+		weight: (*pcbook.SimilarityWeights).GetWeight,
+		value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+			return weightKg(laptop)
+		},
+	},
+	{
+		weight: (*pcbook.SimilarityWeights).GetPrice,
+		value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+			return laptop.GetPriceUsd(), true
+		},
+	},
+	{
+		weight: (*pcbook.SimilarityWeights).GetRating,
+		value: func(laptop *pcbook.Laptop, rating *Rating) (float64, bool) {
+			return averageScore(rating)
+		},
+	},
+}
+
+// specValues are the values of the similarity specs of a laptop
+type specValues struct {
+	values  []float64
+	present []bool
+}
+
+func newSpecValues(laptop *pcbook.Laptop, rating *Rating) specValues {
+	specs := specValues{
+		values:  make([]float64, len(similaritySpecs)),
+		present: make([]bool, len(similaritySpecs)),
+	}
+	for i, spec := range similaritySpecs {
+		specs.values[i], specs.present[i] = spec.value(laptop, rating)
+	}
+	return specs
+}
+
+// recommendSimilar returns at most limit candidates by decreasing similarity to the target, and then by ID.
+// The difference of each spec is divided by its range among the target and the candidates, the similarity
+// is 1 minus the weighted root mean square of these differences. A spec missing for one of two laptops,
+// such as the rating of a laptop never rated, does not count in their similarity
+func recommendSimilar(target *pcbook.Laptop, targetRating *Rating, candidates []*pcbook.Laptop, ratings []*Rating,
+	weights *pcbook.SimilarityWeights, limit int) []*pcbook.Recommendation {
+	targetSpecs := newSpecValues(target, targetRating)
+	candidateSpecs := make([]specValues, len(candidates))
+	for i, candidate := range candidates {
+		candidateSpecs[i] = newSpecValues(candidate, ratings[i])
+	}
+
+	// the range of each spec normalizes its differences to [0, 1]
+	allSpecs := append([]specValues{targetSpecs}, candidateSpecs...)
+	ranges := make([]float64, len(similaritySpecs))
+	for i := range similaritySpecs {
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, specs := range allSpecs {
+			if specs.present[i] {
+				min = math.Min(min, specs.values[i])
+				max = math.Max(max, specs.values[i])
+			}
+		}
+		if max > min {
+			ranges[i] = max - min
+		}
+	}
+
+	recommendations := make([]*pcbook.Recommendation, len(candidates))
+	for i, candidate := range candidates {
+		sum, totalWeight := 0.0, 0.0
+		for j, spec := range similaritySpecs {
+			weight := spec.weight(weights)
+			if weight == 0 || !targetSpecs.present[j] || !candidateSpecs[i].present[j] {
+				continue
+			}
+
+			totalWeight += weight
+			if ranges[j] > 0 {
+				difference := (candidateSpecs[i].values[j] - targetSpecs.values[j]) / ranges[j]
+				sum += weight * difference * difference
+			}
+		}
+
+		similarity := 0.0
+		if totalWeight > 0 {
+			similarity = 1 - math.Sqrt(sum/totalWeight)
+		}
+		recommendations[i] = &pcbook.Recommendation{Laptop: candidate, Similarity: similarity}
+	}
+
+	sort.Slice(recommendations, func(i, j int) bool {
+		if recommendations[i].GetSimilarity() != recommendations[j].GetSimilarity() {
+			return recommendations[i].GetSimilarity() > recommendations[j].GetSimilarity()
+		}
+		return recommendations[i].GetLaptop().GetId() < recommendations[j].GetLaptop().GetId()
+	})
+	if len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	return recommendations
+}
+
+// validateSimilarityWeights returns the violations of weights which are negative, not numbers or all 0
+func validateSimilarityWeights(weights *pcbook.SimilarityWeights) error {
+	total := 0.0
+	for _, field := range []struct {
+		name   string
+		weight float64
+	}{
+		{name: "cpu_cores", weight: weights.GetCpuCores()},
+		{name: "cpu_ghz", weight: weights.GetCpuGhz()},
+		{name: "ram", weight: weights.GetRam()},
+		{name: "storage", weight: weights.GetStorage()},
+		{name: "screen_size", weight: weights.GetScreenSize()},
+		{name: "weight", weight: weights.GetWeight()},
+		{name: "price", weight: weights.GetPrice()},
+		{name: "rating", weight: weights.GetRating()},
+	} {
+		if math.IsNaN(field.weight) || math.IsInf(field.weight, 0) || field.weight < 0 {
+			return badRequestError(ReasonInvalidWeights, "weights."+field.name, "must be a positive number or 0")
+		}
+		total += field.weight
+	}
+
+	if total == 0 {
+		return badRequestError(ReasonInvalidWeights, "weights", "must have at least one positive weight")
+	}
+	return nil
+}
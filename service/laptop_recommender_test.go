@@ -0,0 +1,114 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newSimilarLaptop(cores uint32, ramGB uint64, price float64) *pcbook.Laptop {
+	laptop := sample.NewLaptop()
+	laptop.Cpu.NumberOfCores = cores
+	laptop.Cpu.MinGhz = 2.5
+	laptop.Ram = &pcbook.Memory{Value: ramGB, Unit: pcbook.Memory_GIGABYTE}
+	laptop.Storages = []*pcbook.Storage{
+		{Driver: pcbook.Storage_SSD, Memory: &pcbook.Memory{Value: 512, Unit: pcbook.Memory_GIGABYTE}},
+	}
+	laptop.Screen.SizeInch = 14
+	laptop.Weight = &pcbook.Laptop_WeightKg{WeightKg: 1.5}
+	laptop.PriceUsd = price
+	return laptop
+}
+
+func TestServerRecommendSimilar(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
+
+	target := newSimilarLaptop(8, 16, 1500)
+	twin := newSimilarLaptop(8, 16, 1500)
+	cheap := newSimilarLaptop(8, 16, 500)
+	powerful := newSimilarLaptop(16, 64, 1600)
+	for _, laptop := range []*pcbook.Laptop{target, twin, cheap, powerful} {
+		require.NoError(t, laptopStore.Save(laptop))
+	}
+	_, err := ratingStore.Add(target.GetId(), 9)
+	require.NoError(t, err)
+	_, err = ratingStore.Add(twin.GetId(), 8)
+	require.NoError(t, err)
+	_, err = ratingStore.Add(cheap.GetId(), 1)
+	require.NoError(t, err)
+
+	server := service.NewLaptopServer(laptopStore, nil, ratingStore)
+	recommend := func(req *pcbook.RecommendSimilarRequest) []string {
+		res, err := server.RecommendSimilar(context.Background(), req)
+		require.NoError(t, err)
+
+		ids := []string{}
+		for _, recommendation := range res.GetRecommendations() {
+			require.GreaterOrEqual(t, recommendation.GetSimilarity(), 0.0)
+			require.LessOrEqual(t, recommendation.GetSimilarity(), 1.0)
+			ids = append(ids, recommendation.GetLaptop().GetId())
+		}
+		return ids
+	}
+
+	res, err := server.RecommendSimilar(context.Background(), &pcbook.RecommendSimilarRequest{LaptopId: target.GetId()})
+	require.NoError(t, err)
+	require.Len(t, res.GetRecommendations(), 3)
+	require.Equal(t, twin.GetId(), res.GetRecommendations()[0].GetLaptop().GetId())
+	require.Less(t, res.GetRecommendations()[0].GetSimilarity(), 1.0)
+
+	// without the rating the twin is identical, the price makes cheap the least similar
+	ids := recommend(&pcbook.RecommendSimilarRequest{
+		LaptopId: target.GetId(),
+		Weights:  &pcbook.SimilarityWeights{CpuCores: 1, Ram: 1, Price: 10},
+	})
+	require.Equal(t, []string{twin.GetId(), powerful.GetId(), cheap.GetId()}, ids)
+
+	// only the specs weigh, so the cheap laptop is as similar as the twin
+	res, err = server.RecommendSimilar(context.Background(), &pcbook.RecommendSimilarRequest{
+		LaptopId: target.GetId(),
+		Weights:  &pcbook.SimilarityWeights{CpuCores: 1, Ram: 1},
+		Limit:    2,
+	})
+	require.NoError(t, err)
+	require.Len(t, res.GetRecommendations(), 2)
+	for _, recommendation := range res.GetRecommendations() {
+		require.Equal(t, 1.0, recommendation.GetSimilarity())
+		require.NotEqual(t, powerful.GetId(), recommendation.GetLaptop().GetId())
+	}
+
+	ids = recommend(&pcbook.RecommendSimilarRequest{
+		LaptopId: target.GetId(),
+		Filter:   &pcbook.Filter{MaxPriceUsd: 1000},
+	})
+	require.Equal(t, []string{cheap.GetId()}, ids)
+
+	ids = recommend(&pcbook.RecommendSimilarRequest{
+		LaptopId: target.GetId(),
+		Filter:   &pcbook.Filter{MinCpuCores: 16},
+	})
+	require.Equal(t, []string{powerful.GetId()}, ids)
+
+	for _, weights := range []*pcbook.SimilarityWeights{
+		{},
+		{Price: 1, Rating: -1},
+	} {
+		_, err = server.RecommendSimilar(context.Background(), &pcbook.RecommendSimilarRequest{
+			LaptopId: target.GetId(),
+			Weights:  weights,
+		})
+		require.Equal(t, codes.InvalidArgument, status.Code(err), "%v", weights)
+	}
+
+	_, err = server.RecommendSimilar(context.Background(), &pcbook.RecommendSimilarRequest{LaptopId: sample.NewLaptop().GetId()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -4,18 +4,37 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"math"
+	"os"
+	"strconv"
 
 	"github.com/google/uuid"
 	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"google.golang.org/genproto/googleapis/rpc/code"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // max is 1Mb
 const maxImageSize = 1 << 20
 
+// imageChunkSize is the size of the data chunks sent by DownloadImage
+const imageChunkSize = 64 << 10
+
+// maxBatchSize is the largest number of laptops created by a BatchCreateLaptops stream
+const maxBatchSize = 1000
+
+// defaultTopRatedLimit is the number of laptops returned by TopRatedLaptops when no limit is requested
+const defaultTopRatedLimit = 10
+
+// maxPriceBounds is the maximum number of price bounds of an AggregateLaptops request
+const maxPriceBounds = 100
+
 // LaptopServer provides laptop services
 type LaptopServiceServer struct {
 	laptopStore LaptopStore
@@ -35,20 +54,13 @@ func NewLaptopServer(laptopStore LaptopStore, imageStore ImageStore, ratingStore
 // CreateLaptop unary RPC that creates a new Laptop
 func (server *LaptopServiceServer) CreateLaptop(ctx context.Context, req *pcbook.CreateLaptopRequest) (*pcbook.CreateLaptopResponse, error) {
 	laptop := req.GetLaptop()
-	log.Printf("Recieved a CreateLaptop request with id: %s", laptop.Id)
+	log.Printf("Recieved a CreateLaptop request with id: %s", laptop.GetId())
 
-	if len(laptop.Id) > 0 {
-		// check if UUID is Valid
-		_, err := uuid.Parse(laptop.Id)
-		if err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "laptop ID is not a valid UUID: %v", err)
-		}
-	} else {
-		id, err := uuid.NewRandom()
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "cannot generate a new laptop ID: %v", err)
-		}
-		laptop.Id = id.String()
+	if violations := ValidateLaptop("laptop", laptop); len(violations) > 0 {
+		return nil, invalidLaptopError(violations)
+	}
+	if err := assignLaptopID(laptop); err != nil {
+		return nil, err
 	}
 
 	// some heavy processing here
@@ -58,32 +70,301 @@ func (server *LaptopServiceServer) CreateLaptop(ctx context.Context, req *pcbook
 		return nil, err
 	}
 
+	// the etag derives from updated_at, so it is set by the server rather than trusted from the client
+	laptop.UpdatedAt = timestamppb.Now()
+
 	// save the laptop to DB
 	err := server.laptopStore.Save(laptop)
 	if err != nil {
-		code := codes.Internal
-		if errors.Is(err, ErrorAlreadyExists) {
-			code = codes.AlreadyExists
-		}
-		return nil, status.Errorf(code, "cannot save a laptop to the store: %v", err)
+		return nil, laptopStoreError("cannot save a laptop to the store", laptop.Id, err)
 	}
 
 	log.Printf("Saved laptop with id: %s", laptop.Id)
 
 	res := &pcbook.CreateLaptopResponse{
-		Id: laptop.Id,
+		Id:   laptop.Id,
+		Etag: LaptopEtag(laptop),
+	}
+
+	return res, nil
+}
+
+// BatchCreateLaptops client stream that creates many laptops, reporting the result of each of them
+// instead of failing the whole stream, unless the batch is atomic
+func (server *LaptopServiceServer) BatchCreateLaptops(stream pcbook.LaptopService_BatchCreateLaptopsServer) error {
+	laptops := []*pcbook.Laptop{}
+	atomic := false
+
+	for {
+		if err := contextError(stream.Context()); err != nil {
+			return err
+		}
+
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return streamError("cannot receive laptop", err)
+		}
+
+		if len(laptops) == 0 {
+			atomic = req.GetAtomic()
+		}
+		if len(laptops) == maxBatchSize {
+			return newError(codes.InvalidArgument, ReasonBatchTooLarge, fmt.Sprintf("batch is too large: more than %d laptops", maxBatchSize))
+		}
+		laptops = append(laptops, req.GetLaptop())
+	}
+
+	log.Printf("received a BatchCreateLaptops request with %d laptops, atomic: %t", len(laptops), atomic)
+
+	results := make([]*pcbook.BatchCreateLaptopsResponse_Result, len(laptops))
+	valid := make([]*pcbook.Laptop, 0, len(laptops))
+	indexes := make([]int, 0, len(laptops))
+	invalid := false
+
+	for i, laptop := range laptops {
+		results[i] = &pcbook.BatchCreateLaptopsResponse_Result{Index: uint32(i)}
+
+		var err error
+		if violations := ValidateLaptop("laptop", laptop); len(violations) > 0 {
+			err = invalidLaptopError(violations)
+		} else {
+			err = assignLaptopID(laptop)
+		}
+		if err != nil {
+			setBatchResult(results[i], err)
+			invalid = true
+			continue
+		}
+
+		results[i].Id = laptop.Id
+		laptop.UpdatedAt = timestamppb.Now()
+		valid = append(valid, laptop)
+		indexes = append(indexes, i)
+	}
+
+	if atomic && invalid {
+		for _, i := range indexes {
+			setBatchResult(results[i], laptopStoreError("cannot save a laptop to the store", results[i].Id, ErrorBatchAborted))
+		}
+	} else {
+		errs := server.laptopStore.SaveBatch(valid, atomic)
+		for j, err := range errs {
+			if err != nil {
+				setBatchResult(results[indexes[j]], laptopStoreError("cannot save a laptop to the store", valid[j].Id, err))
+			}
+		}
+	}
+
+	res := &pcbook.BatchCreateLaptopsResponse{
+		Results: results,
+	}
+	for _, result := range results {
+		if result.Code == code.Code_OK {
+			res.Created++
+		}
+	}
+
+	err := stream.SendAndClose(res)
+	if err != nil {
+		return streamError("cannot send response", err)
+	}
+
+	log.Printf("created %d of %d laptops", res.Created, len(laptops))
+
+	return nil
+}
+
+// assignLaptopID checks the ID of a new laptop, or generates one if it is empty
+func assignLaptopID(laptop *pcbook.Laptop) error {
+	if len(laptop.Id) > 0 {
+		// check if UUID is Valid
+		return validateLaptopID(laptop.Id)
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return internalError("cannot generate a new laptop ID", err)
+	}
+	laptop.Id = id.String()
+	return nil
+}
+
+// validateLaptopID checks that the ID of a laptop is a UUID
+func validateLaptopID(id string) error {
+	_, err := uuid.Parse(id)
+	if err != nil {
+		return badRequestError(ReasonInvalidLaptop, "laptop.id", fmt.Sprintf("is not a valid UUID: %v", err))
+	}
+	return nil
+}
+
+func setBatchResult(result *pcbook.BatchCreateLaptopsResponse_Result, err error) {
+	st := status.Convert(err)
+	result.Code = code.Code(st.Code())
+	result.Message = st.Message()
+}
+
+// GetLaptop unary RPC that returns a Laptop by ID
+func (server *LaptopServiceServer) GetLaptop(ctx context.Context, req *pcbook.GetLaptopRequest) (*pcbook.GetLaptopResponse, error) {
+	log.Printf("received a GetLaptop request with id: %s", req.GetId())
+
+	laptop, err := server.laptopStore.Find(req.GetId())
+	if err != nil {
+		return nil, internalError("cannot find laptop in store", err)
+	}
+	if laptop == nil {
+		return nil, notFoundError(ReasonLaptopNotFound, laptopResourceType, req.GetId())
+	}
+
+	res := &pcbook.GetLaptopResponse{
+		Laptop: laptop,
+		Etag:   LaptopEtag(laptop),
 	}
 
 	return res, nil
 }
 
+// UpdateLaptop unary RPC that replaces an existing Laptop, or creates it if allowed,
+// failing with Aborted if the Laptop changed since the etag of the request was read
+func (server *LaptopServiceServer) UpdateLaptop(ctx context.Context, req *pcbook.UpdateLaptopRequest) (*pcbook.UpdateLaptopResponse, error) {
+	laptop := req.GetLaptop()
+	log.Printf("received an UpdateLaptop request with id: %s", laptop.GetId())
+
+	if err := validateLaptopID(laptop.GetId()); err != nil {
+		return nil, err
+	}
+	if violations := ValidateLaptop("laptop", laptop); len(violations) > 0 {
+		return nil, invalidLaptopError(violations)
+	}
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	laptop.UpdatedAt = timestamppb.Now()
+
+	conditions := UpdateConditions{
+		Etag:         req.GetEtag(),
+		AllowMissing: req.GetAllowMissing(),
+	}
+	created, err := server.laptopStore.ConditionalUpdate(laptop, conditions)
+	if err != nil {
+		return nil, laptopStoreError("cannot update laptop in the store", laptop.Id, err)
+	}
+
+	log.Printf("updated laptop with id: %s, created: %t", laptop.Id, created)
+
+	res := &pcbook.UpdateLaptopResponse{
+		Id:      laptop.Id,
+		Etag:    LaptopEtag(laptop),
+		Created: created,
+	}
+
+	return res, nil
+}
+
+// DeleteLaptop unary RPC that deletes a Laptop
+func (server *LaptopServiceServer) DeleteLaptop(ctx context.Context, req *pcbook.DeleteLaptopRequest) (*pcbook.DeleteLaptopResponse, error) {
+	log.Printf("received a DeleteLaptop request with id: %s", req.GetId())
+
+	err := server.laptopStore.Delete(req.GetId())
+	if err != nil {
+		return nil, laptopStoreError("cannot delete laptop from the store", req.GetId(), err)
+	}
+
+	log.Printf("deleted laptop with id: %s", req.GetId())
+
+	return &pcbook.DeleteLaptopResponse{}, nil
+}
+
+// WatchLaptops server stream that sends the changes of the laptops matching the filter as they happen
+func (server *LaptopServiceServer) WatchLaptops(req *pcbook.WatchLaptopsRequest, stream pcbook.LaptopService_WatchLaptopsServer) error {
+	filter := req.GetFilter()
+	log.Printf("received a WatchLaptops request with a filter: %v, resume token: %q", filter, req.GetResumeToken())
+
+	var afterSequence uint64
+	if len(req.GetResumeToken()) > 0 {
+		var err error
+		afterSequence, err = strconv.ParseUint(req.GetResumeToken(), 10, 64)
+		if err != nil {
+			return badRequestError(ReasonInvalidResumeToken, "resume_token", fmt.Sprintf("%q is invalid", req.GetResumeToken()))
+		}
+	}
+
+	err := server.laptopStore.Watch(stream.Context(), afterSequence, func(event *LaptopEvent) error {
+		eventType := toPbEventType(event.Type)
+		if filter != nil && !isMatchFilter(filter, event.Laptop) {
+			// a laptop updated out of the filter is reported, so that the watcher can drop it
+			if event.Type != LaptopUpdated || !isMatchFilter(filter, event.Previous) {
+				return nil
+			}
+			eventType = pcbook.WatchLaptopsResponse_LEFT_FILTER
+		}
+
+		res := &pcbook.WatchLaptopsResponse{
+			EventType:   eventType,
+			Laptop:      event.Laptop,
+			ResumeToken: strconv.FormatUint(event.Sequence, 10),
+		}
+
+		err := stream.Send(res)
+		if err != nil {
+			return err
+		}
+		log.Printf("sent laptop event %d for laptop with id: %s", event.Sequence, event.Laptop.GetId())
+		return nil
+	})
+
+	if err := contextError(stream.Context()); err != nil {
+		return err
+	}
+	if errors.Is(err, ErrorInvalidSequence) {
+		return newError(codes.OutOfRange, ReasonResumeTokenOutOfRange, fmt.Sprintf("cannot resume watching laptops: %v", err))
+	}
+	if errors.Is(err, ErrorWatcherTooSlow) {
+		return watcherTooSlowError(err)
+	}
+	if err != nil {
+		return internalError("cannot watch laptops", err)
+	}
+
+	return nil
+}
+
+func toPbEventType(eventType LaptopEventType) pcbook.WatchLaptopsResponse_EventType {
+	switch eventType {
+	case LaptopCreated:
+		return pcbook.WatchLaptopsResponse_CREATED
+	case LaptopUpdated:
+		return pcbook.WatchLaptopsResponse_UPDATED
+	case LaptopDeleted:
+		return pcbook.WatchLaptopsResponse_DELETED
+	default:
+		return pcbook.WatchLaptopsResponse_UNKNOWN
+	}
+}
+
 func (server *LaptopServiceServer) SearchLaptop(req *pcbook.SearchLaptopRequest, stream pcbook.LaptopService_SearchLaptopServer) error {
 	filter := req.GetFilter()
-	log.Printf("recieved a SearchLaptop request with a filter: %v", filter)
+	query := req.GetQuery()
+	log.Printf("recieved a SearchLaptop request with a filter: %v, a query: %q and an expression: %q", filter, query, req.GetExpression())
 
-	err := server.laptopStore.Search(stream.Context(), filter, func(laptop *pcbook.Laptop) error {
+	var expression *LaptopExpression
+	if len(req.GetExpression()) > 0 {
+		var err error
+		expression, err = CompileLaptopExpression(req.GetExpression())
+		if err != nil {
+			return badRequestError(ReasonInvalidExpression, "expression", err.Error())
+		}
+	}
+
+	send := func(laptop *pcbook.Laptop, score float64) error {
 		res := &pcbook.SearchLaptopResponse{
 			Laptop: laptop,
+			Score:  score,
 		}
 
 		err := stream.Send(res)
@@ -92,22 +373,187 @@ func (server *LaptopServiceServer) SearchLaptop(req *pcbook.SearchLaptopRequest,
 		}
 		log.Printf("sent laptop with id: %s", laptop.GetId())
 		return nil
-	})
+	}
 
+	var err error
+	if len(query) > 0 || expression != nil {
+		err = server.laptopStore.Query(stream.Context(), LaptopQuery{Text: query, Filter: filter, Expression: expression}, send)
+	} else {
+		err = server.laptopStore.Search(stream.Context(), filter, func(laptop *pcbook.Laptop) error {
+			return send(laptop, 0)
+		})
+	}
+
+	if err := contextError(stream.Context()); err != nil {
+		return err
+	}
 	if err != nil {
-		return status.Errorf(codes.Internal, "unexpected error: %v", err)
+		return internalError("cannot search laptops", err)
 	}
 
 	return nil
 }
 
+// AggregateLaptops unary RPC that counts the laptops matching a filter per value of their fields
+func (server *LaptopServiceServer) AggregateLaptops(ctx context.Context, req *pcbook.AggregateLaptopsRequest) (*pcbook.AggregateLaptopsResponse, error) {
+	filter := req.GetFilter()
+	log.Printf("received an AggregateLaptops request with a filter: %v", filter)
+
+	priceBounds := req.GetPriceBoundsUsd()
+	if len(priceBounds) == 0 {
+		priceBounds = DefaultPriceBounds
+	}
+	if len(priceBounds) > maxPriceBounds {
+		return nil, badRequestError(ReasonInvalidPriceBounds, "price_bounds_usd", fmt.Sprintf("must have at most %d bounds", maxPriceBounds))
+	}
+	for i, bound := range priceBounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) || bound <= 0 || (i > 0 && bound <= priceBounds[i-1]) {
+			return nil, badRequestError(ReasonInvalidPriceBounds, fmt.Sprintf("price_bounds_usd[%d]", i), "must be a finite positive number greater than the previous bound")
+		}
+	}
+
+	facets, err := server.laptopStore.Aggregate(filter, priceBounds)
+	if err != nil {
+		return nil, internalError("cannot aggregate laptops", err)
+	}
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	return toPbFacets(facets, priceBounds), nil
+}
+
+// CompareLaptops unary RPC that compares the normalized specs of 2 to 5 laptops
+func (server *LaptopServiceServer) CompareLaptops(ctx context.Context, req *pcbook.CompareLaptopsRequest) (*pcbook.CompareLaptopsResponse, error) {
+	ids := req.GetLaptopIds()
+	log.Printf("received a CompareLaptops request for laptops: %v", ids)
+
+	if len(ids) < minComparedLaptops || len(ids) > maxComparedLaptops {
+		return nil, badRequestError(ReasonInvalidComparison, "laptop_ids",
+			fmt.Sprintf("must have %d to %d laptops", minComparedLaptops, maxComparedLaptops))
+	}
+
+	seen := make(map[string]bool, len(ids))
+	laptops := make([]*pcbook.Laptop, len(ids))
+	ratings := make([]*Rating, len(ids))
+	for i, id := range ids {
+		if seen[id] {
+			return nil, badRequestError(ReasonInvalidComparison, fmt.Sprintf("laptop_ids[%d]", i), "must not be a duplicate")
+		}
+		seen[id] = true
+
+		laptop, err := server.laptopStore.Find(id)
+		if err != nil {
+			return nil, internalError("cannot find laptop in store", err)
+		}
+		if laptop == nil {
+			return nil, notFoundError(ReasonLaptopNotFound, laptopResourceType, id)
+		}
+		laptops[i] = laptop
+
+		if server.ratingStore != nil {
+			ratings[i], err = server.ratingStore.Find(id)
+			if err != nil {
+				return nil, internalError("cannot find rating in store", err)
+			}
+		}
+	}
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	res := &pcbook.CompareLaptopsResponse{
+		Laptops: laptops,
+		Rows:    compareLaptops(laptops, ratings),
+	}
+	return res, nil
+}
+
+// RecommendSimilar unary RPC that ranks the laptops matching a filter by their similarity to a laptop
+func (server *LaptopServiceServer) RecommendSimilar(ctx context.Context, req *pcbook.RecommendSimilarRequest) (*pcbook.RecommendSimilarResponse, error) {
+	laptopID := req.GetLaptopId()
+	filter := req.GetFilter()
+	log.Printf("received a RecommendSimilar request for laptop %s with a filter: %v", laptopID, filter)
+
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultRecommendLimit
+	}
+	if limit > maxRecommendLimit {
+		limit = maxRecommendLimit
+	}
+
+	weights := req.GetWeights()
+	if weights == nil {
+		weights = DefaultSimilarityWeights
+	}
+	if err := validateSimilarityWeights(weights); err != nil {
+		return nil, err
+	}
+
+	target, err := server.laptopStore.Find(laptopID)
+	if err != nil {
+		return nil, internalError("cannot find laptop in store", err)
+	}
+	if target == nil {
+		return nil, notFoundError(ReasonLaptopNotFound, laptopResourceType, laptopID)
+	}
+
+	// the constraints are optional, so a max price which is not set does not limit the price
+	filter = withoutPriceLimit(filter)
+
+	var candidates []*pcbook.Laptop
+	err = server.laptopStore.Query(ctx, LaptopQuery{Filter: filter}, func(laptop *pcbook.Laptop, score float64) error {
+		if laptop.GetId() != laptopID {
+			candidates = append(candidates, laptop)
+		}
+		return nil
+	})
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, internalError("cannot search laptops", err)
+	}
+
+	targetRating, ratings, err := server.findRatings(laptopID, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pcbook.RecommendSimilarResponse{
+		Recommendations: recommendSimilar(target, targetRating, candidates, ratings, weights, limit),
+	}
+	return res, nil
+}
+
+// findRatings returns the ratings of a laptop and of the candidates, nil if never rated or without a rating store
+func (server *LaptopServiceServer) findRatings(laptopID string, candidates []*pcbook.Laptop) (*Rating, []*Rating, error) {
+	ratings := make([]*Rating, len(candidates))
+	if server.ratingStore == nil {
+		return nil, ratings, nil
+	}
+
+	rating, err := server.ratingStore.Find(laptopID)
+	if err != nil {
+		return nil, nil, internalError("cannot find rating in store", err)
+	}
+	for i, candidate := range candidates {
+		ratings[i], err = server.ratingStore.Find(candidate.GetId())
+		if err != nil {
+			return nil, nil, internalError("cannot find rating in store", err)
+		}
+	}
+	return rating, ratings, nil
+}
+
 // UploadImage upload image by a stream of byte data
 func (server *LaptopServiceServer) UploadImage(stream pcbook.LaptopService_UploadImageServer) error {
 
 	req, err := stream.Recv()
 	if err != nil {
-		log.Print("cannot recieve image info", err)
-		return status.Errorf(codes.Unknown, "cannot recieve image info")
+		return streamError("cannot receive image info", err)
 	}
 
 	laptopID := req.GetInfo().GetLaptopId()
@@ -117,12 +563,10 @@ func (server *LaptopServiceServer) UploadImage(stream pcbook.LaptopService_Uploa
 
 	laptop, err := server.laptopStore.Find(laptopID)
 	if err != nil {
-		log.Print("cannot find laptop", err)
-		return status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+		return internalError("cannot find laptop", err)
 	}
 	if laptop == nil {
-		log.Print("laptop does not exists", err)
-		return status.Errorf(codes.Internal, "laptop does not exists: %v", err)
+		return notFoundError(ReasonLaptopNotFound, laptopResourceType, laptopID)
 	}
 
 	imageData := bytes.Buffer{}
@@ -140,8 +584,7 @@ func (server *LaptopServiceServer) UploadImage(stream pcbook.LaptopService_Uploa
 			break
 		}
 		if err != nil {
-			log.Print("cannot receive data chunk", err)
-			return status.Errorf(codes.Unknown, "cannot receive data chunk: %v", err)
+			return streamError("cannot receive data chunk", err)
 		}
 
 		chunk := req.GetDataChunk()
@@ -152,20 +595,18 @@ func (server *LaptopServiceServer) UploadImage(stream pcbook.LaptopService_Uploa
 		imageSize += size
 		if imageSize > maxImageSize {
 			log.Printf("image size is to large: %d > %d", imageSize, maxImageSize)
-			return status.Errorf(codes.InvalidArgument, "image size is to large: %d > %d", imageSize, maxImageSize)
+			return newError(codes.InvalidArgument, ReasonImageTooLarge, fmt.Sprintf("image size is to large: %d > %d", imageSize, maxImageSize))
 		}
 
 		_, err = imageData.Write(chunk)
 		if err != nil {
-			log.Print("cannot write chunk of data", err)
-			return status.Errorf(codes.Internal, "cannot write chunk of data: %v", err)
+			return internalError("cannot write chunk of data", err)
 		}
 	}
 
 	imageID, err := server.imageStore.Save(laptopID, imageType, imageData)
 	if err != nil {
-		log.Print("cannot save image to the store", err)
-		return status.Errorf(codes.Internal, "cannot save image to the store: %v", err)
+		return internalError("cannot save image to the store", err)
 	}
 
 	res := &pcbook.UploadImageResponse{
@@ -175,8 +616,7 @@ func (server *LaptopServiceServer) UploadImage(stream pcbook.LaptopService_Uploa
 
 	err = stream.SendAndClose(res)
 	if err != nil {
-		log.Print("cannot send response", err)
-		return status.Errorf(codes.Unknown, "cannot send response: %v", err)
+		return streamError("cannot send response", err)
 	}
 
 	log.Printf("image saved with id: %s, size: %d", imageID, imageSize)
@@ -184,17 +624,68 @@ func (server *LaptopServiceServer) UploadImage(stream pcbook.LaptopService_Uploa
 	return nil
 }
 
-func contextError(ctx context.Context) error {
-	switch ctx.Err() {
-	case context.Canceled:
-		log.Print("request is canceled")
-		return status.Error(codes.Canceled, "request is canceled")
-	case context.DeadlineExceeded:
-		log.Print("deadline is exceeded")
-		return status.Error(codes.DeadlineExceeded, "deadline is exceeded")
-	default:
-		return nil
+// DownloadImage server stream that sends the image info followed by the image data in chunks
+func (server *LaptopServiceServer) DownloadImage(req *pcbook.DownloadImageRequest, stream pcbook.LaptopService_DownloadImageServer) error {
+	imageID := req.GetImageId()
+	log.Printf("received a DownloadImage request for image: %s", imageID)
+
+	info, err := server.imageStore.Find(imageID)
+	if err != nil {
+		return internalError("cannot find image in store", err)
 	}
+	if info == nil {
+		return notFoundError(ReasonImageNotFound, imageResourceType, imageID)
+	}
+
+	file, err := os.Open(info.Path)
+	if err != nil {
+		return internalError("cannot open image file", err)
+	}
+	defer file.Close()
+
+	res := &pcbook.DownloadImageResponse{
+		Data: &pcbook.DownloadImageResponse_Info{
+			Info: &pcbook.ImageInfo{
+				LaptopId:  info.LaptopID,
+				ImageType: info.Type,
+			},
+		},
+	}
+
+	err = stream.Send(res)
+	if err != nil {
+		return streamError("cannot send image info", err)
+	}
+
+	buffer := make([]byte, imageChunkSize)
+	for {
+		if err := contextError(stream.Context()); err != nil {
+			return err
+		}
+
+		n, err := file.Read(buffer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return internalError("cannot read image file", err)
+		}
+
+		res := &pcbook.DownloadImageResponse{
+			Data: &pcbook.DownloadImageResponse_DataChunk{
+				DataChunk: buffer[:n],
+			},
+		}
+
+		err = stream.Send(res)
+		if err != nil {
+			return streamError("cannot send data chunk", err)
+		}
+	}
+
+	log.Printf("image sent with id: %s", imageID)
+
+	return nil
 }
 
 // RateLaptop bidirectional stream that allows client to rate a stream of laptops with a score and returns a stream of average score for each of them
@@ -212,8 +703,7 @@ func (server *LaptopServiceServer) RateLaptop(stream pcbook.LaptopService_RateLa
 			break
 		}
 		if err != nil {
-			log.Printf("cannot receive stream request: %v", err)
-			return status.Errorf(codes.Internal, "cannot receive stream request: %v", err)
+			return streamError("cannot receive stream request", err)
 		}
 
 		laptopID := req.GetLaptopId()
@@ -223,31 +713,130 @@ func (server *LaptopServiceServer) RateLaptop(stream pcbook.LaptopService_RateLa
 
 		found, err := server.laptopStore.Find(laptopID)
 		if err != nil {
-			log.Printf("cannot find laptop in store: %v", err)
-			return status.Errorf(codes.Internal, "cannot find laptop in store: %v", err)
+			return internalError("cannot find laptop in store", err)
 		}
 		if found == nil {
-			return status.Errorf(codes.NotFound, "laptopID: %s not found", laptopID) 
+			return notFoundError(ReasonLaptopNotFound, laptopResourceType, laptopID)
 		}
 
 		rating, err := server.ratingStore.Add(laptopID, score)
+		if errors.Is(err, ErrorInvalidScore) {
+			return badRequestError(ReasonInvalidScore, "score", err.Error())
+		}
 		if err != nil {
-			log.Printf("cannot add rating to the store: %v", err)
-			return status.Errorf(codes.Internal, "cannot add rating to the store: %v", err)
+			return internalError("cannot add rating to the store", err)
 		}
 
 		res := &pcbook.RateLaptopResponse{
 			LaptopId:     laptopID,
 			TimesRated: rating.Count,
-			AverageScore: rating.Sum / float64(rating.Count),
+			AverageScore: rating.Average(),
+		}
+
+		err = stream.Send(res)
+		if err != nil {
+			return streamError("cannot send stream response", err)
+		}
+	}
+
+	return nil
+}
+
+// GetRating unary RPC that returns the rating statistics of a laptop
+func (server *LaptopServiceServer) GetRating(ctx context.Context, req *pcbook.GetRatingRequest) (*pcbook.GetRatingResponse, error) {
+	laptopID := req.GetLaptopId()
+	log.Printf("received a GetRating request for laptop: %s", laptopID)
+
+	found, err := server.laptopStore.Find(laptopID)
+	if err != nil {
+		return nil, internalError("cannot find laptop in store", err)
+	}
+	if found == nil {
+		return nil, notFoundError(ReasonLaptopNotFound, laptopResourceType, laptopID)
+	}
+
+	rating, err := server.ratingStore.Find(laptopID)
+	if err != nil {
+		return nil, internalError("cannot find rating in store", err)
+	}
+	if rating == nil {
+		rating = &Rating{}
+	}
+
+	res := &pcbook.GetRatingResponse{
+		LaptopId: laptopID,
+		Rating:   toPbRating(rating),
+	}
+
+	return res, nil
+}
+
+// TopRatedLaptops server stream that returns the best rated laptops, ranked by bayesian average
+func (server *LaptopServiceServer) TopRatedLaptops(req *pcbook.TopRatedLaptopsRequest, stream pcbook.LaptopService_TopRatedLaptopsServer) error {
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultTopRatedLimit
+	}
+	log.Printf("received a TopRatedLaptops request: limit = %d, min times rated = %d", limit, req.GetMinTimesRated())
+
+	// the rated laptops no longer in the store are skipped, so every rating is ranked
+	// and the laptops are sent until limit of them have been
+	ranked, err := server.ratingStore.TopRated(0, req.GetMinTimesRated())
+	if err != nil {
+		return internalError("cannot get top rated laptops", err)
+	}
+
+	sent := 0
+	for _, item := range ranked {
+		if sent == limit {
+			break
+		}
+		if err := contextError(stream.Context()); err != nil {
+			return err
+		}
+
+		laptop, err := server.laptopStore.Find(item.LaptopID)
+		if err != nil {
+			return internalError("cannot find laptop in store", err)
+		}
+		if laptop == nil {
+			continue
+		}
+
+		res := &pcbook.TopRatedLaptopsResponse{
+			Laptop:        laptop,
+			Rating:        toPbRating(item.Rating),
+			BayesianScore: item.BayesianScore,
 		}
 
 		err = stream.Send(res)
 		if err != nil {
-			log.Printf("cannot send stream response: %v", err)
-			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+			return streamError("cannot send stream response", err)
 		}
+		sent++
 	}
 
 	return nil
 }
+
+// withoutPriceLimit returns a copy of the filter which does not limit the price if its max price is not set,
+// the filter itself otherwise
+func withoutPriceLimit(filter *pcbook.Filter) *pcbook.Filter {
+	if filter == nil || filter.GetMaxPriceUsd() != 0 {
+		return filter
+	}
+
+	filter = proto.Clone(filter).(*pcbook.Filter)
+	filter.MaxPriceUsd = math.MaxFloat64
+	return filter
+}
+
+func toPbRating(rating *Rating) *pcbook.Rating {
+	return &pcbook.Rating{
+		TimesRated:   rating.Count,
+		AverageScore: rating.Average(),
+		MinScore:     rating.Min,
+		MaxScore:     rating.Max,
+		Histogram:    rating.Histogram,
+	}
+}
@@ -3,6 +3,7 @@ package service_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
 	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
@@ -11,6 +12,7 @@ import (
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestServerCreateLaptop(t *testing.T) {
@@ -89,3 +91,81 @@ func TestServerCreateLaptop(t *testing.T) {
 		})
 	}
 }
+
+func TestServerCreateLaptopSetsUpdatedAt(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	server := service.NewLaptopServer(store, nil, nil)
+
+	noUpdatedAt := sample.NewLaptop()
+	noUpdatedAt.UpdatedAt = nil
+	future := sample.NewLaptop()
+	future.UpdatedAt = timestamppb.New(time.Now().Add(24 * time.Hour))
+
+	for _, laptop := range []*pcbook.Laptop{noUpdatedAt, future} {
+		before := time.Now()
+		res, err := server.CreateLaptop(context.Background(), &pcbook.CreateLaptopRequest{Laptop: laptop})
+		require.NoError(t, err)
+
+		stored, err := store.Find(res.GetId())
+		require.NoError(t, err)
+		require.False(t, stored.GetUpdatedAt().AsTime().Before(before))
+		require.False(t, stored.GetUpdatedAt().AsTime().After(time.Now()))
+		require.Equal(t, service.LaptopEtag(stored), res.GetEtag())
+		require.NotEqual(t, "0", res.GetEtag())
+	}
+}
+
+func TestServerUpdateLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptop := sample.NewLaptop()
+	store := service.NewInMemoryLaptopStore()
+	err := store.Save(laptop)
+	require.Nil(t, err)
+
+	laptopInvalidID := sample.NewLaptop()
+	laptopInvalidID.Id = "invalid-uuid"
+
+	testCases := []struct {
+		name   string
+		laptop *pcbook.Laptop
+		code   codes.Code
+	}{
+		{
+			name:   "success",
+			laptop: laptop,
+			code:   codes.OK,
+		},
+		{
+			name:   "failure_invalid_id",
+			laptop: laptopInvalidID,
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "failure_not_found",
+			laptop: sample.NewLaptop(),
+			code:   codes.NotFound,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := service.NewLaptopServer(store, nil, nil)
+
+			res, err := server.UpdateLaptop(context.Background(), &pcbook.UpdateLaptopRequest{Laptop: tc.laptop})
+			if tc.code == codes.OK {
+				require.NoError(t, err)
+				require.Equal(t, tc.laptop.Id, res.Id)
+			} else {
+				require.Nil(t, res)
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				require.Equal(t, tc.code, st.Code())
+			}
+		})
+	}
+}
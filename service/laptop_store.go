@@ -5,37 +5,145 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
-	"github.com/jinzhu/copier"
 	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // ErrorAlreadyExists is returned when a record with the same ID already present in the store
 var ErrorAlreadyExists = errors.New("record already exist")
 
+// ErrorNotFound is returned when no record with the given ID is present in the store
+var ErrorNotFound = errors.New("record not found")
+
+// ErrorBatchAborted is returned for the laptops of an atomic batch that were not saved because another one failed
+var ErrorBatchAborted = errors.New("batch aborted")
+
+// ErrorEtagMismatch is returned when a laptop was changed since the etag of a conditional update was read
+var ErrorEtagMismatch = errors.New("etag mismatch")
+
+// ErrorInvalidSequence is returned when watching from a sequence that is no longer or not yet in the event history
+var ErrorInvalidSequence = errors.New("sequence is out of range")
+
+// ErrorWatcherTooSlow is returned when a watcher does not consume events as fast as they are produced
+var ErrorWatcherTooSlow = errors.New("watcher is too slow")
+
+const (
+	// laptopEventHistorySize is the number of past events kept to resume a watch
+	laptopEventHistorySize = 1024
+	// laptopWatcherBufferSize is the number of events a watcher can lag behind before it is dropped
+	laptopWatcherBufferSize = 256
+)
+
 // LaptopStore is an interface to store laptop
 type LaptopStore interface {
 	// Save saves the laptop to the store
 	Save(laptop *pcbook.Laptop) error
 
+	// SaveBatch saves many laptops at once and returns an error per laptop, nil if it was saved.
+	// If atomic, either every laptop is saved or none of them, the valid ones failing with ErrorBatchAborted
+	SaveBatch(laptops []*pcbook.Laptop, atomic bool) []error
+
+	// Update replaces an existing laptop, returns ErrorNotFound if there is no laptop with the same ID
+	Update(laptop *pcbook.Laptop) error
+
+	// ConditionalUpdate replaces a laptop if the conditions hold and returns whether it was created instead.
+	// It returns ErrorEtagMismatch if the laptop changed since its etag was read. The updated_at of the
+	// laptop is moved past the stored one if needed, so that its etag changes
+	ConditionalUpdate(laptop *pcbook.Laptop, conditions UpdateConditions) (bool, error)
+
+	// Delete deletes a laptop by ID, returns ErrorNotFound if there is no such laptop
+	Delete(id string) error
+
 	// Find find a laptop by Id
 	Find(id string) (*pcbook.Laptop, error)
 
 	// Search search for a laptops via provided filter, returns one by one via found func
 	Search(ctx context.Context, filter *pcbook.Filter, found func(laptop *pcbook.Laptop) error) error
+
+	// Query searches for the laptops matching all the criteria of the query,
+	// returns them one by one via found func from the most relevant
+	Query(ctx context.Context, query LaptopQuery, found func(laptop *pcbook.Laptop, score float64) error) error
+
+	// Aggregate counts the laptops matching the filter, all of them if nil, per value of their fields.
+	// The prices are counted in buckets below each of the ascending priceBounds and above the last one
+	Aggregate(filter *pcbook.Filter, priceBounds []float64) (*LaptopFacets, error)
+
+	// Watch replays the events after the given sequence (0 for none) and then blocks
+	// passing every new event to changed until the context is done or changed returns an error
+	Watch(ctx context.Context, afterSequence uint64, changed func(event *LaptopEvent) error) error
+}
+
+// UpdateConditions are the conditions of a laptop update
+type UpdateConditions struct {
+	// Etag is the etag the stored laptop must have, any if empty
+	Etag string
+	// AllowMissing saves the laptop if there is none with the same ID, unless Etag is set
+	AllowMissing bool
+}
+
+// LaptopQuery are the criteria of a laptop query
+type LaptopQuery struct {
+	// Text is a free text query, the laptops must match every word of it and are scored by relevance.
+	// A text without words matches every laptop with a score of 0
+	Text string
+	// Filter restricts the laptops if not nil
+	Filter *pcbook.Filter
+	// Expression restricts the laptops if not nil
+	Expression *LaptopExpression
+}
+
+// LaptopEtag returns the etag of a laptop version, derived from its updated_at
+func LaptopEtag(laptop *pcbook.Laptop) string {
+	return strconv.FormatInt(laptop.GetUpdatedAt().AsTime().UnixNano(), 36)
+}
+
+// LaptopEventType is the kind of change that happened to a laptop
+type LaptopEventType int
+
+// types of laptop events
+const (
+	LaptopCreated LaptopEventType = iota + 1
+	LaptopUpdated
+	LaptopDeleted
+)
+
+// LaptopEvent describes a change of a laptop in the store
+type LaptopEvent struct {
+	// Sequence is increasing with every change made to the store
+	Sequence uint64
+	Type     LaptopEventType
+	// Laptop is the state after the change, or the last state for a deleted laptop
+	Laptop *pcbook.Laptop
+	// Previous is the state before an update, nil for other events
+	Previous *pcbook.Laptop
 }
 
 // InMemoryLaptopStore stores laptop in memory
 type InMemoryLaptopStore struct {
-	mutex sync.RWMutex
-	data  map[string]*pcbook.Laptop
+	mutex    sync.RWMutex
+	data     map[string]*pcbook.Laptop
+	sequence uint64
+	history  []*LaptopEvent
+	watchers map[*laptopWatcher]bool
+	indexes  *laptopIndexes
+}
+
+type laptopWatcher struct {
+	events chan *LaptopEvent
 }
 
 // NewInMemoryLaptopStore returns a new InMemoryLaptopStore
 func NewInMemoryLaptopStore() *InMemoryLaptopStore {
 	return &InMemoryLaptopStore{
-		data: make(map[string]*pcbook.Laptop),
+		data:     make(map[string]*pcbook.Laptop),
+		watchers: make(map[*laptopWatcher]bool),
+		indexes:  newLaptopIndexes(),
 	}
 }
 
@@ -48,13 +156,109 @@ func (store *InMemoryLaptopStore) Save(laptop *pcbook.Laptop) error {
 		return ErrorAlreadyExists
 	}
 
-	// deep copy
-	other, err := deepCopy(laptop)
-	if err != nil {
-		return err
+	other := deepCopy(laptop)
+	store.data[other.Id] = other
+	store.indexes.insert(other)
+	store.publish(LaptopCreated, other, nil)
+
+	return nil
+}
+
+// SaveBatch saves many laptops at once, all of them or none if atomic
+func (store *InMemoryLaptopStore) SaveBatch(laptops []*pcbook.Laptop, atomic bool) []error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	errs := make([]error, len(laptops))
+	others := make([]*pcbook.Laptop, len(laptops))
+	seen := make(map[string]bool, len(laptops))
+	failed := false
+
+	for i, laptop := range laptops {
+		if store.data[laptop.Id] != nil || seen[laptop.Id] {
+			errs[i] = ErrorAlreadyExists
+			failed = true
+			continue
+		}
+		seen[laptop.Id] = true
+		others[i] = deepCopy(laptop)
 	}
 
+	if atomic && failed {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = ErrorBatchAborted
+			}
+		}
+		return errs
+	}
+
+	for i, other := range others {
+		if errs[i] == nil {
+			store.data[other.Id] = other
+			store.indexes.insert(other)
+			store.publish(LaptopCreated, other, nil)
+		}
+	}
+
+	return errs
+}
+
+// Update replaces an existing laptop
+func (store *InMemoryLaptopStore) Update(laptop *pcbook.Laptop) error {
+	_, err := store.ConditionalUpdate(laptop, UpdateConditions{})
+	return err
+}
+
+// ConditionalUpdate replaces a laptop if the conditions hold, or saves it if it is missing and allowed
+func (store *InMemoryLaptopStore) ConditionalUpdate(laptop *pcbook.Laptop, conditions UpdateConditions) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	previous := store.data[laptop.Id]
+	if previous == nil {
+		if !conditions.AllowMissing || len(conditions.Etag) > 0 {
+			return false, ErrorNotFound
+		}
+	} else {
+		if len(conditions.Etag) > 0 && conditions.Etag != LaptopEtag(previous) {
+			return false, ErrorEtagMismatch
+		}
+
+		// the etag must change with every update, even with a clock going backwards
+		if !laptop.GetUpdatedAt().AsTime().After(previous.GetUpdatedAt().AsTime()) {
+			laptop.UpdatedAt = timestamppb.New(previous.GetUpdatedAt().AsTime().Add(time.Nanosecond))
+		}
+	}
+
+	other := deepCopy(laptop)
 	store.data[other.Id] = other
+	if previous != nil {
+		store.indexes.remove(previous)
+	}
+	store.indexes.insert(other)
+	if previous == nil {
+		store.publish(LaptopCreated, other, nil)
+		return true, nil
+	}
+	store.publish(LaptopUpdated, other, previous)
+
+	return false, nil
+}
+
+// Delete deletes a laptop by ID
+func (store *InMemoryLaptopStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	laptop := store.data[id]
+	if laptop == nil {
+		return ErrorNotFound
+	}
+
+	delete(store.data, id)
+	store.indexes.remove(laptop)
+	store.publish(LaptopDeleted, laptop, nil)
 
 	return nil
 }
@@ -69,35 +273,244 @@ func (store *InMemoryLaptopStore) Find(id string) (*pcbook.Laptop, error) {
 		return nil, nil
 	}
 
-	return deepCopy(laptop)
+	return deepCopy(laptop), nil
 }
 
-// Search search for a laptops via provided filter, returns one by one via found func
+// Search search for a laptops via provided filter, returns one by one via found func.
+// Only the laptops in the range of the most selective index are matched against the filter. The matches
+// are collected under the read lock and passed to found after it is released, so a slow caller never
+// blocks the writers. The stored laptops are replaced rather than modified, so the matches stay consistent
 func (store *InMemoryLaptopStore) Search(ctx context.Context, filter *pcbook.Filter, found func(laptop *pcbook.Laptop) error) error {
+	matches := store.match(filter)
+
+	for _, laptop := range matches {
+		if ctx.Err() == context.Canceled || ctx.Err() == context.DeadlineExceeded {
+			log.Print("context is cancelled")
+			return errors.New("context is cancelled")
+		}
+
+		err := found(deepCopy(laptop))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match returns the stored laptops matching the filter, they must not be modified
+func (store *InMemoryLaptopStore) match(filter *pcbook.Filter) []*pcbook.Laptop {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	for _, laptop := range store.data {
+	var matches []*pcbook.Laptop
+	plan := store.indexes.plan(filter)
+	plan.index.ascend(plan.min, plan.max, func(id string) bool {
+		laptop := store.data[id]
+		if isMatchFilter(filter, laptop) {
+			matches = append(matches, laptop)
+		}
+		return true
+	})
+	return matches
+}
+
+// Query searches for the laptops matching all the criteria of the query, from the most relevant
+func (store *InMemoryLaptopStore) Query(ctx context.Context, query LaptopQuery, found func(laptop *pcbook.Laptop, score float64) error) error {
+	matches := store.matchQuery(query)
 
+	for _, match := range matches {
 		if ctx.Err() == context.Canceled || ctx.Err() == context.DeadlineExceeded {
 			log.Print("context is cancelled")
 			return errors.New("context is cancelled")
 		}
 
+		err := found(deepCopy(match.laptop), match.score)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scoredLaptop is a stored laptop matching a query, it must not be modified
+type scoredLaptop struct {
+	laptop *pcbook.Laptop
+	score  float64
+}
+
+// matchQuery returns the stored laptops matching the query, by decreasing score and then by ID
+func (store *InMemoryLaptopStore) matchQuery(query LaptopQuery) []scoredLaptop {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var matches []scoredLaptop
+	add := func(id string, score float64) {
+		laptop := store.data[id]
+		if query.Filter != nil && !isMatchFilter(query.Filter, laptop) {
+			return
+		}
+		if query.Expression != nil && !query.Expression.Match(laptop) {
+			return
+		}
+		matches = append(matches, scoredLaptop{laptop: laptop, score: score})
+	}
+
+	scores := store.indexes.text.match(query.Text, len(store.data))
+	switch {
+	case scores != nil:
+		for id, score := range scores {
+			add(id, score)
+		}
+	case query.Filter != nil:
+		// without words, only the laptops in the range of the most selective index are matched, as by Search
+		plan := store.indexes.plan(query.Filter)
+		plan.index.ascend(plan.min, plan.max, func(id string) bool {
+			add(id, 0)
+			return true
+		})
+	default:
+		for id := range store.data {
+			add(id, 0)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].laptop.GetId() < matches[j].laptop.GetId()
+	})
+	return matches
+}
+
+// Aggregate counts the laptops matching the filter per value of their fields
+func (store *InMemoryLaptopStore) Aggregate(filter *pcbook.Filter, priceBounds []float64) (*LaptopFacets, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	facets := newLaptopFacets(priceBounds)
+	if filter == nil {
+		for _, laptop := range store.data {
+			facets.add(laptop, priceBounds)
+		}
+		return facets, nil
+	}
+
+	plan := store.indexes.plan(filter)
+	plan.index.ascend(plan.min, plan.max, func(id string) bool {
+		laptop := store.data[id]
 		if isMatchFilter(filter, laptop) {
-			// deep copy
-			other, err := deepCopy(laptop)
-			if err != nil {
-				return err
+			facets.add(laptop, priceBounds)
+		}
+		return true
+	})
+	return facets, nil
+}
+
+// Watch replays the events after the given sequence and then passes every new event to changed
+func (store *InMemoryLaptopStore) Watch(ctx context.Context, afterSequence uint64, changed func(event *LaptopEvent) error) error {
+	store.mutex.Lock()
+	backlog, err := store.eventsAfter(afterSequence)
+	if err != nil {
+		store.mutex.Unlock()
+		return err
+	}
+
+	watcher := &laptopWatcher{
+		events: make(chan *LaptopEvent, laptopWatcherBufferSize),
+	}
+	store.watchers[watcher] = true
+	store.mutex.Unlock()
+
+	defer store.unwatch(watcher)
+
+	for _, event := range backlog {
+		err := notify(event, changed)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-watcher.events:
+			if !ok {
+				return ErrorWatcherTooSlow
 			}
 
-			err = found(other)
+			err := notify(event, changed)
 			if err != nil {
 				return err
 			}
 		}
 	}
-	return nil
+}
+
+// publish records a new event and sends it to the watchers, must be called with the write lock held
+func (store *InMemoryLaptopStore) publish(eventType LaptopEventType, laptop *pcbook.Laptop, previous *pcbook.Laptop) {
+	store.sequence++
+	event := &LaptopEvent{
+		Sequence: store.sequence,
+		Type:     eventType,
+		Laptop:   laptop,
+		Previous: previous,
+	}
+
+	store.history = append(store.history, event)
+	if len(store.history) > laptopEventHistorySize {
+		store.history = store.history[len(store.history)-laptopEventHistorySize:]
+	}
+
+	for watcher := range store.watchers {
+		select {
+		case watcher.events <- event:
+		default:
+			// never block writers on a slow watcher, it can resume from its last sequence
+			delete(store.watchers, watcher)
+			close(watcher.events)
+		}
+	}
+}
+
+// eventsAfter returns the recorded events after the sequence, must be called with the lock held
+func (store *InMemoryLaptopStore) eventsAfter(sequence uint64) ([]*LaptopEvent, error) {
+	if sequence == 0 || sequence == store.sequence {
+		return nil, nil
+	}
+	if sequence > store.sequence || len(store.history) == 0 || sequence+1 < store.history[0].Sequence {
+		return nil, fmt.Errorf("%w: %d", ErrorInvalidSequence, sequence)
+	}
+
+	first := int(sequence + 1 - store.history[0].Sequence)
+	backlog := make([]*LaptopEvent, len(store.history)-first)
+	copy(backlog, store.history[first:])
+	return backlog, nil
+}
+
+func (store *InMemoryLaptopStore) unwatch(watcher *laptopWatcher) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.watchers[watcher] {
+		delete(store.watchers, watcher)
+		close(watcher.events)
+	}
+}
+
+// notify passes a copy of the event to changed so the recorded laptops are never modified
+func notify(event *LaptopEvent, changed func(event *LaptopEvent) error) error {
+	other := &LaptopEvent{
+		Sequence: event.Sequence,
+		Type:     event.Type,
+		Laptop:   deepCopy(event.Laptop),
+	}
+	if event.Previous != nil {
+		other.Previous = deepCopy(event.Previous)
+	}
+
+	return changed(other)
 }
 
 func isMatchFilter(filter *pcbook.Filter, laptop *pcbook.Laptop) bool {
@@ -138,12 +551,7 @@ func toBit(memory *pcbook.Memory) uint64 {
 	}
 }
 
-func deepCopy(laptop *pcbook.Laptop) (*pcbook.Laptop, error) {
-	// deep copy
-	other := &pcbook.Laptop{}
-	err := copier.Copy(other, laptop)
-	if err != nil {
-		return nil, fmt.Errorf("cannot copy laptop data: %w", err)
-	}
-	return other, nil
+// deepCopy clones a laptop, so that the stored laptops are never shared with the callers
+func deepCopy(laptop *pcbook.Laptop) *pcbook.Laptop {
+	return proto.Clone(laptop).(*pcbook.Laptop)
 }
@@ -0,0 +1,317 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestLaptopStoreSaveBatch(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	existing := sample.NewLaptop()
+	require.NoError(t, store.Save(existing))
+
+	// the existing laptop and the second copy of duplicate fail, the others are saved
+	duplicate := sample.NewLaptop()
+	laptops := []*pcbook.Laptop{sample.NewLaptop(), existing, duplicate, duplicate}
+	errs := store.SaveBatch(laptops, false)
+	require.Len(t, errs, 4)
+	require.NoError(t, errs[0])
+	require.True(t, errors.Is(errs[1], service.ErrorAlreadyExists))
+	require.NoError(t, errs[2])
+	require.True(t, errors.Is(errs[3], service.ErrorAlreadyExists))
+
+	for _, laptop := range []*pcbook.Laptop{laptops[0], duplicate} {
+		found, err := store.Find(laptop.GetId())
+		require.NoError(t, err)
+		require.NotNil(t, found)
+	}
+
+	// nothing is saved by an atomic batch with a conflict
+	laptops = []*pcbook.Laptop{sample.NewLaptop(), existing}
+	errs = store.SaveBatch(laptops, true)
+	require.True(t, errors.Is(errs[0], service.ErrorBatchAborted))
+	require.True(t, errors.Is(errs[1], service.ErrorAlreadyExists))
+
+	found, err := store.Find(laptops[0].GetId())
+	require.NoError(t, err)
+	require.Nil(t, found)
+
+	laptops = []*pcbook.Laptop{sample.NewLaptop(), sample.NewLaptop()}
+	for _, err := range store.SaveBatch(laptops, true) {
+		require.NoError(t, err)
+	}
+}
+
+func TestLaptopStoreConditionalUpdate(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, store.Save(laptop))
+	etag := service.LaptopEtag(laptop)
+
+	// the etag changes even if updated_at is not moved forward
+	created, err := store.ConditionalUpdate(laptop, service.UpdateConditions{Etag: etag})
+	require.NoError(t, err)
+	require.False(t, created)
+	require.NotEqual(t, etag, service.LaptopEtag(laptop))
+
+	_, err = store.ConditionalUpdate(laptop, service.UpdateConditions{Etag: etag})
+	require.True(t, errors.Is(err, service.ErrorEtagMismatch))
+
+	missing := sample.NewLaptop()
+	_, err = store.ConditionalUpdate(missing, service.UpdateConditions{})
+	require.True(t, errors.Is(err, service.ErrorNotFound))
+	_, err = store.ConditionalUpdate(missing, service.UpdateConditions{AllowMissing: true, Etag: etag})
+	require.True(t, errors.Is(err, service.ErrorNotFound))
+
+	created, err = store.ConditionalUpdate(missing, service.UpdateConditions{AllowMissing: true})
+	require.NoError(t, err)
+	require.True(t, created)
+
+	found, err := store.Find(missing.GetId())
+	require.NoError(t, err)
+	require.Equal(t, service.LaptopEtag(missing), service.LaptopEtag(found))
+}
+
+func TestLaptopStoreCopies(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+
+	kg := sample.NewLaptop()
+	kg.Weight = &pcbook.Laptop_WeightKg{WeightKg: 1.25}
+	lb := sample.NewLaptop()
+	lb.Weight = &pcbook.Laptop_WeightLb{WeightLb: 3.5}
+	lb.UpdatedAt = timestamppb.New(time.Date(2021, 7, 1, 12, 30, 15, 123456789, time.UTC))
+	noWeight := sample.NewLaptop()
+	noWeight.Weight = nil
+
+	laptops := []*pcbook.Laptop{kg, lb, noWeight}
+	for _, laptop := range laptops {
+		require.NoError(t, store.Save(laptop))
+	}
+
+	for _, laptop := range laptops {
+		found, err := store.Find(laptop.GetId())
+		require.NoError(t, err)
+		require.True(t, proto.Equal(laptop, found), "found %v, want %v", found, laptop)
+		require.Equal(t, laptop.GetUpdatedAt().AsTime(), found.GetUpdatedAt().AsTime())
+
+		// the returned laptop is a copy, changing it does not change the stored one
+		found.Weight = &pcbook.Laptop_WeightKg{WeightKg: 99}
+		found.UpdatedAt.Nanos++
+		found.Cpu.Name = "changed"
+	}
+
+	// the saved laptop is a copy too
+	kg.Cpu.Name = "changed"
+
+	searched := map[string]*pcbook.Laptop{}
+	err := store.Search(context.Background(), &pcbook.Filter{MaxPriceUsd: 5000}, func(laptop *pcbook.Laptop) error {
+		searched[laptop.GetId()] = laptop
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, searched, len(laptops))
+
+	require.Equal(t, 1.25, searched[kg.GetId()].GetWeightKg())
+	require.NotEqual(t, "changed", searched[kg.GetId()].GetCpu().GetName())
+	require.Equal(t, 3.5, searched[lb.GetId()].GetWeightLb())
+	require.Equal(t, lb.GetUpdatedAt().AsTime(), searched[lb.GetId()].GetUpdatedAt().AsTime())
+	require.Nil(t, searched[noWeight.GetId()].GetWeight())
+}
+
+func TestLaptopStoreSearchSlowConsumer(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	laptops := make([]*pcbook.Laptop, 5)
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+		laptops[i].PriceUsd = 1000
+		require.NoError(t, store.Save(laptops[i]))
+	}
+
+	received := make(chan *pcbook.Laptop)
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- store.Search(context.Background(), &pcbook.Filter{MaxPriceUsd: 2000}, func(laptop *pcbook.Laptop) error {
+			received <- laptop
+			<-release
+			return nil
+		})
+	}()
+
+	// the consumer is stuck on the first laptop, writers must not wait for it
+	first := <-received
+	writes := make(chan error, 1)
+	go func() {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = 1000
+		if err := store.Save(laptop); err != nil {
+			writes <- err
+			return
+		}
+		if err := store.Delete(laptops[4].GetId()); err != nil {
+			writes <- err
+			return
+		}
+		updated := proto.Clone(laptops[3]).(*pcbook.Laptop)
+		updated.PriceUsd = 1500
+		writes <- store.Update(updated)
+	}()
+
+	select {
+	case err := <-writes:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("writers are blocked by a slow search consumer")
+	}
+
+	// the search still returns the laptops as they were when it started
+	ids := []string{first.GetId()}
+	close(release)
+	for i := 1; i < len(laptops); i++ {
+		laptop := <-received
+		require.Equal(t, 1000.0, laptop.GetPriceUsd())
+		ids = append(ids, laptop.GetId())
+	}
+	require.NoError(t, <-done)
+
+	want := []string{}
+	for _, laptop := range laptops {
+		want = append(want, laptop.GetId())
+	}
+	require.ElementsMatch(t, want, ids)
+}
+
+func TestLaptopStoreQuery(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	newLaptop := func(brand string, name string, cpu string, gpu string, price float64) *pcbook.Laptop {
+		laptop := sample.NewLaptop()
+		laptop.Brand = brand
+		laptop.Name = name
+		laptop.Cpu.Brand = "Intel"
+		laptop.Cpu.Name = cpu
+		laptop.Gpus = []*pcbook.GPU{sample.NewGPU()}
+		laptop.Gpus[0].Brand = "NVIDIA"
+		laptop.Gpus[0].Name = gpu
+		laptop.PriceUsd = price
+		require.NoError(t, store.Save(laptop))
+		return laptop
+	}
+
+	thinkpad := newLaptop("Lenovo", "Thinkpad X1", "Core i7-1165G7", "RTX 2060", 2000)
+	thinkpadI5 := newLaptop("Lenovo", "Thinkpad P1", "Core i5-9400F", "GTX 1660-Ti", 1200)
+	xps := newLaptop("Dell", "XPS 15", "Core i7-9750H", "GTX 1650", 2500)
+	thinkbook := newLaptop("Lenovo", "Thinkbook 14", "Core i7-8565U", "GTX 1050", 900)
+
+	query := func(query string, filter *pcbook.Filter) ([]string, []float64) {
+		ids := []string{}
+		scores := []float64{}
+		err := store.Query(context.Background(), service.LaptopQuery{Text: query, Filter: filter}, func(laptop *pcbook.Laptop, score float64) error {
+			ids = append(ids, laptop.GetId())
+			scores = append(scores, score)
+			return nil
+		})
+		require.NoError(t, err)
+		return ids, scores
+	}
+
+	ids, scores := query("thinkpad i7 nvidia", nil)
+	require.Equal(t, []string{thinkpad.GetId()}, ids)
+	require.Positive(t, scores[0])
+
+	// the words are prefixes, an exact match scores more than a prefix of a longer term
+	ids, scores = query("THINK", nil)
+	require.ElementsMatch(t, []string{thinkpad.GetId(), thinkpadI5.GetId(), thinkbook.GetId()}, ids)
+	prefixScore := scores[0]
+	ids, scores = query("thinkbook", nil)
+	require.Equal(t, []string{thinkbook.GetId()}, ids)
+	require.Greater(t, scores[0], prefixScore)
+
+	// the GPU names are indexed as well
+	ids, _ = query("1650", nil)
+	require.Equal(t, []string{xps.GetId()}, ids)
+	ids, scores = query("lenovo i7", nil)
+	require.ElementsMatch(t, []string{thinkpad.GetId(), thinkbook.GetId()}, ids)
+	require.Equal(t, scores[0], scores[1])
+
+	ids, _ = query("i7", &pcbook.Filter{MaxPriceUsd: 2200})
+	require.ElementsMatch(t, []string{thinkpad.GetId(), thinkbook.GetId()}, ids)
+
+	ids, scores = query("", &pcbook.Filter{MaxPriceUsd: 1500})
+	require.ElementsMatch(t, []string{thinkpadI5.GetId(), thinkbook.GetId()}, ids)
+	require.Equal(t, []float64{0, 0}, scores)
+
+	// the index follows the updates and deletions
+	thinkpad.Name = "Yoga 9"
+	require.NoError(t, store.Update(thinkpad))
+	require.NoError(t, store.Delete(thinkbook.GetId()))
+	ids, _ = query("thinkpad", nil)
+	require.Equal(t, []string{thinkpadI5.GetId()}, ids)
+	ids, _ = query("yoga", nil)
+	require.Equal(t, []string{thinkpad.GetId()}, ids)
+	ids, _ = query("thinkbook", nil)
+	require.Empty(t, ids)
+}
+
+func TestLaptopStoreAggregate(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	newLaptop := func(brand string, gpuBrands []string, ram *pcbook.Memory, panel pcbook.Screen_Panel, price float64) {
+		laptop := sample.NewLaptop()
+		laptop.Brand = brand
+		laptop.Cpu.Brand = "Intel"
+		laptop.Gpus = nil
+		for _, gpuBrand := range gpuBrands {
+			gpu := sample.NewGPU()
+			gpu.Brand = gpuBrand
+			laptop.Gpus = append(laptop.Gpus, gpu)
+		}
+		laptop.Ram = ram
+		laptop.Screen.Panel = panel
+		laptop.Keyboard.Layout = pcbook.Keyboard_QWERTY
+		laptop.PriceUsd = price
+		require.NoError(t, store.Save(laptop))
+	}
+
+	gb16 := &pcbook.Memory{Value: 16, Unit: pcbook.Memory_GIGABYTE}
+	newLaptop("Dell", []string{"NVIDIA", "NVIDIA"}, gb16, pcbook.Screen_IPS, 900)
+	newLaptop("Dell", []string{"AMD"}, &pcbook.Memory{Value: 16384, Unit: pcbook.Memory_MEGABYTE}, pcbook.Screen_OLED, 1000)
+	newLaptop("Lenovo", []string{"NVIDIA", "AMD"}, &pcbook.Memory{Value: 8, Unit: pcbook.Memory_GIGABYTE}, pcbook.Screen_IPS, 1999)
+	newLaptop("Apple", nil, gb16, pcbook.Screen_UNKNOWN, 2500)
+
+	facets, err := store.Aggregate(nil, []float64{1000, 2000})
+	require.NoError(t, err)
+	require.Equal(t, 4, facets.Total)
+	require.Equal(t, map[string]int{"Dell": 2, "Lenovo": 1, "Apple": 1}, facets.Brands)
+	require.Equal(t, map[string]int{"Intel": 4}, facets.CPUBrands)
+	require.Equal(t, map[string]int{"NVIDIA": 2, "AMD": 2}, facets.GPUBrands)
+	require.Equal(t, map[uint64]int{16 << 33: 3, 8 << 33: 1}, facets.RAM)
+	require.Equal(t, map[pcbook.Screen_Panel]int{pcbook.Screen_IPS: 2, pcbook.Screen_OLED: 1}, facets.Panels)
+	require.Equal(t, map[pcbook.Keyboard_Layout]int{pcbook.Keyboard_QWERTY: 4}, facets.Layouts)
+	require.Equal(t, []int{1, 2, 1}, facets.PriceBuckets)
+
+	facets, err = store.Aggregate(&pcbook.Filter{MaxPriceUsd: 1500}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, facets.Total)
+	require.Equal(t, map[string]int{"Dell": 2}, facets.Brands)
+	require.Equal(t, []int{2}, facets.PriceBuckets)
+}
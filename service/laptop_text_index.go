@@ -0,0 +1,136 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+)
+
+// weights of the laptop fields in the relevance of a free text query
+const (
+	brandTextWeight = 3
+	nameTextWeight  = 3
+	cpuTextWeight   = 2
+	gpuTextWeight   = 1
+)
+
+// textIndex is an inverted index of the words of the laptop brands, names, CPUs and GPUs
+type textIndex struct {
+	// postings maps a term to the weight it has for the laptops containing it
+	postings map[string]map[string]float64
+	// terms are the indexed terms in order, to find the ones starting with a word
+	terms []string
+}
+
+func newTextIndex() *textIndex {
+	return &textIndex{
+		postings: make(map[string]map[string]float64),
+	}
+}
+
+// tokenize splits a text into lower case words of letters and digits, "Core i7-9750H" gives core, i7 and 9750h
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// laptopTerms returns the terms of a laptop with their weight, a term of several fields keeps the largest one
+func laptopTerms(laptop *pcbook.Laptop) map[string]float64 {
+	terms := make(map[string]float64)
+	add := func(text string, weight float64) {
+		for _, term := range tokenize(text) {
+			if weight > terms[term] {
+				terms[term] = weight
+			}
+		}
+	}
+
+	add(laptop.GetBrand(), brandTextWeight)
+	add(laptop.GetName(), nameTextWeight)
+	add(laptop.GetCpu().GetBrand(), cpuTextWeight)
+	add(laptop.GetCpu().GetName(), cpuTextWeight)
+	for _, gpu := range laptop.GetGpus() {
+		add(gpu.GetBrand(), gpuTextWeight)
+		add(gpu.GetName(), gpuTextWeight)
+	}
+	return terms
+}
+
+// insert adds a laptop to the index
+func (index *textIndex) insert(laptop *pcbook.Laptop) {
+	for term, weight := range laptopTerms(laptop) {
+		postings := index.postings[term]
+		if postings == nil {
+			postings = make(map[string]float64)
+			index.postings[term] = postings
+
+			i := sort.SearchStrings(index.terms, term)
+			index.terms = append(index.terms, "")
+			copy(index.terms[i+1:], index.terms[i:])
+			index.terms[i] = term
+		}
+		postings[laptop.GetId()] = weight
+	}
+}
+
+// remove removes a laptop from the index, laptop must be the indexed version
+func (index *textIndex) remove(laptop *pcbook.Laptop) {
+	for term := range laptopTerms(laptop) {
+		postings := index.postings[term]
+		if postings == nil {
+			continue
+		}
+
+		delete(postings, laptop.GetId())
+		if len(postings) > 0 {
+			continue
+		}
+
+		delete(index.postings, term)
+		i := sort.SearchStrings(index.terms, term)
+		if i < len(index.terms) && index.terms[i] == term {
+			index.terms = append(index.terms[:i], index.terms[i+1:]...)
+		}
+	}
+}
+
+// match returns the scores of the laptops matching every word of the query, nil if the query has no words.
+// A word matches the terms starting with it, the score of a word is the best of its terms, weighted by
+// the field, by how much of the term the word covers and by how rare the term is among the total laptops
+func (index *textIndex) match(query string, total int) map[string]float64 {
+	var scores map[string]float64
+	for _, word := range tokenize(query) {
+		wordScores := make(map[string]float64)
+		for i := sort.SearchStrings(index.terms, word); i < len(index.terms) && strings.HasPrefix(index.terms[i], word); i++ {
+			term := index.terms[i]
+			postings := index.postings[term]
+			coverage := float64(len(word)) / float64(len(term))
+			rarity := math.Log(1 + float64(total)/float64(len(postings)))
+
+			for id, weight := range postings {
+				score := weight * coverage * rarity
+				if score > wordScores[id] {
+					wordScores[id] = score
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = wordScores
+			continue
+		}
+		for id, score := range scores {
+			wordScore, ok := wordScores[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] = score + wordScore
+		}
+	}
+	return scores
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+// minReleaseYear is the earliest release year of a laptop
+const minReleaseYear = 1970
+
+// ValidateLaptop checks the rules of a laptop, field is the path of the laptop in the request.
+// It returns the violations found, none if the laptop is valid
+func ValidateLaptop(field string, laptop *pcbook.Laptop) []*errdetails.BadRequest_FieldViolation {
+	v := &laptopValidator{}
+	if laptop == nil {
+		v.check(field, false, "is required")
+		return v.violations
+	}
+
+	v.cpu(field+".cpu", laptop.GetCpu())
+	v.memory(field+".ram", laptop.GetRam())
+	for i, gpu := range laptop.GetGpus() {
+		v.gpu(fmt.Sprintf("%s.gpus[%d]", field, i), gpu)
+	}
+	v.check(field+".storages", len(laptop.GetStorages()) > 0, "must have at least one storage")
+	for i, storage := range laptop.GetStorages() {
+		v.storage(fmt.Sprintf("%s.storages[%d]", field, i), storage)
+	}
+	v.screen(field+".screen", laptop.GetScreen())
+
+	switch weight := laptop.GetWeight().(type) {
+	case *pcbook.Laptop_WeightKg:
+		v.check(field+".weight_kg", weight.WeightKg > 0, "must be positive")
+	case *pcbook.Laptop_WeightLb:
+		v.check(field+".weight_lb", weight.WeightLb > 0, "must be positive")
+	}
+
+	v.check(field+".price_usd", laptop.GetPriceUsd() >= 0, "must not be negative")
+
+	maxReleaseYear := uint32(time.Now().Year() + 1)
+	v.check(field+".release_year", laptop.GetReleaseYear() >= minReleaseYear && laptop.GetReleaseYear() <= maxReleaseYear,
+		fmt.Sprintf("must be between %d and %d", minReleaseYear, maxReleaseYear))
+
+	return v.violations
+}
+
+// invalidLaptopError returns an InvalidArgument error with the violations as BadRequest details
+func invalidLaptopError(violations []*errdetails.BadRequest_FieldViolation) error {
+	descriptions := make([]string, len(violations))
+	for i, violation := range violations {
+		descriptions[i] = violation.GetField() + " " + violation.GetDescription()
+	}
+
+	return newError(codes.InvalidArgument, ReasonInvalidLaptop, "invalid laptop: "+strings.Join(descriptions, ", "),
+		&errdetails.BadRequest{FieldViolations: violations})
+}
+
+// laptopValidator collects the violations of the laptop rules
+type laptopValidator struct {
+	violations []*errdetails.BadRequest_FieldViolation
+}
+
+func (v *laptopValidator) check(field string, valid bool, description string) {
+	if !valid {
+		v.violations = append(v.violations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: description,
+		})
+	}
+}
+
+func (v *laptopValidator) cpu(field string, cpu *pcbook.CPU) {
+	if cpu == nil {
+		v.check(field, false, "is required")
+		return
+	}
+
+	v.check(field+".number_of_cores", cpu.GetNumberOfCores() > 0, "must be positive")
+	v.check(field+".number_of_threads", cpu.GetNumberOfThreads() >= cpu.GetNumberOfCores(), "must not be less than number_of_cores")
+	v.frequency(field, cpu.GetMinGhz(), cpu.GetMaxGhz())
+}
+
+func (v *laptopValidator) gpu(field string, gpu *pcbook.GPU) {
+	v.frequency(field, gpu.GetMinGhz(), gpu.GetMaxGhz())
+	v.memory(field+".memory", gpu.GetMemory())
+}
+
+func (v *laptopValidator) frequency(field string, minGhz float64, maxGhz float64) {
+	v.check(field+".min_ghz", minGhz > 0, "must be positive")
+	v.check(field+".max_ghz", maxGhz >= minGhz, "must not be less than min_ghz")
+}
+
+func (v *laptopValidator) storage(field string, storage *pcbook.Storage) {
+	v.check(field+".driver", storage.GetDriver() != pcbook.Storage_UNKNOWN, "must be HDD or SSD")
+	v.memory(field+".memory", storage.GetMemory())
+}
+
+func (v *laptopValidator) screen(field string, screen *pcbook.Screen) {
+	if screen == nil {
+		return
+	}
+
+	v.check(field+".size_inch", screen.GetSizeInch() > 0, "must be positive")
+	if screen.GetResolution() != nil {
+		v.check(field+".resolution.width", screen.GetResolution().GetWidth() > 0, "must be positive")
+		v.check(field+".resolution.height", screen.GetResolution().GetHeight() > 0, "must be positive")
+	}
+}
+
+func (v *laptopValidator) memory(field string, memory *pcbook.Memory) {
+	if memory == nil {
+		v.check(field, false, "is required")
+		return
+	}
+
+	v.check(field+".value", memory.GetValue() > 0, "must be positive")
+	v.check(field+".unit", memory.GetUnit() != pcbook.Memory_UNKNOWN, "must be a known unit")
+}
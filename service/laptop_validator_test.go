@@ -0,0 +1,147 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateLaptop(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		change func(laptop *pcbook.Laptop)
+		fields []string
+	}{
+		{
+			name:   "valid",
+			change: func(laptop *pcbook.Laptop) {},
+		},
+		{
+			name: "cpu_frequency",
+			change: func(laptop *pcbook.Laptop) {
+				laptop.Cpu.MinGhz = 3.5
+				laptop.Cpu.MaxGhz = 2.5
+			},
+			fields: []string{"laptop.cpu.max_ghz"},
+		},
+		{
+			name: "cpu_cores",
+			change: func(laptop *pcbook.Laptop) {
+				laptop.Cpu.NumberOfCores = 0
+				laptop.Cpu.NumberOfThreads = 0
+			},
+			fields: []string{"laptop.cpu.number_of_cores"},
+		},
+		{
+			name: "cpu_threads",
+			change: func(laptop *pcbook.Laptop) {
+				laptop.Cpu.NumberOfCores = 8
+				laptop.Cpu.NumberOfThreads = 4
+			},
+			fields: []string{"laptop.cpu.number_of_threads"},
+		},
+		{
+			name: "negative_price",
+			change: func(laptop *pcbook.Laptop) {
+				laptop.PriceUsd = -1
+			},
+			fields: []string{"laptop.price_usd"},
+		},
+		{
+			name: "memory_unit",
+			change: func(laptop *pcbook.Laptop) {
+				laptop.Ram.Unit = pcbook.Memory_UNKNOWN
+				laptop.Gpus[0].Memory.Unit = pcbook.Memory_UNKNOWN
+			},
+			fields: []string{"laptop.ram.unit", "laptop.gpus[0].memory.unit"},
+		},
+		{
+			name: "release_year",
+			change: func(laptop *pcbook.Laptop) {
+				laptop.ReleaseYear = 1800
+			},
+			fields: []string{"laptop.release_year"},
+		},
+		{
+			name: "no_storage",
+			change: func(laptop *pcbook.Laptop) {
+				laptop.Storages = nil
+			},
+			fields: []string{"laptop.storages"},
+		},
+		{
+			name: "storage_driver",
+			change: func(laptop *pcbook.Laptop) {
+				laptop.Storages[1].Driver = pcbook.Storage_UNKNOWN
+			},
+			fields: []string{"laptop.storages[1].driver"},
+		},
+		{
+			name: "no_cpu",
+			change: func(laptop *pcbook.Laptop) {
+				laptop.Cpu = nil
+			},
+			fields: []string{"laptop.cpu"},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			laptop := sample.NewLaptop()
+			tc.change(laptop)
+
+			fields := []string{}
+			for _, violation := range service.ValidateLaptop("laptop", laptop) {
+				fields = append(fields, violation.GetField())
+			}
+			require.ElementsMatch(t, tc.fields, fields)
+		})
+	}
+}
+
+func TestServerCreateInvalidLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptop := sample.NewLaptop()
+	laptop.PriceUsd = -1
+	laptop.ReleaseYear = 1800
+
+	server := service.NewLaptopServer(service.NewInMemoryLaptopStore(), nil, nil)
+	_, err := server.CreateLaptop(context.Background(), &pcbook.CreateLaptopRequest{Laptop: laptop})
+	require.Error(t, err)
+
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 2)
+
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	require.Equal(t, service.ReasonInvalidLaptop, info.GetReason())
+
+	badRequest, ok := st.Details()[1].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.GetFieldViolations(), 2)
+	require.Equal(t, "laptop.price_usd", badRequest.GetFieldViolations()[0].GetField())
+	require.Equal(t, "laptop.release_year", badRequest.GetFieldViolations()[1].GetField())
+
+	_, err = server.CreateLaptop(context.Background(), &pcbook.CreateLaptopRequest{})
+	st = status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	badRequest, ok = st.Details()[1].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.GetFieldViolations(), 1)
+	require.Equal(t, "laptop", badRequest.GetFieldViolations()[0].GetField())
+}
@@ -1,49 +1,233 @@
 package service
 
-import "sync"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// maxScore is the highest score a laptop can be rated with by default
+const maxScore = 10
+
+// maxHistogramBuckets bounds the histogram of a score range, which has one bucket per whole score,
+// a range of 0 to 100 is the widest fitting
+const maxHistogramBuckets = 101
+
+// bayesianPriorWeight is the number of virtual global-average votes every laptop starts with when ranking,
+// so a laptop with a single vote of 10 does not outrank one with hundreds of 9s
+const bayesianPriorWeight = 5
+
+// ErrorInvalidScore is returned when a score is not a number or is outside of the accepted range
+var ErrorInvalidScore = errors.New("invalid score")
+
+// ScoreRange is the inclusive range of scores a laptop can be rated with
+type ScoreRange struct {
+	Min float64
+	Max float64
+}
+
+// DefaultScoreRange accepts scores from 1 to 10
+var DefaultScoreRange = ScoreRange{Min: 1, Max: maxScore}
+
+// Validate returns ErrorInvalidScore if the score is not a finite number within the range
+func (scoreRange ScoreRange) Validate(score float64) error {
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return fmt.Errorf("%w: %v is not a number", ErrorInvalidScore, score)
+	}
+	if score < scoreRange.Min || score > scoreRange.Max {
+		return fmt.Errorf("%w: %v is not in range [%v, %v]", ErrorInvalidScore, score, scoreRange.Min, scoreRange.Max)
+	}
+	return nil
+}
+
+// check returns an error if the range is not finite, is empty or has too many whole scores for a histogram
+func (scoreRange ScoreRange) check() error {
+	for _, bound := range []float64{scoreRange.Min, scoreRange.Max} {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("invalid score range: %v is not a number", bound)
+		}
+	}
+	if scoreRange.Min > scoreRange.Max {
+		return fmt.Errorf("invalid score range: min %v is greater than max %v", scoreRange.Min, scoreRange.Max)
+	}
+	// the width is checked as a float, a wide range would overflow an int
+	if width := math.Round(scoreRange.Max) - math.Round(scoreRange.Min); width+1 > maxHistogramBuckets {
+		return fmt.Errorf("invalid score range: [%v, %v] has more than %d whole scores", scoreRange.Min, scoreRange.Max, maxHistogramBuckets)
+	}
+	return nil
+}
+
+// buckets returns the number of histogram buckets of the range, one per whole score from Min to Max rounded,
+// the range must have been checked
+func (scoreRange ScoreRange) buckets() int {
+	return int(math.Round(scoreRange.Max)-math.Round(scoreRange.Min)) + 1
+}
+
+// bucket returns the histogram index of a score within the range
+func (scoreRange ScoreRange) bucket(score float64) int {
+	return int(math.Round(score) - math.Round(scoreRange.Min))
+}
 
 // RatingStore interface to store rating for a laptops
 type RatingStore interface {
-	// Add adds a new laptop score to the store and returns its rating
+	// Add adds a new laptop score to the store and returns its rating, the score must be within the store's range
 	Add(laptopID string, score float64) (*Rating, error)
+
+	// Find finds the rating of a laptop, returns nil if the laptop was never rated
+	Find(laptopID string) (*Rating, error)
+
+	// TopRated returns at most limit ratings with at least minCount scores, best bayesian average first
+	TopRated(limit int, minCount uint32) ([]*RankedRating, error)
 }
 
 // Rating contains the raiting of a laptop
 type Rating struct {
 	Count uint32
 	Sum   float64
+	Min   float64
+	Max   float64
+	// Histogram[i] is the number of scores rounded to the lowest whole score of the range plus i
+	Histogram []uint32
+}
+
+// Average returns the average score of the rating
+func (rating *Rating) Average() float64 {
+	if rating.Count == 0 {
+		return 0
+	}
+	return rating.Sum / float64(rating.Count)
+}
+
+// Clone returns a clone of rating
+func (rating *Rating) Clone() *Rating {
+	other := *rating
+	other.Histogram = append([]uint32(nil), rating.Histogram...)
+	return &other
+}
+
+// RankedRating contains the rating of a laptop along with its bayesian average used for ranking
+type RankedRating struct {
+	LaptopID      string
+	Rating        *Rating
+	BayesianScore float64
 }
 
 // InMemoryRatingStore stores laptops ratings in memory
 type InMemoryRatingStore struct {
-	mutex  sync.RWMutex
-	rating map[string]*Rating
+	mutex      sync.RWMutex
+	scoreRange ScoreRange
+	rating     map[string]*Rating
+	count      uint64
+	sum        float64
 }
 
-// NewInMemoryRatingStore creates a new in memory rating store
+// NewInMemoryRatingStore creates a new in memory rating store accepting scores in DefaultScoreRange
 func NewInMemoryRatingStore() *InMemoryRatingStore {
 	return &InMemoryRatingStore{
-		rating: make(map[string]*Rating),
+		scoreRange: DefaultScoreRange,
+		rating:     make(map[string]*Rating),
 	}
 }
 
+// NewInMemoryRatingStoreWithRange creates a new in memory rating store accepting scores in the given range,
+// which must not be empty nor wider than 0 to 100 since the histograms have a bucket per whole score
+func NewInMemoryRatingStoreWithRange(scoreRange ScoreRange) (*InMemoryRatingStore, error) {
+	if err := scoreRange.check(); err != nil {
+		return nil, err
+	}
+
+	return &InMemoryRatingStore{
+		scoreRange: scoreRange,
+		rating:     make(map[string]*Rating),
+	}, nil
+}
 
 // Add adds a new laptop score to the store and returns its rating
 func (store *InMemoryRatingStore) Add(laptopID string, score float64) (*Rating, error) {
+	if err := store.scoreRange.Validate(score); err != nil {
+		return nil, err
+	}
+
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
 	rating := store.rating[laptopID]
 	if rating == nil {
 		rating = &Rating{
-			Count: 1,
-			Sum:   score,
+			Count:     1,
+			Sum:       score,
+			Min:       score,
+			Max:       score,
+			Histogram: make([]uint32, store.scoreRange.buckets()),
 		}
 	} else {
 		rating.Count++
 		rating.Sum += score
+		rating.Min = math.Min(rating.Min, score)
+		rating.Max = math.Max(rating.Max, score)
 	}
+	rating.Histogram[store.scoreRange.bucket(score)]++
+
+	store.count++
+	store.sum += score
 
 	store.rating[laptopID] = rating
-	return rating, nil
-}
\ No newline at end of file
+	return rating.Clone(), nil
+}
+
+// Find finds the rating of a laptop, returns nil if the laptop was never rated
+func (store *InMemoryRatingStore) Find(laptopID string) (*Rating, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	rating := store.rating[laptopID]
+	if rating == nil {
+		return nil, nil
+	}
+
+	return rating.Clone(), nil
+}
+
+// TopRated returns at most limit ratings with at least minCount scores, best bayesian average first
+func (store *InMemoryRatingStore) TopRated(limit int, minCount uint32) ([]*RankedRating, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if store.count == 0 {
+		return nil, nil
+	}
+	globalAverage := store.sum / float64(store.count)
+
+	ranked := make([]*RankedRating, 0, len(store.rating))
+	for laptopID, rating := range store.rating {
+		if rating.Count < minCount {
+			continue
+		}
+
+		ranked = append(ranked, &RankedRating{
+			LaptopID:      laptopID,
+			Rating:        rating.Clone(),
+			BayesianScore: bayesianAverage(rating, globalAverage),
+		})
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].BayesianScore != ranked[j].BayesianScore {
+			return ranked[i].BayesianScore > ranked[j].BayesianScore
+		}
+		return ranked[i].LaptopID < ranked[j].LaptopID
+	})
+
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	return ranked, nil
+}
+
+// bayesianAverage pulls the average of the rating towards the global average, the fewer votes the stronger
+func bayesianAverage(rating *Rating, globalAverage float64) float64 {
+	return (bayesianPriorWeight*globalAverage + rating.Sum) / (bayesianPriorWeight + float64(rating.Count))
+}
@@ -0,0 +1,113 @@
+package service_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRatingStoreTopRated(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryRatingStore()
+
+	// a single perfect score must not outrank a long history of good scores
+	_, err := store.Add("lucky", 10)
+	require.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		_, err := store.Add("solid", 9)
+		require.NoError(t, err)
+	}
+	for i := 0; i < 50; i++ {
+		_, err := store.Add("poor", 3)
+		require.NoError(t, err)
+	}
+
+	ranked, err := store.TopRated(0, 0)
+	require.NoError(t, err)
+	require.Len(t, ranked, 3)
+	require.Equal(t, "solid", ranked[0].LaptopID)
+	require.Equal(t, "lucky", ranked[1].LaptopID)
+	require.Equal(t, "poor", ranked[2].LaptopID)
+
+	ranked, err = store.TopRated(1, 2)
+	require.NoError(t, err)
+	require.Len(t, ranked, 1)
+	require.Equal(t, "solid", ranked[0].LaptopID)
+	require.EqualValues(t, 50, ranked[0].Rating.Count)
+}
+
+func TestRatingStoreHistogram(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryRatingStore()
+
+	for _, score := range []float64{1, 7.4, 7.6, 10} {
+		_, err := store.Add("laptop", score)
+		require.NoError(t, err)
+	}
+
+	rating, err := store.Find("laptop")
+	require.NoError(t, err)
+	require.EqualValues(t, 4, rating.Count)
+	require.Equal(t, 1.0, rating.Min)
+	require.Equal(t, 10.0, rating.Max)
+	require.Equal(t, 6.5, rating.Average())
+	require.Equal(t, []uint32{1, 0, 0, 0, 0, 0, 1, 1, 0, 1}, rating.Histogram)
+
+	rating, err = store.Find("unknown")
+	require.NoError(t, err)
+	require.Nil(t, rating)
+}
+
+func TestRatingStoreScoreRange(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryRatingStore()
+
+	for _, score := range []float64{-1, 0, 10.5, 1e9, math.NaN(), math.Inf(1)} {
+		_, err := store.Add("laptop", score)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, service.ErrorInvalidScore))
+	}
+
+	rating, err := store.Find("laptop")
+	require.NoError(t, err)
+	require.Nil(t, rating)
+
+	store, err = service.NewInMemoryRatingStoreWithRange(service.ScoreRange{Min: 0, Max: 5})
+	require.NoError(t, err)
+	_, err = store.Add("laptop", 0)
+	require.NoError(t, err)
+	_, err = store.Add("laptop", 6)
+	require.True(t, errors.Is(err, service.ErrorInvalidScore))
+
+	// the histogram has a bucket per whole score of the range
+	store, err = service.NewInMemoryRatingStoreWithRange(service.ScoreRange{Min: 0, Max: 100})
+	require.NoError(t, err)
+	for _, score := range []float64{0, 42, 99.6, 100} {
+		_, err = store.Add("laptop", score)
+		require.NoError(t, err)
+	}
+	rating, err = store.Find("laptop")
+	require.NoError(t, err)
+	require.Len(t, rating.Histogram, 101)
+	require.EqualValues(t, 1, rating.Histogram[0])
+	require.EqualValues(t, 1, rating.Histogram[42])
+	require.EqualValues(t, 2, rating.Histogram[100])
+
+	for _, scoreRange := range []service.ScoreRange{
+		{Min: 10, Max: 1},
+		{Min: 0, Max: 1000},
+		{Min: -1e300, Max: 1e300},
+		{Min: -math.MaxFloat64, Max: math.MaxFloat64},
+		{Min: math.NaN(), Max: 10},
+		{Min: 1, Max: math.Inf(1)},
+	} {
+		_, err := service.NewInMemoryRatingStoreWithRange(scoreRange)
+		require.Error(t, err, "range %v", scoreRange)
+	}
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxReviewTitleLength = 200
+	maxReviewTextLength  = 5000
+
+	defaultReviewPageSize = 10
+	maxReviewPageSize     = 100
+)
+
+// ReviewServiceServer provides laptop review services
+type ReviewServiceServer struct {
+	laptopStore LaptopStore
+	ratingStore RatingStore
+	reviewStore ReviewStore
+}
+
+// NewReviewServiceServer returns a new ReviewServiceServer
+func NewReviewServiceServer(laptopStore LaptopStore, ratingStore RatingStore, reviewStore ReviewStore) *ReviewServiceServer {
+	return &ReviewServiceServer{
+		laptopStore: laptopStore,
+		ratingStore: ratingStore,
+		reviewStore: reviewStore,
+	}
+}
+
+// AddReview unary RPC that rates a laptop on behalf of the authenticated user and attaches a review to the score
+func (server *ReviewServiceServer) AddReview(ctx context.Context, req *pcbook.AddReviewRequest) (*pcbook.AddReviewResponse, error) {
+	laptopID := req.GetLaptopId()
+	log.Printf("received an AddReview request for laptop: %s", laptopID)
+
+	claims, ok := UserClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "user is not authenticated")
+	}
+
+	if utf8.RuneCountInString(req.GetTitle()) > maxReviewTitleLength {
+		return nil, status.Errorf(codes.InvalidArgument, "review title is too long: max %d characters", maxReviewTitleLength)
+	}
+	if utf8.RuneCountInString(req.GetText()) > maxReviewTextLength {
+		return nil, status.Errorf(codes.InvalidArgument, "review text is too long: max %d characters", maxReviewTextLength)
+	}
+
+	found, err := server.laptopStore.Find(laptopID)
+	if err != nil {
+		log.Printf("cannot find laptop in store: %v", err)
+		return nil, status.Errorf(codes.Internal, "cannot find laptop in store: %v", err)
+	}
+	if found == nil {
+		return nil, status.Errorf(codes.NotFound, "laptopID: %s not found", laptopID)
+	}
+
+	rating, err := server.ratingStore.Add(laptopID, req.GetScore())
+	if err != nil {
+		log.Printf("cannot add rating to the store: %v", err)
+		code := codes.Internal
+		if errors.Is(err, ErrorInvalidScore) {
+			code = codes.InvalidArgument
+		}
+		return nil, status.Errorf(code, "cannot add rating to the store: %v", err)
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate a new review ID: %v", err)
+	}
+
+	review := &pcbook.Review{
+		Id:        id.String(),
+		LaptopId:  laptopID,
+		Username:  claims.Username,
+		Score:     req.GetScore(),
+		Title:     req.GetTitle(),
+		Text:      req.GetText(),
+		CreatedAt: timestamppb.Now(),
+	}
+
+	err = server.reviewStore.Save(review)
+	if err != nil {
+		log.Printf("cannot save review to the store: %v", err)
+		return nil, status.Errorf(codes.Internal, "cannot save review to the store: %v", err)
+	}
+
+	log.Printf("saved review with id: %s", review.Id)
+
+	res := &pcbook.AddReviewResponse{
+		Review: review,
+		Rating: toPbRating(rating),
+	}
+
+	return res, nil
+}
+
+// ListReviews unary RPC that returns a page of visible reviews of a laptop
+func (server *ReviewServiceServer) ListReviews(ctx context.Context, req *pcbook.ListReviewsRequest) (*pcbook.ListReviewsResponse, error) {
+	laptopID := req.GetLaptopId()
+	log.Printf("received a ListReviews request for laptop: %s", laptopID)
+
+	pageSize := int(req.GetPageSize())
+	if pageSize == 0 {
+		pageSize = defaultReviewPageSize
+	}
+	if pageSize > maxReviewPageSize {
+		pageSize = maxReviewPageSize
+	}
+
+	offset := 0
+	if len(req.GetPageToken()) > 0 {
+		var err error
+		offset, err = strconv.Atoi(req.GetPageToken())
+		if err != nil || offset < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "page token is invalid: %s", req.GetPageToken())
+		}
+	}
+
+	reviews, next, err := server.reviewStore.List(laptopID, offset, pageSize)
+	if err != nil {
+		log.Printf("cannot list reviews: %v", err)
+		return nil, status.Errorf(codes.Internal, "cannot list reviews: %v", err)
+	}
+
+	res := &pcbook.ListReviewsResponse{
+		Reviews: reviews,
+	}
+	if next > 0 {
+		res.NextPageToken = strconv.Itoa(next)
+	}
+
+	return res, nil
+}
+
+// HideReview unary RPC that lets moderators hide or show a review
+func (server *ReviewServiceServer) HideReview(ctx context.Context, req *pcbook.HideReviewRequest) (*pcbook.HideReviewResponse, error) {
+	reviewID := req.GetReviewId()
+	log.Printf("received a HideReview request: id = %s, hidden = %t", reviewID, req.GetHidden())
+
+	review, err := server.reviewStore.SetHidden(reviewID, req.GetHidden())
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrorNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot hide review: %v", err)
+	}
+
+	res := &pcbook.HideReviewResponse{
+		Review: review,
+	}
+
+	return res, nil
+}
+
+// DeleteReview unary RPC that lets moderators delete a review, the score stays part of the laptop rating
+func (server *ReviewServiceServer) DeleteReview(ctx context.Context, req *pcbook.DeleteReviewRequest) (*pcbook.DeleteReviewResponse, error) {
+	reviewID := req.GetReviewId()
+	log.Printf("received a DeleteReview request: id = %s", reviewID)
+
+	err := server.reviewStore.Delete(reviewID)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrorNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot delete review: %v", err)
+	}
+
+	return &pcbook.DeleteReviewResponse{}, nil
+}
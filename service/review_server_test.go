@@ -0,0 +1,121 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerAddReview(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	server := service.NewReviewServiceServer(laptopStore, service.NewInMemoryRatingStore(), service.NewInMemoryReviewStore())
+	ctx := service.ContextWithUserClaims(context.Background(), &service.UserClaims{Username: "user1", Role: "user"})
+
+	testCases := []struct {
+		name string
+		ctx  context.Context
+		req  *pcbook.AddReviewRequest
+		code codes.Code
+	}{
+		{
+			name: "success",
+			ctx:  ctx,
+			req:  &pcbook.AddReviewRequest{LaptopId: laptop.GetId(), Score: 9, Title: "great", Text: "fast and light"},
+			code: codes.OK,
+		},
+		{
+			name: "failure_unauthenticated",
+			ctx:  context.Background(),
+			req:  &pcbook.AddReviewRequest{LaptopId: laptop.GetId(), Score: 9},
+			code: codes.Unauthenticated,
+		},
+		{
+			name: "failure_invalid_score",
+			ctx:  ctx,
+			req:  &pcbook.AddReviewRequest{LaptopId: laptop.GetId(), Score: -3},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "failure_laptop_not_found",
+			ctx:  ctx,
+			req:  &pcbook.AddReviewRequest{LaptopId: "unknown", Score: 5},
+			code: codes.NotFound,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := server.AddReview(tc.ctx, tc.req)
+			if tc.code == codes.OK {
+				require.NoError(t, err)
+				require.NotEmpty(t, res.GetReview().GetId())
+				require.Equal(t, "user1", res.GetReview().GetUsername())
+				require.Equal(t, tc.req.GetTitle(), res.GetReview().GetTitle())
+				require.EqualValues(t, 1, res.GetRating().GetTimesRated())
+			} else {
+				require.Nil(t, res)
+				require.Equal(t, tc.code, status.Code(err))
+			}
+		})
+	}
+}
+
+func TestServerListAndModerateReviews(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	server := service.NewReviewServiceServer(laptopStore, service.NewInMemoryRatingStore(), service.NewInMemoryReviewStore())
+	ctx := service.ContextWithUserClaims(context.Background(), &service.UserClaims{Username: "user1", Role: "user"})
+
+	reviewIDs := make([]string, 5)
+	for i := range reviewIDs {
+		res, err := server.AddReview(ctx, &pcbook.AddReviewRequest{LaptopId: laptop.GetId(), Score: 7})
+		require.NoError(t, err)
+		reviewIDs[i] = res.GetReview().GetId()
+	}
+
+	_, err = server.HideReview(ctx, &pcbook.HideReviewRequest{ReviewId: reviewIDs[1], Hidden: true})
+	require.NoError(t, err)
+	_, err = server.DeleteReview(ctx, &pcbook.DeleteReviewRequest{ReviewId: reviewIDs[3]})
+	require.NoError(t, err)
+
+	listed := []string{}
+	req := &pcbook.ListReviewsRequest{LaptopId: laptop.GetId(), PageSize: 2}
+	for {
+		res, err := server.ListReviews(ctx, req)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(res.GetReviews()), 2)
+		for _, review := range res.GetReviews() {
+			listed = append(listed, review.GetId())
+		}
+		if res.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = res.GetNextPageToken()
+	}
+	require.Equal(t, []string{reviewIDs[0], reviewIDs[2], reviewIDs[4]}, listed)
+
+	_, err = server.DeleteReview(ctx, &pcbook.DeleteReviewRequest{ReviewId: reviewIDs[3]})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = server.ListReviews(ctx, &pcbook.ListReviewsRequest{LaptopId: laptop.GetId(), PageToken: "abc"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
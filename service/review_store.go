@@ -0,0 +1,135 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"google.golang.org/protobuf/proto"
+)
+
+// ReviewStore is an interface to store laptop reviews
+type ReviewStore interface {
+	// Save saves the review to the store
+	Save(review *pcbook.Review) error
+
+	// Find finds a review by ID
+	Find(id string) (*pcbook.Review, error)
+
+	// List returns at most limit visible reviews of a laptop starting from offset, oldest first,
+	// next is the offset of the following page or 0 if there are no more reviews
+	List(laptopID string, offset int, limit int) (reviews []*pcbook.Review, next int, err error)
+
+	// SetHidden hides or shows a review, returns ErrorNotFound if there is no such review
+	SetHidden(id string, hidden bool) (*pcbook.Review, error)
+
+	// Delete deletes a review, returns ErrorNotFound if there is no such review
+	Delete(id string) error
+}
+
+// InMemoryReviewStore stores reviews in memory
+type InMemoryReviewStore struct {
+	mutex    sync.RWMutex
+	data     map[string]*pcbook.Review
+	byLaptop map[string][]string
+}
+
+// NewInMemoryReviewStore returns a new InMemoryReviewStore
+func NewInMemoryReviewStore() *InMemoryReviewStore {
+	return &InMemoryReviewStore{
+		data:     make(map[string]*pcbook.Review),
+		byLaptop: make(map[string][]string),
+	}
+}
+
+// Save saves the review to the store
+func (store *InMemoryReviewStore) Save(review *pcbook.Review) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.data[review.Id] != nil {
+		return ErrorAlreadyExists
+	}
+
+	store.data[review.Id] = proto.Clone(review).(*pcbook.Review)
+	store.byLaptop[review.LaptopId] = append(store.byLaptop[review.LaptopId], review.Id)
+
+	return nil
+}
+
+// Find finds a review by ID
+func (store *InMemoryReviewStore) Find(id string) (*pcbook.Review, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	review := store.data[id]
+	if review == nil {
+		return nil, nil
+	}
+
+	return proto.Clone(review).(*pcbook.Review), nil
+}
+
+// List returns at most limit visible reviews of a laptop starting from offset, oldest first
+func (store *InMemoryReviewStore) List(laptopID string, offset int, limit int) ([]*pcbook.Review, int, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	reviews := make([]*pcbook.Review, 0, limit)
+	visible := 0
+
+	for _, id := range store.byLaptop[laptopID] {
+		review := store.data[id]
+		if review.Hidden {
+			continue
+		}
+
+		visible++
+		if visible <= offset {
+			continue
+		}
+		if len(reviews) == limit {
+			// there is at least one more review after this page
+			return reviews, offset + limit, nil
+		}
+
+		reviews = append(reviews, proto.Clone(review).(*pcbook.Review))
+	}
+
+	return reviews, 0, nil
+}
+
+// SetHidden hides or shows a review
+func (store *InMemoryReviewStore) SetHidden(id string, hidden bool) (*pcbook.Review, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	review := store.data[id]
+	if review == nil {
+		return nil, ErrorNotFound
+	}
+
+	review.Hidden = hidden
+	return proto.Clone(review).(*pcbook.Review), nil
+}
+
+// Delete deletes a review
+func (store *InMemoryReviewStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	review := store.data[id]
+	if review == nil {
+		return ErrorNotFound
+	}
+
+	ids := store.byLaptop[review.LaptopId]
+	for i := range ids {
+		if ids[i] == id {
+			store.byLaptop[review.LaptopId] = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	delete(store.data, id)
+
+	return nil
+}
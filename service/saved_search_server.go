@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// SavedSearchServiceServer provides saved search services, every search is owned by the authenticated user
+type SavedSearchServiceServer struct {
+	laptopStore      LaptopStore
+	savedSearchStore SavedSearchStore
+
+	// mutex orders the subscriptions and the deletions of searches
+	mutex sync.Mutex
+	// deleted holds a channel per subscribed search, closed when the search is deleted to end its subscriptions
+	deleted map[string]chan struct{}
+}
+
+// NewSavedSearchServiceServer returns a new SavedSearchServiceServer
+func NewSavedSearchServiceServer(laptopStore LaptopStore, savedSearchStore SavedSearchStore) *SavedSearchServiceServer {
+	return &SavedSearchServiceServer{
+		laptopStore:      laptopStore,
+		savedSearchStore: savedSearchStore,
+		deleted:          make(map[string]chan struct{}),
+	}
+}
+
+// CreateSavedSearch unary RPC that saves a named filter for the authenticated user
+func (server *SavedSearchServiceServer) CreateSavedSearch(ctx context.Context, req *pcbook.CreateSavedSearchRequest) (*pcbook.CreateSavedSearchResponse, error) {
+	claims, ok := UserClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "user is not authenticated")
+	}
+	log.Printf("received a CreateSavedSearch request from %s with name: %q", claims.Username, req.GetName())
+
+	if len(req.GetName()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "saved search name is required")
+	}
+	if req.GetFilter() == nil {
+		return nil, status.Error(codes.InvalidArgument, "saved search filter is required")
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate a new saved search ID: %v", err)
+	}
+
+	search := &pcbook.SavedSearch{
+		Id:        id.String(),
+		Username:  claims.Username,
+		Name:      req.GetName(),
+		Filter:    req.GetFilter(),
+		CreatedAt: timestamppb.Now(),
+	}
+
+	err = server.savedSearchStore.Save(search)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot save search to the store: %v", err)
+	}
+
+	log.Printf("saved search with id: %s", search.Id)
+
+	res := &pcbook.CreateSavedSearchResponse{
+		SavedSearch: search,
+	}
+
+	return res, nil
+}
+
+// ListSavedSearches unary RPC that returns the searches saved by the authenticated user
+func (server *SavedSearchServiceServer) ListSavedSearches(ctx context.Context, req *pcbook.ListSavedSearchesRequest) (*pcbook.ListSavedSearchesResponse, error) {
+	claims, ok := UserClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "user is not authenticated")
+	}
+	log.Printf("received a ListSavedSearches request from %s", claims.Username)
+
+	searches, err := server.savedSearchStore.List(claims.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list saved searches: %v", err)
+	}
+
+	res := &pcbook.ListSavedSearchesResponse{
+		SavedSearches: searches,
+	}
+
+	return res, nil
+}
+
+// DeleteSavedSearch unary RPC that deletes a search saved by the authenticated user
+func (server *SavedSearchServiceServer) DeleteSavedSearch(ctx context.Context, req *pcbook.DeleteSavedSearchRequest) (*pcbook.DeleteSavedSearchResponse, error) {
+	search, err := server.findOwnSearch(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("received a DeleteSavedSearch request from %s for search: %s", search.Username, search.Id)
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	err = server.savedSearchStore.Delete(search.Id)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrorNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot delete saved search: %v", err)
+	}
+
+	if deleted := server.deleted[search.Id]; deleted != nil {
+		close(deleted)
+		delete(server.deleted, search.Id)
+	}
+
+	return &pcbook.DeleteSavedSearchResponse{}, nil
+}
+
+// SubscribeSavedSearch server stream that sends the newly created or repriced laptops matching a saved search,
+// until the search is deleted
+func (server *SavedSearchServiceServer) SubscribeSavedSearch(req *pcbook.SubscribeSavedSearchRequest, stream pcbook.SavedSearchService_SubscribeSavedSearchServer) error {
+	search, deleted, err := server.subscribe(stream.Context(), req.GetId())
+	if err != nil {
+		return err
+	}
+	log.Printf("received a SubscribeSavedSearch request from %s for search: %s", search.Username, search.Id)
+
+	var afterSequence uint64
+	if len(req.GetResumeToken()) > 0 {
+		afterSequence, err = strconv.ParseUint(req.GetResumeToken(), 10, 64)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "resume token is invalid: %s", req.GetResumeToken())
+		}
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-deleted:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// as for RecommendSimilar, a max price which is not set does not limit the price
+	filter := withoutPriceLimit(search.Filter)
+	err = server.laptopStore.Watch(ctx, afterSequence, func(event *LaptopEvent) error {
+		reason := savedSearchReason(event)
+		if reason == pcbook.SubscribeSavedSearchResponse_UNKNOWN || !isMatchFilter(filter, event.Laptop) {
+			return nil
+		}
+
+		res := &pcbook.SubscribeSavedSearchResponse{
+			SavedSearchId: search.Id,
+			Reason:        reason,
+			Laptop:        event.Laptop,
+			ResumeToken:   strconv.FormatUint(event.Sequence, 10),
+		}
+
+		err := stream.Send(res)
+		if err != nil {
+			return err
+		}
+		log.Printf("sent saved search %s match: %s", search.Id, event.Laptop.GetId())
+		return nil
+	})
+
+	select {
+	case <-deleted:
+		return status.Errorf(codes.NotFound, "saved search: %s was deleted", search.Id)
+	default:
+	}
+	if err := contextError(stream.Context()); err != nil {
+		return err
+	}
+	if errors.Is(err, ErrorInvalidSequence) {
+		return status.Errorf(codes.OutOfRange, "cannot resume saved search subscription: %v", err)
+	}
+	if errors.Is(err, ErrorWatcherTooSlow) {
+		return watcherTooSlowError(err)
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "unexpected error: %v", err)
+	}
+
+	return nil
+}
+
+// subscribe finds a saved search of the authenticated user and returns a channel closed when the search is deleted
+func (server *SavedSearchServiceServer) subscribe(ctx context.Context, id string) (*pcbook.SavedSearch, <-chan struct{}, error) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	search, err := server.findOwnSearch(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deleted := server.deleted[search.Id]
+	if deleted == nil {
+		deleted = make(chan struct{})
+		server.deleted[search.Id] = deleted
+	}
+	return search, deleted, nil
+}
+
+// findOwnSearch finds a saved search of the authenticated user, searches of other users are reported as not found
+func (server *SavedSearchServiceServer) findOwnSearch(ctx context.Context, id string) (*pcbook.SavedSearch, error) {
+	claims, ok := UserClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "user is not authenticated")
+	}
+
+	search, err := server.savedSearchStore.Find(id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find saved search: %v", err)
+	}
+	if search == nil || search.Username != claims.Username {
+		return nil, status.Errorf(codes.NotFound, "saved search: %s not found", id)
+	}
+
+	return search, nil
+}
+
+// savedSearchReason tells why a laptop event is a new match, UNKNOWN if it is not relevant to saved searches
+func savedSearchReason(event *LaptopEvent) pcbook.SubscribeSavedSearchResponse_Reason {
+	switch event.Type {
+	case LaptopCreated:
+		return pcbook.SubscribeSavedSearchResponse_CREATED
+	case LaptopUpdated:
+		if event.Previous.GetPriceUsd() != event.Laptop.GetPriceUsd() {
+			return pcbook.SubscribeSavedSearchResponse_REPRICED
+		}
+	}
+	return pcbook.SubscribeSavedSearchResponse_UNKNOWN
+}
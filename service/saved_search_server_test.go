@@ -0,0 +1,188 @@
+package service_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerSavedSearchOwnership(t *testing.T) {
+	t.Parallel()
+
+	server := service.NewSavedSearchServiceServer(service.NewInMemoryLaptopStore(), service.NewInMemorySavedSearchStore())
+	alice := service.ContextWithUserClaims(context.Background(), &service.UserClaims{Username: "alice", Role: "user"})
+	bob := service.ContextWithUserClaims(context.Background(), &service.UserClaims{Username: "bob", Role: "user"})
+
+	_, err := server.CreateSavedSearch(alice, &pcbook.CreateSavedSearchRequest{Name: "no filter"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.CreateSavedSearch(context.Background(), &pcbook.CreateSavedSearchRequest{Name: "anonymous", Filter: &pcbook.Filter{}})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	created, err := server.CreateSavedSearch(alice, &pcbook.CreateSavedSearchRequest{
+		Name:   "cheap",
+		Filter: &pcbook.Filter{MaxPriceUsd: 1000},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "alice", created.GetSavedSearch().GetUsername())
+
+	list, err := server.ListSavedSearches(alice, &pcbook.ListSavedSearchesRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetSavedSearches(), 1)
+
+	list, err = server.ListSavedSearches(bob, &pcbook.ListSavedSearchesRequest{})
+	require.NoError(t, err)
+	require.Empty(t, list.GetSavedSearches())
+
+	_, err = server.DeleteSavedSearch(bob, &pcbook.DeleteSavedSearchRequest{Id: created.GetSavedSearch().GetId()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = server.DeleteSavedSearch(alice, &pcbook.DeleteSavedSearchRequest{Id: created.GetSavedSearch().GetId()})
+	require.NoError(t, err)
+}
+
+func TestClientSubscribeSavedSearch(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	savedSearchStore := service.NewInMemorySavedSearchStore()
+
+	err := laptopStore.Save(sample.NewLaptop())
+	require.NoError(t, err)
+
+	laptop := sample.NewLaptop()
+	laptop.PriceUsd = 1800
+	err = laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	laptop.PriceUsd = 1700
+	err = laptopStore.Update(laptop)
+	require.NoError(t, err)
+
+	laptop.Name = "renamed"
+	err = laptopStore.Update(laptop)
+	require.NoError(t, err)
+
+	expensive := sample.NewLaptop()
+	expensive.PriceUsd = 2500
+	err = laptopStore.Save(expensive)
+	require.NoError(t, err)
+
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	savedSearchServer := service.NewSavedSearchServiceServer(laptopStore, savedSearchStore)
+	interceptor := service.NewAuthInterceptor(jwtManager, map[string][]string{
+		"/pcbook.SavedSearchService/CreateSavedSearch":    {"user"},
+		"/pcbook.SavedSearchService/DeleteSavedSearch":    {"user"},
+		"/pcbook.SavedSearchService/SubscribeSavedSearch": {"user"},
+	})
+
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(interceptor.Unary()),
+		grpc.StreamInterceptor(interceptor.Stream()),
+	)
+	pcbook.RegisterSavedSearchServiceServer(grpcServer, savedSearchServer)
+
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	savedSearchClient := pcbook.NewSavedSearchServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	aliceCtx := metadata.AppendToOutgoingContext(ctx, "authorization", newTestAccessToken(t, jwtManager, "alice"))
+	bobCtx := metadata.AppendToOutgoingContext(ctx, "authorization", newTestAccessToken(t, jwtManager, "bob"))
+
+	created, err := savedSearchClient.CreateSavedSearch(aliceCtx, &pcbook.CreateSavedSearchRequest{
+		Name:   "under 2000",
+		Filter: &pcbook.Filter{MaxPriceUsd: 2000},
+	})
+	require.NoError(t, err)
+	searchID := created.GetSavedSearch().GetId()
+
+	// resume after the first laptop so the earlier changes are replayed deterministically
+	stream, err := savedSearchClient.SubscribeSavedSearch(aliceCtx, &pcbook.SubscribeSavedSearchRequest{Id: searchID, ResumeToken: "1"})
+	require.NoError(t, err)
+
+	expectedReasons := []pcbook.SubscribeSavedSearchResponse_Reason{
+		pcbook.SubscribeSavedSearchResponse_CREATED,
+		pcbook.SubscribeSavedSearchResponse_REPRICED,
+	}
+	for _, reason := range expectedReasons {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, searchID, res.GetSavedSearchId())
+		require.Equal(t, reason, res.GetReason())
+		require.Equal(t, laptop.GetId(), res.GetLaptop().GetId())
+	}
+
+	live := sample.NewLaptop()
+	live.PriceUsd = 1200
+	err = laptopStore.Save(live)
+	require.NoError(t, err)
+
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, live.GetId(), res.GetLaptop().GetId())
+
+	// a filter without a max price does not limit the price
+	anyPrice, err := savedSearchClient.CreateSavedSearch(aliceCtx, &pcbook.CreateSavedSearchRequest{
+		Name:   "any price",
+		Filter: &pcbook.Filter{MinCpuCores: 1},
+	})
+	require.NoError(t, err)
+	anyPriceStream, err := savedSearchClient.SubscribeSavedSearch(aliceCtx, &pcbook.SubscribeSavedSearchRequest{
+		Id:          anyPrice.GetSavedSearch().GetId(),
+		ResumeToken: res.GetResumeToken(),
+	})
+	require.NoError(t, err)
+
+	pricey := sample.NewLaptop()
+	pricey.PriceUsd = 2500
+	err = laptopStore.Save(pricey)
+	require.NoError(t, err)
+
+	res, err = anyPriceStream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, pricey.GetId(), res.GetLaptop().GetId())
+
+	bobStream, err := savedSearchClient.SubscribeSavedSearch(bobCtx, &pcbook.SubscribeSavedSearchRequest{Id: searchID})
+	require.NoError(t, err)
+	_, err = bobStream.Recv()
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// deleting the search ends its subscription
+	_, err = savedSearchClient.DeleteSavedSearch(aliceCtx, &pcbook.DeleteSavedSearchRequest{Id: searchID})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	stream, err = savedSearchClient.SubscribeSavedSearch(aliceCtx, &pcbook.SubscribeSavedSearchRequest{Id: searchID})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func newTestAccessToken(t *testing.T, jwtManager *service.JWTManager, username string) string {
+	user, err := service.NewUser(username, "password", "user")
+	require.NoError(t, err)
+
+	token, err := jwtManager.Generate(user)
+	require.NoError(t, err)
+
+	return token
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"google.golang.org/protobuf/proto"
+)
+
+// SavedSearchStore is an interface to store the users' saved searches
+type SavedSearchStore interface {
+	// Save saves the search to the store
+	Save(search *pcbook.SavedSearch) error
+
+	// Find finds a saved search by ID
+	Find(id string) (*pcbook.SavedSearch, error)
+
+	// List returns the searches saved by a user, oldest first
+	List(username string) ([]*pcbook.SavedSearch, error)
+
+	// Delete deletes a saved search by ID, returns ErrorNotFound if there is no such search
+	Delete(id string) error
+}
+
+// InMemorySavedSearchStore stores saved searches in memory
+type InMemorySavedSearchStore struct {
+	mutex sync.RWMutex
+	data  map[string]*pcbook.SavedSearch
+}
+
+// NewInMemorySavedSearchStore returns a new InMemorySavedSearchStore
+func NewInMemorySavedSearchStore() *InMemorySavedSearchStore {
+	return &InMemorySavedSearchStore{
+		data: make(map[string]*pcbook.SavedSearch),
+	}
+}
+
+// Save saves the search to the store
+func (store *InMemorySavedSearchStore) Save(search *pcbook.SavedSearch) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.data[search.Id] != nil {
+		return ErrorAlreadyExists
+	}
+
+	store.data[search.Id] = proto.Clone(search).(*pcbook.SavedSearch)
+	return nil
+}
+
+// Find finds a saved search by ID
+func (store *InMemorySavedSearchStore) Find(id string) (*pcbook.SavedSearch, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	search := store.data[id]
+	if search == nil {
+		return nil, nil
+	}
+
+	return proto.Clone(search).(*pcbook.SavedSearch), nil
+}
+
+// List returns the searches saved by a user, oldest first
+func (store *InMemorySavedSearchStore) List(username string) ([]*pcbook.SavedSearch, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	searches := []*pcbook.SavedSearch{}
+	for _, search := range store.data {
+		if search.Username == username {
+			searches = append(searches, proto.Clone(search).(*pcbook.SavedSearch))
+		}
+	}
+
+	sort.Slice(searches, func(i, j int) bool {
+		return searches[i].GetCreatedAt().AsTime().Before(searches[j].GetCreatedAt().AsTime())
+	})
+
+	return searches, nil
+}
+
+// Delete deletes a saved search by ID
+func (store *InMemorySavedSearchStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.data[id] == nil {
+		return ErrorNotFound
+	}
+
+	delete(store.data, id)
+	return nil
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/serializer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// headers set on every webhook request
+const (
+	WebhookEventHeader     = "X-Pcbook-Event"
+	WebhookDeliveryHeader  = "X-Pcbook-Delivery"
+	WebhookSignatureHeader = "X-Pcbook-Signature"
+)
+
+// WebhookRetryPolicy configures how failed webhook deliveries are retried
+type WebhookRetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+}
+
+// DefaultWebhookRetryPolicy tries a delivery 5 times, waiting 1s, 2s, 4s and 8s in between
+var DefaultWebhookRetryPolicy = WebhookRetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Timeout:        10 * time.Second,
+}
+
+// webhookQueueSize is the maximum number of events waiting to be delivered to a webhook, newer events are dropped
+const webhookQueueSize = 1000
+
+// WebhookDispatcher sends catalog events to the registered webhooks
+type WebhookDispatcher struct {
+	webhookStore WebhookStore
+	laptopStore  LaptopStore
+	retryPolicy  WebhookRetryPolicy
+	httpClient   *http.Client
+
+	// ctx is canceled by Close to stop the deliveries
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex sync.Mutex
+	// queues are the pending deliveries by webhook ID, each queue has a worker delivering them in order
+	queues  map[string]chan webhookDelivery
+	workers sync.WaitGroup
+}
+
+// webhookDelivery is an event to deliver to a webhook
+type webhookDelivery struct {
+	webhook *pcbook.Webhook
+	event   *pcbook.WebhookEvent
+	payload []byte
+}
+
+// NewWebhookDispatcher returns a new WebhookDispatcher
+func NewWebhookDispatcher(webhookStore WebhookStore, laptopStore LaptopStore, retryPolicy WebhookRetryPolicy) *WebhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookDispatcher{
+		webhookStore: webhookStore,
+		laptopStore:  laptopStore,
+		retryPolicy:  retryPolicy,
+		httpClient: &http.Client{
+			Timeout: retryPolicy.Timeout,
+		},
+		ctx:    ctx,
+		cancel: cancel,
+		queues: make(map[string]chan webhookDelivery),
+	}
+}
+
+// Close stops the deliveries, including the ones waiting to be retried, and waits for them to return.
+// The events published afterwards are dropped
+func (dispatcher *WebhookDispatcher) Close() {
+	dispatcher.mutex.Lock()
+	dispatcher.cancel()
+	dispatcher.mutex.Unlock()
+
+	dispatcher.workers.Wait()
+}
+
+// Run watches the laptop store and dispatches the created and repriced laptops until the context is done,
+// and then closes the dispatcher
+func (dispatcher *WebhookDispatcher) Run(ctx context.Context) error {
+	var lastSequence uint64
+
+	for {
+		err := dispatcher.laptopStore.Watch(ctx, lastSequence, func(event *LaptopEvent) error {
+			lastSequence = event.Sequence
+
+			switch {
+			case event.Type == LaptopCreated:
+				dispatcher.Publish(pcbook.WebhookEventType_LAPTOP_CREATED, event.Laptop, nil, "")
+			case event.Type == LaptopUpdated && event.Previous.GetPriceUsd() != event.Laptop.GetPriceUsd():
+				dispatcher.Publish(pcbook.WebhookEventType_LAPTOP_REPRICED, event.Laptop, nil, "")
+			}
+			return nil
+		})
+
+		switch {
+		case ctx.Err() != nil:
+			dispatcher.Close()
+			return ctx.Err()
+		case errors.Is(err, ErrorWatcherTooSlow):
+			log.Printf("webhook dispatcher fell behind, resuming after event %d", lastSequence)
+		case errors.Is(err, ErrorInvalidSequence):
+			log.Printf("webhook dispatcher cannot resume after event %d, events are lost", lastSequence)
+			lastSequence = 0
+		default:
+			return err
+		}
+	}
+}
+
+// Publish sends an event to every webhook subscribed to its type, deliveries are queued and made in the background
+func (dispatcher *WebhookDispatcher) Publish(eventType pcbook.WebhookEventType, laptop *pcbook.Laptop, rating *Rating, imageID string) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		log.Printf("cannot generate webhook event ID: %v", err)
+		return
+	}
+
+	event := &pcbook.WebhookEvent{
+		Id:         id.String(),
+		EventType:  eventType,
+		OccurredAt: timestamppb.Now(),
+		Laptop:     laptop,
+		ImageId:    imageID,
+	}
+	if rating != nil {
+		event.Rating = toPbRating(rating)
+	}
+
+	payload, err := serializer.ProtobufToJSON(event)
+	if err != nil {
+		log.Printf("cannot marshal webhook event: %v", err)
+		return
+	}
+
+	webhooks, err := dispatcher.webhookStore.List()
+	if err != nil {
+		log.Printf("cannot list webhooks: %v", err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if isSubscribedWebhook(webhook, eventType) {
+			dispatcher.enqueue(webhookDelivery{webhook: webhook, event: event, payload: []byte(payload)})
+		}
+	}
+}
+
+// enqueue queues a delivery, starting the worker of the webhook if it has none
+func (dispatcher *WebhookDispatcher) enqueue(delivery webhookDelivery) {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+
+	if dispatcher.ctx.Err() != nil {
+		log.Printf("webhook dispatcher is closed, dropping event %s", delivery.event.Id)
+		return
+	}
+
+	queue, ok := dispatcher.queues[delivery.webhook.Id]
+	if !ok {
+		queue = make(chan webhookDelivery, webhookQueueSize)
+		dispatcher.queues[delivery.webhook.Id] = queue
+		dispatcher.workers.Add(1)
+		go dispatcher.work(delivery.webhook.Id, queue)
+	}
+
+	select {
+	case queue <- delivery:
+	default:
+		log.Printf("too many pending events for webhook %s, dropping event %s", delivery.webhook.Id, delivery.event.Id)
+	}
+}
+
+// work delivers the queued events of a webhook in order until its queue is empty or the dispatcher is closed
+func (dispatcher *WebhookDispatcher) work(webhookID string, queue chan webhookDelivery) {
+	defer dispatcher.workers.Done()
+
+	for {
+		dispatcher.mutex.Lock()
+		if len(queue) == 0 || dispatcher.ctx.Err() != nil {
+			delete(dispatcher.queues, webhookID)
+			dispatcher.mutex.Unlock()
+			return
+		}
+		dispatcher.mutex.Unlock()
+
+		// the queue is only read by this worker, so it does not block
+		delivery := <-queue
+		dispatcher.deliver(dispatcher.ctx, delivery.webhook, delivery.event, delivery.payload)
+	}
+}
+
+// deliver posts the payload to the webhook, retrying with exponential backoff until it is accepted or the context is done
+func (dispatcher *WebhookDispatcher) deliver(ctx context.Context, webhook *pcbook.Webhook, event *pcbook.WebhookEvent, payload []byte) {
+	backoff := dispatcher.retryPolicy.InitialBackoff
+
+	for attempt := 1; attempt <= dispatcher.retryPolicy.MaxAttempts; attempt++ {
+		statusCode, err := dispatcher.post(ctx, webhook, event, payload)
+		if ctx.Err() != nil {
+			log.Printf("stop delivering event %s to webhook %s: %v", event.Id, webhook.Id, ctx.Err())
+			return
+		}
+
+		delivery := &pcbook.WebhookDelivery{
+			WebhookId:   webhook.Id,
+			EventId:     event.Id,
+			EventType:   event.EventType,
+			Attempt:     uint32(attempt),
+			StatusCode:  int32(statusCode),
+			Success:     err == nil,
+			DeliveredAt: timestamppb.Now(),
+		}
+		if id, err := uuid.NewRandom(); err == nil {
+			delivery.Id = id.String()
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+
+		if err := dispatcher.webhookStore.AddDelivery(delivery); err != nil {
+			log.Printf("stop delivering event %s to webhook %s: %v", event.Id, webhook.Id, err)
+			return
+		}
+
+		if err == nil {
+			log.Printf("delivered event %s to webhook %s", event.Id, webhook.Id)
+			return
+		}
+		if !isRetryableWebhookStatus(statusCode) {
+			log.Printf("webhook %s rejected event %s: %v", webhook.Id, event.Id, err)
+			return
+		}
+
+		log.Printf("cannot deliver event %s to webhook %s, attempt %d: %v", event.Id, webhook.Id, attempt, err)
+		if attempt < dispatcher.retryPolicy.MaxAttempts {
+			select {
+			case <-ctx.Done():
+				log.Printf("stop delivering event %s to webhook %s: %v", event.Id, webhook.Id, ctx.Err())
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > dispatcher.retryPolicy.MaxBackoff {
+				backoff = dispatcher.retryPolicy.MaxBackoff
+			}
+		}
+	}
+}
+
+// post sends a single delivery attempt and returns the response status code, 0 if there was no response
+func (dispatcher *WebhookDispatcher) post(ctx context.Context, webhook *pcbook.Webhook, event *pcbook.WebhookEvent, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("cannot create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, event.EventType.String())
+	req.Header.Set(WebhookDeliveryHeader, event.Id)
+	if len(webhook.Secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, payload))
+	}
+
+	res, err := dispatcher.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected response status: %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+// SignWebhookPayload returns the signature of a payload as sent in the X-Pcbook-Signature header
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WrapRatingStore returns a rating store publishing a LAPTOP_RATED event for every added score
+func (dispatcher *WebhookDispatcher) WrapRatingStore(store RatingStore) RatingStore {
+	return &webhookRatingStore{
+		RatingStore: store,
+		dispatcher:  dispatcher,
+	}
+}
+
+// WrapImageStore returns an image store publishing a LAPTOP_IMAGE_UPLOADED event for every saved image
+func (dispatcher *WebhookDispatcher) WrapImageStore(store ImageStore) ImageStore {
+	return &webhookImageStore{
+		ImageStore: store,
+		dispatcher: dispatcher,
+	}
+}
+
+type webhookRatingStore struct {
+	RatingStore
+	dispatcher *WebhookDispatcher
+}
+
+// Add adds a new laptop score to the store and publishes the new rating
+func (store *webhookRatingStore) Add(laptopID string, score float64) (*Rating, error) {
+	rating, err := store.RatingStore.Add(laptopID, score)
+	if err != nil {
+		return nil, err
+	}
+
+	store.dispatcher.publishForLaptop(pcbook.WebhookEventType_LAPTOP_RATED, laptopID, rating, "")
+	return rating, nil
+}
+
+type webhookImageStore struct {
+	ImageStore
+	dispatcher *WebhookDispatcher
+}
+
+// Save saves the image to the store and publishes its ID
+func (store *webhookImageStore) Save(laptopID string, imageType string, imageData bytes.Buffer) (string, error) {
+	imageID, err := store.ImageStore.Save(laptopID, imageType, imageData)
+	if err != nil {
+		return "", err
+	}
+
+	store.dispatcher.publishForLaptop(pcbook.WebhookEventType_LAPTOP_IMAGE_UPLOADED, laptopID, nil, imageID)
+	return imageID, nil
+}
+
+func (dispatcher *WebhookDispatcher) publishForLaptop(eventType pcbook.WebhookEventType, laptopID string, rating *Rating, imageID string) {
+	laptop, err := dispatcher.laptopStore.Find(laptopID)
+	if err != nil || laptop == nil {
+		log.Printf("cannot find laptop %s for webhook event: %v", laptopID, err)
+		return
+	}
+
+	dispatcher.Publish(eventType, laptop, rating, imageID)
+}
+
+func isSubscribedWebhook(webhook *pcbook.Webhook, eventType pcbook.WebhookEventType) bool {
+	for _, subscribed := range webhook.EventTypes {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableWebhookStatus tells if a failed delivery may succeed later: no response, throttling or server errors
+func isRetryableWebhookStatus(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
@@ -0,0 +1,232 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"github.com/mikhail-bigun/grpc-app-pcbook/sample"
+	"github.com/mikhail-bigun/grpc-app-pcbook/service"
+	"github.com/stretchr/testify/require"
+)
+
+// testWebhookReceiver passes the received events, or the errors of invalid requests, to the test goroutine
+type testWebhookReceiver struct {
+	mutex    sync.Mutex
+	failures int
+	received chan map[string]interface{}
+	errors   chan error
+	secret   string
+}
+
+func newTestWebhookReceiver(failures int, secret string) *testWebhookReceiver {
+	return &testWebhookReceiver{
+		failures: failures,
+		received: make(chan map[string]interface{}, 100),
+		errors:   make(chan error, 100),
+		secret:   secret,
+	}
+}
+
+func (receiver *testWebhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	statusCode, err := receiver.receive(r)
+	if err != nil {
+		receiver.errors <- err
+	}
+	w.WriteHeader(statusCode)
+}
+
+// receive returns the status code of the response, failing with 503 while there are failures left
+func (receiver *testWebhookReceiver) receive(r *http.Request) (int, error) {
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	signature := r.Header.Get(service.WebhookSignatureHeader)
+	if len(receiver.secret) > 0 && signature != service.SignWebhookPayload(receiver.secret, payload) {
+		return http.StatusBadRequest, fmt.Errorf("invalid signature %q", signature)
+	}
+	if len(receiver.secret) == 0 && len(signature) > 0 {
+		return http.StatusBadRequest, fmt.Errorf("unexpected signature %q", signature)
+	}
+
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+	if receiver.failures > 0 {
+		receiver.failures--
+		return http.StatusServiceUnavailable, nil
+	}
+
+	event := map[string]interface{}{}
+	err = json.Unmarshal(payload, &event)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	receiver.received <- event
+	return http.StatusOK, nil
+}
+
+// next returns the next received event, failing on an invalid request
+func (receiver *testWebhookReceiver) next(t *testing.T) map[string]interface{} {
+	select {
+	case event := <-receiver.received:
+		return event
+	case err := <-receiver.errors:
+		require.FailNow(t, "invalid webhook request", err.Error())
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "webhook was not delivered")
+	}
+	return nil
+}
+
+func TestWebhookDispatcherRetries(t *testing.T) {
+	t.Parallel()
+
+	receiver := newTestWebhookReceiver(2, "top-secret")
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	webhookStore := service.NewInMemoryWebhookStore()
+	webhookServer := service.NewWebhookServiceServer(webhookStore)
+	dispatcher := service.NewWebhookDispatcher(webhookStore, laptopStore, service.WebhookRetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Timeout:        time.Second,
+	})
+	defer dispatcher.Close()
+
+	res, err := webhookServer.RegisterWebhook(context.Background(), &pcbook.RegisterWebhookRequest{
+		Url:        receiverServer.URL,
+		EventTypes: []pcbook.WebhookEventType{pcbook.WebhookEventType_LAPTOP_RATED},
+		Secret:     receiver.secret,
+	})
+	require.NoError(t, err)
+	require.Empty(t, res.GetWebhook().GetSecret())
+
+	laptop := sample.NewLaptop()
+	err = laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	ratingStore := dispatcher.WrapRatingStore(service.NewInMemoryRatingStore())
+	_, err = ratingStore.Add(laptop.GetId(), 8)
+	require.NoError(t, err)
+
+	event := receiver.next(t)
+	require.Equal(t, "LAPTOP_RATED", event["event_type"])
+	require.Equal(t, laptop.GetId(), event["laptop"].(map[string]interface{})["id"])
+
+	require.Eventually(t, func() bool {
+		deliveries, err := webhookServer.ListWebhookDeliveries(context.Background(), &pcbook.ListWebhookDeliveriesRequest{
+			WebhookId: res.GetWebhook().GetId(),
+		})
+		require.NoError(t, err)
+		return len(deliveries.GetDeliveries()) == 3 && deliveries.GetDeliveries()[2].GetSuccess()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWebhookDispatcherLaptopEvents(t *testing.T) {
+	t.Parallel()
+
+	receiver := newTestWebhookReceiver(0, "")
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	webhookStore := service.NewInMemoryWebhookStore()
+	webhookServer := service.NewWebhookServiceServer(webhookStore)
+	dispatcher := service.NewWebhookDispatcher(webhookStore, laptopStore, service.DefaultWebhookRetryPolicy)
+
+	_, err := webhookServer.RegisterWebhook(context.Background(), &pcbook.RegisterWebhookRequest{
+		Url:        receiverServer.URL,
+		EventTypes: []pcbook.WebhookEventType{pcbook.WebhookEventType_LAPTOP_REPRICED},
+	})
+	require.NoError(t, err)
+
+	_, err = webhookServer.RegisterWebhook(context.Background(), &pcbook.RegisterWebhookRequest{Url: "ftp://example.com"})
+	require.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	laptop := sample.NewLaptop()
+	err = laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	// the dispatcher only sees the changes made after it started watching
+	require.Eventually(t, func() bool {
+		laptop.PriceUsd++
+		require.NoError(t, laptopStore.Update(laptop))
+		return len(receiver.received) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	event := receiver.next(t)
+	require.Equal(t, "LAPTOP_REPRICED", event["event_type"])
+}
+
+func TestWebhookDispatcherCloseStopsRetries(t *testing.T) {
+	t.Parallel()
+
+	receiver := newTestWebhookReceiver(1000, "")
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	webhookStore := service.NewInMemoryWebhookStore()
+	webhookServer := service.NewWebhookServiceServer(webhookStore)
+	dispatcher := service.NewWebhookDispatcher(webhookStore, laptopStore, service.WebhookRetryPolicy{
+		MaxAttempts:    1000,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		Timeout:        time.Second,
+	})
+
+	res, err := webhookServer.RegisterWebhook(context.Background(), &pcbook.RegisterWebhookRequest{
+		Url:        receiverServer.URL,
+		EventTypes: []pcbook.WebhookEventType{pcbook.WebhookEventType_LAPTOP_CREATED},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- dispatcher.Run(ctx)
+	}()
+
+	countDeliveries := func() int {
+		deliveries, err := webhookServer.ListWebhookDeliveries(context.Background(), &pcbook.ListWebhookDeliveriesRequest{
+			WebhookId: res.GetWebhook().GetId(),
+		})
+		require.NoError(t, err)
+		return len(deliveries.GetDeliveries())
+	}
+
+	// every attempt fails, so the delivery keeps being retried
+	require.Eventually(t, func() bool {
+		require.NoError(t, laptopStore.Save(sample.NewLaptop()))
+		return countDeliveries() > 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "dispatcher did not stop")
+	}
+
+	count := countDeliveries()
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, count, countDeliveries(), "deliveries were retried after the dispatcher stopped")
+	require.Empty(t, receiver.errors)
+}
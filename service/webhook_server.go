@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// WebhookServiceServer provides the admin services to manage webhooks
+type WebhookServiceServer struct {
+	webhookStore WebhookStore
+}
+
+// NewWebhookServiceServer returns a new WebhookServiceServer
+func NewWebhookServiceServer(webhookStore WebhookStore) *WebhookServiceServer {
+	return &WebhookServiceServer{
+		webhookStore: webhookStore,
+	}
+}
+
+// RegisterWebhook unary RPC that registers a URL to receive the given event types
+func (server *WebhookServiceServer) RegisterWebhook(ctx context.Context, req *pcbook.RegisterWebhookRequest) (*pcbook.RegisterWebhookResponse, error) {
+	log.Printf("received a RegisterWebhook request for url: %s", req.GetUrl())
+
+	webhookURL, err := url.Parse(req.GetUrl())
+	if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || len(webhookURL.Host) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "webhook url is not a valid http url: %s", req.GetUrl())
+	}
+
+	if len(req.GetEventTypes()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one event type is required")
+	}
+	for _, eventType := range req.GetEventTypes() {
+		if eventType == pcbook.WebhookEventType_UNKNOWN_EVENT {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown event type: %v", eventType)
+		}
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate a new webhook ID: %v", err)
+	}
+
+	webhook := &pcbook.Webhook{
+		Id:         id.String(),
+		Url:        webhookURL.String(),
+		EventTypes: req.GetEventTypes(),
+		Secret:     req.GetSecret(),
+		CreatedAt:  timestamppb.Now(),
+	}
+
+	err = server.webhookStore.Save(webhook)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot save webhook to the store: %v", err)
+	}
+
+	log.Printf("registered webhook with id: %s", webhook.Id)
+
+	webhook.Secret = ""
+	res := &pcbook.RegisterWebhookResponse{
+		Webhook: webhook,
+	}
+
+	return res, nil
+}
+
+// ListWebhooks unary RPC that returns all the registered webhooks, without their secrets
+func (server *WebhookServiceServer) ListWebhooks(ctx context.Context, req *pcbook.ListWebhooksRequest) (*pcbook.ListWebhooksResponse, error) {
+	log.Print("received a ListWebhooks request")
+
+	webhooks, err := server.webhookStore.List()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list webhooks: %v", err)
+	}
+
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+
+	res := &pcbook.ListWebhooksResponse{
+		Webhooks: webhooks,
+	}
+
+	return res, nil
+}
+
+// DeleteWebhook unary RPC that unregisters a webhook
+func (server *WebhookServiceServer) DeleteWebhook(ctx context.Context, req *pcbook.DeleteWebhookRequest) (*pcbook.DeleteWebhookResponse, error) {
+	log.Printf("received a DeleteWebhook request with id: %s", req.GetId())
+
+	err := server.webhookStore.Delete(req.GetId())
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrorNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot delete webhook: %v", err)
+	}
+
+	return &pcbook.DeleteWebhookResponse{}, nil
+}
+
+// ListWebhookDeliveries unary RPC that returns the delivery log of a webhook
+func (server *WebhookServiceServer) ListWebhookDeliveries(ctx context.Context, req *pcbook.ListWebhookDeliveriesRequest) (*pcbook.ListWebhookDeliveriesResponse, error) {
+	webhookID := req.GetWebhookId()
+	log.Printf("received a ListWebhookDeliveries request for webhook: %s", webhookID)
+
+	webhook, err := server.webhookStore.Find(webhookID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find webhook: %v", err)
+	}
+	if webhook == nil {
+		return nil, status.Errorf(codes.NotFound, "webhook: %s not found", webhookID)
+	}
+
+	deliveries, err := server.webhookStore.ListDeliveries(webhookID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list webhook deliveries: %v", err)
+	}
+
+	res := &pcbook.ListWebhookDeliveriesResponse{
+		Deliveries: deliveries,
+	}
+
+	return res, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mikhail-bigun/grpc-app-pcbook/pb/pcbook"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxWebhookDeliveries is the number of delivery attempts kept in the log of every webhook
+const maxWebhookDeliveries = 100
+
+// WebhookStore is an interface to store webhooks and their delivery log
+type WebhookStore interface {
+	// Save saves the webhook to the store
+	Save(webhook *pcbook.Webhook) error
+
+	// Find finds a webhook by ID
+	Find(id string) (*pcbook.Webhook, error)
+
+	// List returns all the webhooks, oldest first
+	List() ([]*pcbook.Webhook, error)
+
+	// Delete deletes a webhook and its delivery log, returns ErrorNotFound if there is no such webhook
+	Delete(id string) error
+
+	// AddDelivery appends a delivery attempt to the log of its webhook
+	AddDelivery(delivery *pcbook.WebhookDelivery) error
+
+	// ListDeliveries returns the latest delivery attempts of a webhook, oldest first
+	ListDeliveries(webhookID string) ([]*pcbook.WebhookDelivery, error)
+}
+
+// InMemoryWebhookStore stores webhooks in memory
+type InMemoryWebhookStore struct {
+	mutex      sync.RWMutex
+	webhooks   map[string]*pcbook.Webhook
+	deliveries map[string][]*pcbook.WebhookDelivery
+}
+
+// NewInMemoryWebhookStore returns a new InMemoryWebhookStore
+func NewInMemoryWebhookStore() *InMemoryWebhookStore {
+	return &InMemoryWebhookStore{
+		webhooks:   make(map[string]*pcbook.Webhook),
+		deliveries: make(map[string][]*pcbook.WebhookDelivery),
+	}
+}
+
+// Save saves the webhook to the store
+func (store *InMemoryWebhookStore) Save(webhook *pcbook.Webhook) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.webhooks[webhook.Id] != nil {
+		return ErrorAlreadyExists
+	}
+
+	store.webhooks[webhook.Id] = proto.Clone(webhook).(*pcbook.Webhook)
+	return nil
+}
+
+// Find finds a webhook by ID
+func (store *InMemoryWebhookStore) Find(id string) (*pcbook.Webhook, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	webhook := store.webhooks[id]
+	if webhook == nil {
+		return nil, nil
+	}
+
+	return proto.Clone(webhook).(*pcbook.Webhook), nil
+}
+
+// List returns all the webhooks, oldest first
+func (store *InMemoryWebhookStore) List() ([]*pcbook.Webhook, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	webhooks := make([]*pcbook.Webhook, 0, len(store.webhooks))
+	for _, webhook := range store.webhooks {
+		webhooks = append(webhooks, proto.Clone(webhook).(*pcbook.Webhook))
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].GetCreatedAt().AsTime().Before(webhooks[j].GetCreatedAt().AsTime())
+	})
+
+	return webhooks, nil
+}
+
+// Delete deletes a webhook and its delivery log
+func (store *InMemoryWebhookStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.webhooks[id] == nil {
+		return ErrorNotFound
+	}
+
+	delete(store.webhooks, id)
+	delete(store.deliveries, id)
+	return nil
+}
+
+// AddDelivery appends a delivery attempt to the log of its webhook
+func (store *InMemoryWebhookStore) AddDelivery(delivery *pcbook.WebhookDelivery) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.webhooks[delivery.WebhookId] == nil {
+		// the webhook was deleted while the delivery was in flight
+		return ErrorNotFound
+	}
+
+	deliveries := append(store.deliveries[delivery.WebhookId], proto.Clone(delivery).(*pcbook.WebhookDelivery))
+	if len(deliveries) > maxWebhookDeliveries {
+		deliveries = deliveries[len(deliveries)-maxWebhookDeliveries:]
+	}
+	store.deliveries[delivery.WebhookId] = deliveries
+
+	return nil
+}
+
+// ListDeliveries returns the latest delivery attempts of a webhook, oldest first
+func (store *InMemoryWebhookStore) ListDeliveries(webhookID string) ([]*pcbook.WebhookDelivery, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	deliveries := make([]*pcbook.WebhookDelivery, 0, len(store.deliveries[webhookID]))
+	for _, delivery := range store.deliveries[webhookID] {
+		deliveries = append(deliveries, proto.Clone(delivery).(*pcbook.WebhookDelivery))
+	}
+
+	return deliveries, nil
+}